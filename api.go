@@ -1,9 +1,14 @@
 package dlt645
 
+import (
+	"context"
+	"time"
+)
+
 type Client interface {
 	// read data
 	ReadData(dataMarker uint32, blockQuantity uint8, year, month, day, hour, minute uint8) (results []byte, err error)
-	// write data
+	// write data, data is given in transmission order (low byte first)
 	WriteData(dataMarker uint32, passwordPermission uint8, password uint32, operatorCode uint32, data []byte) (results []byte, err error)
 	// read communication address
 	ReadCommunicationAddress() (results []byte, err error)
@@ -24,3 +29,48 @@ type Client interface {
 	// Clear the event
 	ClearEvent(dataMarker uint32, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error)
 }
+
+// ContextClient is a Client whose commands can be cancelled, see
+// ContextTransporter. The clients of this package implement it.
+type ContextClient interface {
+	Client
+	ReadDataContext(ctx context.Context, dataMarker uint32, blockQuantity uint8, year, month, day, hour, minute uint8) (results []byte, err error)
+	WriteDataContext(ctx context.Context, dataMarker uint32, passwordPermission uint8, password uint32, operatorCode uint32, data []byte) (results []byte, err error)
+	ReadCommunicationAddressContext(ctx context.Context) (results []byte, err error)
+	WriteCommunicationAddressContext(ctx context.Context, commAddr uint64) (results []byte, err error)
+	BroadcastTimingContext(ctx context.Context, year, month, day, hour, minute, second uint8) (err error)
+	FreezeCommandContext(ctx context.Context, month, day, hour, minute uint8) (results []byte, err error)
+	ChangeCommunicationRateContext(ctx context.Context, Word uint8) (results []byte, err error)
+	ChangePasswordContext(ctx context.Context, dataMarker uint32, oldPasswordPermission uint8, oldPassword uint32, newPasswordPermission uint8, newPassword uint32) (results []byte, err error)
+	ClearMaximumDemandContext(ctx context.Context, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error)
+	ClearAmmeterContext(ctx context.Context, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error)
+	ClearEventContext(ctx context.Context, dataMarker uint32, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error)
+}
+
+// RelayClient is a Client controlling the load switch relay and the
+// multi-function terminal of a meter.
+type RelayClient interface {
+	Client
+	// trip, close, alarm or keep power, the meter ignores the command after validUntil
+	RelayControl(command RelayCommand, validUntil time.Time, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error)
+	// select the signal of the multi-function terminal
+	MultiFunctionOutput(output TerminalOutput) (results []byte, err error)
+
+	// variants of the above aborting when ctx is done
+	RelayControlContext(ctx context.Context, command RelayCommand, validUntil time.Time, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error)
+	MultiFunctionOutputContext(ctx context.Context, output TerminalOutput) (results []byte, err error)
+}
+
+// SecurityClient is a Client sending the security authentication commands
+// of meters with an ESAM.
+type SecurityClient interface {
+	Client
+	// security authentication, results are the data following the data identifier
+	SecurityAuthentication(dataMarker uint32, operatorCode uint32, data []byte) (results []byte, err error)
+	// relay control with the N1..N8 field encrypted by a security session
+	SecureRelayControl(operatorCode uint32, ciphertext []byte) (results []byte, err error)
+
+	// variants of the above aborting when ctx is done
+	SecurityAuthenticationContext(ctx context.Context, dataMarker uint32, operatorCode uint32, data []byte) (results []byte, err error)
+	SecureRelayControlContext(ctx context.Context, operatorCode uint32, ciphertext []byte) (results []byte, err error)
+}
@@ -1,8 +1,12 @@
 package dlt645
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
+	"time"
+
+	"github.com/xgbt/dlt645-go/utils"
 )
 
 type ClientHandler interface {
@@ -19,45 +23,90 @@ func NewClient(handler ClientHandler) Client {
 	return &client{packager: handler, transporter: handler}
 }
 
+// NewMeterClient creates a DL/T 645-2007 client bound to the meter at addr.
+// Clients for different meters may share one transporter, the transporter
+// serialises their exchanges.
+func NewMeterClient(transporter Transporter, addr uint64) Client {
+	return &client{packager: &rtuPackager{SlaveAddr: addr}, transporter: transporter}
+}
+
 // ReadData
 func (dtl *client) ReadData(dataMarker uint32, blockQuantity uint8, year, month, day, hour, minute uint8) (results []byte, err error) {
+	return dtl.ReadDataContext(context.Background(), dataMarker, blockQuantity, year, month, day, hour, minute)
+}
+
+// ReadDataContext is like ReadData but aborts when ctx is done.
+//
+// A blockQuantity above 0 is sent as N, with a year above 0 followed by
+// the time mm hh DD MM YY, as load profile reads require. Responses
+// announcing follow-up data are continued with read follow-up data
+// requests, the data of all frames is joined.
+func (dtl *client) ReadDataContext(ctx context.Context, dataMarker uint32, blockQuantity uint8, year, month, day, hour, minute uint8) (results []byte, err error) {
 	uintArray := []interface{}{dataMarker}
 	if blockQuantity > 0 {
 		uintArray = append(uintArray, blockQuantity)
-	}
-	if blockQuantity > 0 && year > 0 {
-		uintArray = append(uintArray, blockQuantity, year, month, day, hour, minute)
+		if year > 0 {
+			uintArray = append(uintArray, bcdArrayToDataDomain(minute, hour, day, month, year))
+		}
 	}
 
 	request := FramePayLoad{
 		FunctionCode: byte(FunctionCodeReadData),
 		Data:         uintArrayToDataDomain(uintArray...),
 	}
-	response, err := dtl.send(&request)
+	response, err := dtl.send(ctx, &request)
 	if err != nil {
 		return
 	}
-	results = append(results, response.Data...)
+	// DI0..DI3 data
+	if len(response.Data) < 4 {
+		err = fmt.Errorf("%w: read data response length '%v' does not meet minimum '4'", ErrMalformedFrame, len(response.Data))
+		return
+	}
+	if err = checkDataMarker(response.Data, dataMarker); err != nil {
+		return
+	}
+	results = append(results, response.Data[4:]...)
 
-	for seq := uint8(1); response.HasFollowUpData && seq <= 255; seq++ {
+	for seq := 1; response.HasFollowUpData && seq <= 255; seq++ {
 		request := FramePayLoad{
 			FunctionCode: byte(FunctionCodeReadFollowUpData),
-			Data:         uintArrayToDataDomain(dataMarker, seq),
+			Data:         uintArrayToDataDomain(dataMarker, uint8(seq)),
 		}
-		response, err = dtl.send(&request)
+		response, err = dtl.send(ctx, &request)
 		if err != nil {
 			return
 		}
-		results = append(results, response.Data...)
+		// DI0..DI3 data SEQ
+		if len(response.Data) < 5 {
+			err = fmt.Errorf("%w: read follow-up data response length '%v' does not meet minimum '5'", ErrMalformedFrame, len(response.Data))
+			return
+		}
+		if err = checkDataMarker(response.Data, dataMarker); err != nil {
+			return
+		}
+		results = append(results, response.Data[4:len(response.Data)-1]...)
 	}
+	return
+}
 
-	results = results[4:]
+// checkDataMarker checks the data identifier echoed in front of the data of
+// a read response, an answer to another request must not pass for this one.
+func checkDataMarker(data []byte, dataMarker uint32) (err error) {
+	if echoed := binary.LittleEndian.Uint32(data); echoed != dataMarker {
+		err = fmt.Errorf("%w: response data identifier '%08x' does not match request '%08x'", ErrMalformedFrame, echoed, dataMarker)
+	}
 	return
 }
 
 // WriteData
 func (dtl *client) WriteData(dataMarker uint32, passwordPermission uint8, password uint32, operatorCode uint32, data []byte) (results []byte, err error) {
-	if passwordPermission > 9 {
+	return dtl.WriteDataContext(context.Background(), dataMarker, passwordPermission, password, operatorCode, data)
+}
+
+// WriteDataContext is like WriteData but aborts when ctx is done.
+func (dtl *client) WriteDataContext(ctx context.Context, dataMarker uint32, passwordPermission uint8, password uint32, operatorCode uint32, data []byte) (results []byte, err error) {
+	if passwordPermission > 9 && passwordPermission != PasswordPermissionCipherMAC && passwordPermission != PasswordPermissionPlainMAC {
 		err = fmt.Errorf("dlt645: password permission '%v must be between '%v' and '%v',", passwordPermission, "0", "9")
 		return
 	}
@@ -68,9 +117,9 @@ func (dtl *client) WriteData(dataMarker uint32, passwordPermission uint8, passwo
 
 	request := FramePayLoad{
 		FunctionCode: byte(FunctionCodeWriteData),
-		Data:         uintArrayToDataDomain(dataMarker, uint32(passwordPermission)<<24|password, operatorCode, data),
+		Data:         uintArrayToDataDomain(dataMarker, passwordField(passwordPermission, password), operatorCode, data),
 	}
-	response, err := dtl.send(&request)
+	response, err := dtl.send(ctx, &request)
 	if err != nil {
 		return
 	}
@@ -81,10 +130,15 @@ func (dtl *client) WriteData(dataMarker uint32, passwordPermission uint8, passwo
 
 // ReadCommunicationAddress
 func (dtl *client) ReadCommunicationAddress() (results []byte, err error) {
+	return dtl.ReadCommunicationAddressContext(context.Background())
+}
+
+// ReadCommunicationAddressContext is like ReadCommunicationAddress but aborts when ctx is done.
+func (dtl *client) ReadCommunicationAddressContext(ctx context.Context) (results []byte, err error) {
 	request := FramePayLoad{
 		FunctionCode: byte(FunctionCodeReadCommunicationAddress),
 	}
-	response, err := dtl.send(&request)
+	response, err := dtl.send(ctx, &request)
 	if err != nil {
 		return
 	}
@@ -95,6 +149,11 @@ func (dtl *client) ReadCommunicationAddress() (results []byte, err error) {
 
 // WriteCommunicationAddress
 func (dtl *client) WriteCommunicationAddress(commAddr uint64) (results []byte, err error) {
+	return dtl.WriteCommunicationAddressContext(context.Background(), commAddr)
+}
+
+// WriteCommunicationAddressContext is like WriteCommunicationAddress but aborts when ctx is done.
+func (dtl *client) WriteCommunicationAddressContext(ctx context.Context, commAddr uint64) (results []byte, err error) {
 	if (commAddr >> 48) > 0 {
 		err = fmt.Errorf("dlt645: communication address '%v' must be between '%v' and '%v',", commAddr, "0byte", "6byte")
 		return
@@ -102,9 +161,9 @@ func (dtl *client) WriteCommunicationAddress(commAddr uint64) (results []byte, e
 
 	request := FramePayLoad{
 		FunctionCode: byte(FunctionCodeWriteCommunicationAddress),
-		Data:         uintArrayToDataDomain(commAddr),
+		Data:         addressToDataDomain(commAddr),
 	}
-	response, err := dtl.send(&request)
+	response, err := dtl.send(ctx, &request)
 	if err != nil {
 		return
 	}
@@ -114,12 +173,17 @@ func (dtl *client) WriteCommunicationAddress(commAddr uint64) (results []byte, e
 
 // BroadcastTiming
 func (dtl *client) BroadcastTiming(year, month, day, hour, minute, second uint8) (err error) {
+	return dtl.BroadcastTimingContext(context.Background(), year, month, day, hour, minute, second)
+}
+
+// BroadcastTimingContext is like BroadcastTiming but aborts when ctx is done.
+func (dtl *client) BroadcastTimingContext(ctx context.Context, year, month, day, hour, minute, second uint8) (err error) {
 	request := FramePayLoad{
 		FunctionCode: byte(FunctionCodeBroadcastTiming),
-		Data:         uintArrayToDataDomain(year, month, day, hour, minute, second),
+		Data:         bcdArrayToDataDomain(second, minute, hour, day, month, year),
 	}
 
-	_, err = dtl.send(&request, true)
+	_, err = dtl.send(ctx, &request, true)
 	if err != nil {
 		return
 	}
@@ -129,12 +193,17 @@ func (dtl *client) BroadcastTiming(year, month, day, hour, minute, second uint8)
 
 // FreezeCommand
 func (dtl *client) FreezeCommand(month, day, hour, minute uint8) (results []byte, err error) {
+	return dtl.FreezeCommandContext(context.Background(), month, day, hour, minute)
+}
+
+// FreezeCommandContext is like FreezeCommand but aborts when ctx is done.
+func (dtl *client) FreezeCommandContext(ctx context.Context, month, day, hour, minute uint8) (results []byte, err error) {
 	request := FramePayLoad{
 		FunctionCode: byte(FunctionCodeFreezeCommand),
-		Data:         uintArrayToDataDomain(month, day, hour, minute),
+		Data:         bcdArrayToDataDomain(minute, hour, day, month),
 	}
 
-	response, err := dtl.send(&request)
+	response, err := dtl.send(ctx, &request)
 	if err != nil {
 		return
 	}
@@ -145,11 +214,16 @@ func (dtl *client) FreezeCommand(month, day, hour, minute uint8) (results []byte
 
 // change communication speed  Word 特征字
 func (dtl *client) ChangeCommunicationRate(word uint8) (results []byte, err error) {
+	return dtl.ChangeCommunicationRateContext(context.Background(), word)
+}
+
+// ChangeCommunicationRateContext is like ChangeCommunicationRate but aborts when ctx is done.
+func (dtl *client) ChangeCommunicationRateContext(ctx context.Context, word uint8) (results []byte, err error) {
 	request := FramePayLoad{
 		FunctionCode: byte(FunctionCodeChangeCommunicationRate),
 		Data:         uintArrayToDataDomain(word),
 	}
-	response, err := dtl.send(&request)
+	response, err := dtl.send(ctx, &request)
 	if err != nil {
 		return
 	}
@@ -160,6 +234,11 @@ func (dtl *client) ChangeCommunicationRate(word uint8) (results []byte, err erro
 
 // change password
 func (dtl *client) ChangePassword(dataMarker uint32, oldPasswordPermission uint8, oldPassword uint32, newPasswordPermission uint8, newPassword uint32) (results []byte, err error) {
+	return dtl.ChangePasswordContext(context.Background(), dataMarker, oldPasswordPermission, oldPassword, newPasswordPermission, newPassword)
+}
+
+// ChangePasswordContext is like ChangePassword but aborts when ctx is done.
+func (dtl *client) ChangePasswordContext(ctx context.Context, dataMarker uint32, oldPasswordPermission uint8, oldPassword uint32, newPasswordPermission uint8, newPassword uint32) (results []byte, err error) {
 	if oldPasswordPermission > 9 || newPasswordPermission > 9 {
 		err = fmt.Errorf("dlt645: old or new password permission '%v'&'%v' must be between '%v' and '%v',", oldPasswordPermission, newPasswordPermission, "0", "9")
 		return
@@ -171,9 +250,9 @@ func (dtl *client) ChangePassword(dataMarker uint32, oldPasswordPermission uint8
 
 	request := FramePayLoad{
 		FunctionCode: byte(FunctionCodeChangePassword),
-		Data:         uintArrayToDataDomain(dataMarker, uint32(oldPasswordPermission)<<24|oldPassword, uint32(newPasswordPermission)<<24|newPassword),
+		Data:         uintArrayToDataDomain(dataMarker, passwordField(oldPasswordPermission, oldPassword), passwordField(newPasswordPermission, newPassword)),
 	}
-	response, err := dtl.send(&request)
+	response, err := dtl.send(ctx, &request)
 	if err != nil {
 		return
 	}
@@ -184,6 +263,11 @@ func (dtl *client) ChangePassword(dataMarker uint32, oldPasswordPermission uint8
 
 // Clear the maximum demand
 func (dtl *client) ClearMaximumDemand(passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	return dtl.ClearMaximumDemandContext(context.Background(), passwordPermission, password, operatorCode)
+}
+
+// ClearMaximumDemandContext is like ClearMaximumDemand but aborts when ctx is done.
+func (dtl *client) ClearMaximumDemandContext(ctx context.Context, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
 	if passwordPermission > 9 {
 		err = fmt.Errorf("dlt645: password permission '%v' must be between '%v' and '%v',", passwordPermission, "0", "9")
 		return
@@ -195,9 +279,9 @@ func (dtl *client) ClearMaximumDemand(passwordPermission uint8, password uint32,
 
 	request := FramePayLoad{
 		FunctionCode: byte(FunctionCodeClearMaximumDemand),
-		Data:         uintArrayToDataDomain(uint32(passwordPermission)<<24|password, operatorCode),
+		Data:         uintArrayToDataDomain(passwordField(passwordPermission, password), operatorCode),
 	}
-	response, err := dtl.send(&request)
+	response, err := dtl.send(ctx, &request)
 	if err != nil {
 		return
 	}
@@ -208,6 +292,11 @@ func (dtl *client) ClearMaximumDemand(passwordPermission uint8, password uint32,
 
 // Clear the ammeter
 func (dtl *client) ClearAmmeter(passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	return dtl.ClearAmmeterContext(context.Background(), passwordPermission, password, operatorCode)
+}
+
+// ClearAmmeterContext is like ClearAmmeter but aborts when ctx is done.
+func (dtl *client) ClearAmmeterContext(ctx context.Context, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
 	if passwordPermission > 9 {
 		err = fmt.Errorf("dlt645: password permission '%v' must be between '%v' and '%v',", passwordPermission, "0", "9")
 		return
@@ -219,9 +308,9 @@ func (dtl *client) ClearAmmeter(passwordPermission uint8, password uint32, opera
 
 	request := FramePayLoad{
 		FunctionCode: byte(FunctionCodeClearAmmeter),
-		Data:         uintArrayToDataDomain(uint32(passwordPermission)<<24|password, operatorCode),
+		Data:         uintArrayToDataDomain(passwordField(passwordPermission, password), operatorCode),
 	}
-	response, err := dtl.send(&request)
+	response, err := dtl.send(ctx, &request)
 	if err != nil {
 		return
 	}
@@ -232,6 +321,11 @@ func (dtl *client) ClearAmmeter(passwordPermission uint8, password uint32, opera
 
 // Clear the event
 func (dtl *client) ClearEvent(dataMarker uint32, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	return dtl.ClearEventContext(context.Background(), dataMarker, passwordPermission, password, operatorCode)
+}
+
+// ClearEventContext is like ClearEvent but aborts when ctx is done.
+func (dtl *client) ClearEventContext(ctx context.Context, dataMarker uint32, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
 	if passwordPermission > 9 {
 		err = fmt.Errorf("dlt645: password permission '%v' must be between '%v' and '%v',", passwordPermission, "0", "9")
 		return
@@ -242,10 +336,92 @@ func (dtl *client) ClearEvent(dataMarker uint32, passwordPermission uint8, passw
 	}
 
 	request := FramePayLoad{
-		FunctionCode: byte(FunctionCodeClearAmmeter),
-		Data:         uintArrayToDataDomain(uint32(passwordPermission)<<24|password, operatorCode, dataMarker),
+		FunctionCode: byte(FunctionCodeClearEvent),
+		Data:         uintArrayToDataDomain(passwordField(passwordPermission, password), operatorCode, dataMarker),
+	}
+	response, err := dtl.send(ctx, &request)
+	if err != nil {
+		return
+	}
+	results = response.Data
+
+	return
+}
+
+// trip, close, alarm or keep power
+func (dtl *client) RelayControl(command RelayCommand, validUntil time.Time, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	return dtl.RelayControlContext(context.Background(), command, validUntil, passwordPermission, password, operatorCode)
+}
+
+// RelayControlContext is like RelayControl but aborts when ctx is done.
+func (dtl *client) RelayControlContext(ctx context.Context, command RelayCommand, validUntil time.Time, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	switch command {
+	case RelayTrip, RelayAllowClose, RelayClose, RelayAlarm, RelayAlarmOff, RelayKeepPower, RelayKeepPowerOff:
+	default:
+		err = fmt.Errorf("dlt645: unknown relay command '%02x'", byte(command))
+		return
+	}
+	if passwordPermission > 9 {
+		err = fmt.Errorf("dlt645: password permission '%v' must be between '%v' and '%v',", passwordPermission, "0", "9")
+		return
+	}
+	if (password >> 24) > 0 {
+		err = fmt.Errorf("dlt645: password '%v' must be less than '%v'", password, "3byte")
+		return
+	}
+
+	// PA P0 P1 P2 C0..C3 N1..N8
+	request := FramePayLoad{
+		FunctionCode: byte(FunctionCodeRelayControl),
+		Data:         uintArrayToDataDomain(passwordField(passwordPermission, password), operatorCode, relayControlData(command, validUntil)),
+	}
+	response, err := dtl.send(ctx, &request)
+	if err != nil {
+		return
+	}
+	results = response.Data
+
+	return
+}
+
+// relay control, N1..N8 encrypted by a security session
+func (dtl *client) SecureRelayControl(operatorCode uint32, ciphertext []byte) (results []byte, err error) {
+	return dtl.SecureRelayControlContext(context.Background(), operatorCode, ciphertext)
+}
+
+// SecureRelayControlContext is like SecureRelayControl but aborts when ctx is done.
+func (dtl *client) SecureRelayControlContext(ctx context.Context, operatorCode uint32, ciphertext []byte) (results []byte, err error) {
+	// 98 00 00 00 C0..C3 ciphertext
+	request := FramePayLoad{
+		FunctionCode: byte(FunctionCodeRelayControl),
+		Data:         uintArrayToDataDomain(passwordField(PasswordPermissionCipherMAC, 0), operatorCode, ciphertext),
+	}
+	response, err := dtl.send(ctx, &request)
+	if err != nil {
+		return
+	}
+	results = response.Data
+
+	return
+}
+
+// select the signal of the multi-function terminal
+func (dtl *client) MultiFunctionOutput(output TerminalOutput) (results []byte, err error) {
+	return dtl.MultiFunctionOutputContext(context.Background(), output)
+}
+
+// MultiFunctionOutputContext is like MultiFunctionOutput but aborts when ctx is done.
+func (dtl *client) MultiFunctionOutputContext(ctx context.Context, output TerminalOutput) (results []byte, err error) {
+	if output > TerminalOutputTariffSwitch {
+		err = fmt.Errorf("dlt645: unknown terminal output '%02x'", byte(output))
+		return
+	}
+
+	request := FramePayLoad{
+		FunctionCode: byte(FunctionCodeMultiFunctionOutput),
+		Data:         uintArrayToDataDomain(uint8(output)),
 	}
-	response, err := dtl.send(&request)
+	response, err := dtl.send(ctx, &request)
 	if err != nil {
 		return
 	}
@@ -254,24 +430,66 @@ func (dtl *client) ClearEvent(dataMarker uint32, passwordPermission uint8, passw
 	return
 }
 
+// security authentication
+func (dtl *client) SecurityAuthentication(dataMarker uint32, operatorCode uint32, data []byte) (results []byte, err error) {
+	return dtl.SecurityAuthenticationContext(context.Background(), dataMarker, operatorCode, data)
+}
+
+// SecurityAuthenticationContext is like SecurityAuthentication but aborts when ctx is done.
+func (dtl *client) SecurityAuthenticationContext(ctx context.Context, dataMarker uint32, operatorCode uint32, data []byte) (results []byte, err error) {
+	// DI0..DI3 C0..C3 data
+	request := FramePayLoad{
+		FunctionCode: byte(FunctionCodeSecurityAuthentication),
+		Data:         uintArrayToDataDomain(dataMarker, operatorCode, data),
+	}
+	response, err := dtl.send(ctx, &request)
+	if err != nil {
+		return
+	}
+	// the answer repeats the data identifier
+	if len(response.Data) < 4 {
+		err = fmt.Errorf("%w: security authentication answer '% x' lacks the data identifier", ErrMalformedFrame, response.Data)
+		return
+	}
+	results = response.Data[4:]
+
+	return
+}
+
 // (dtl *client) send
 //
 // conditions `true` no response required
-func (dtl *client) send(request *FramePayLoad, conditions ...interface{}) (response *FramePayLoad, err error) {
+func (dtl *client) send(ctx context.Context, request *FramePayLoad, conditions ...interface{}) (response *FramePayLoad, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
 	rawRequest, err := dtl.packager.Encode(request)
 	if err != nil {
 		return
 	}
+	transporter, _ := dtl.transporter.(ContextTransporter)
 
 	if len(conditions) > 0 {
 		if nrr, _ := conditions[0].(bool); nrr {
-			err = dtl.transporter.SendNotResponse(rawRequest)
+			if transporter != nil {
+				err = transporter.SendNotResponseContext(ctx, rawRequest)
+			} else {
+				err = dtl.transporter.SendNotResponse(rawRequest)
+			}
 			return
 		}
 	}
 
-	dltResponse, err := dtl.transporter.Send(rawRequest)
+	var dltResponse []byte
+	if transporter != nil {
+		dltResponse, err = transporter.SendContext(ctx, rawRequest)
+	} else {
+		dltResponse, err = dtl.transporter.Send(rawRequest)
+	}
 	if err != nil {
+		if ctx.Err() == nil && isSilence(err) {
+			err = &timeoutError{err: err}
+		}
 		return
 	}
 	if err = dtl.packager.Verify(rawRequest, dltResponse); err != nil {
@@ -303,6 +521,9 @@ func (dtl *client) send(request *FramePayLoad, conditions ...interface{}) (respo
 // 	return uintArrayToBytes(n...)
 // }
 
+// uintArrayToDataDomain serializes the fields of a data domain in
+// transmission order, every integer field low byte first. Byte slices are
+// copied as they are.
 func uintArrayToDataDomain(n ...interface{}) []byte {
 	var b []byte
 	for _, v := range n {
@@ -317,17 +538,40 @@ func uintToBytes(n interface{}) (data []byte) {
 		data = append(data, n)
 	case uint16:
 		data = make([]byte, 2)
-		binary.BigEndian.PutUint16(data, n)
+		binary.LittleEndian.PutUint16(data, n)
 	case uint32:
 		data = make([]byte, 4)
-		binary.BigEndian.PutUint32(data, n)
+		binary.LittleEndian.PutUint32(data, n)
 	case uint64:
 		data = make([]byte, 8)
-		binary.BigEndian.PutUint64(data, n)
+		binary.LittleEndian.PutUint64(data, n)
+	case []byte:
+		data = append(data, n...)
 	}
 	return
 }
 
+// bcdArrayToDataDomain serializes one BCD byte per value, in the given order.
+func bcdArrayToDataDomain(n ...uint8) []byte {
+	data := make([]byte, len(n))
+	for i, v := range n {
+		data[i] = utils.BCDFromUint8(v)
+	}
+	return data
+}
+
+// relayControlData serializes N1 N2 ss mm hh DD MM YY of a relay command.
+func relayControlData(command RelayCommand, validUntil time.Time) []byte {
+	t := validUntil.Local()
+	return append([]byte{byte(command), 0},
+		bcdArrayToDataDomain(uint8(t.Second()), uint8(t.Minute()), uint8(t.Hour()), uint8(t.Day()), uint8(t.Month()), uint8(t.Year()%100))...)
+}
+
+// passwordField packs permission and password into the PA P0 P1 P2 field.
+func passwordField(permission uint8, password uint32) uint32 {
+	return password<<8 | uint32(permission)
+}
+
 func dataBlock(value ...uint16) []byte {
 	data := make([]byte, 2*len(value))
 	for i, v := range value {
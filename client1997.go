@@ -0,0 +1,419 @@
+package dlt645
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	WriteDataDomain1997MaxSize = 50
+)
+
+// Client1997Handler implements Packager and Transporter interface for
+// meters speaking DL/T 645-1997.
+type Client1997Handler struct {
+	rtu1997Packager
+	rtuSerialTransporter
+}
+
+// NewClient1997Handler allocates a new Client1997Handler, DL/T 645-1997
+// meters default to 1200 baud.
+func NewClient1997Handler(address string) *Client1997Handler {
+	handler := &Client1997Handler{}
+	handler.Address = address
+	handler.BaudRate = 1200
+	handler.Timeout = serialTimeout
+	handler.IdleTimeout = serialIdleTimeout
+	return handler
+}
+
+// Client1997 creates DL/T 645-1997 client with default handler and given
+// serial device.
+func Client1997(address string) Client {
+	handler := NewClient1997Handler(address)
+	return NewClient1997(handler)
+}
+
+// NewClient1997 creates a client mapping the Client interface onto the
+// DL/T 645-1997 function codes, handler can be any transport carrying
+// DL/T 645-1997 frames.
+func NewClient1997(handler ClientHandler) Client {
+	return &client1997{client: client{packager: handler, transporter: handler}}
+}
+
+// Meter returns a Client bound to the meter at addr, sharing the serial port
+// of the handler with every other meter on the bus.
+func (handler *Client1997Handler) Meter(addr uint64) Client {
+	return NewMeter1997Client(handler, addr)
+}
+
+// NewMeter1997Client creates a DL/T 645-1997 client bound to the meter at
+// addr, see NewMeterClient.
+func NewMeter1997Client(transporter Transporter, addr uint64) Client {
+	return &client1997{client: client{packager: &rtu1997Packager{SlaveAddr: addr}, transporter: transporter}}
+}
+
+type rtu1997Packager struct {
+	SlaveAddr uint64
+}
+
+// Encode encodes a DTL645-1997 frame, the frame layout is the same as in
+// DL/T 645-2007:
+//
+// StartSymbol   : 1 byte
+// Address       : 6 byte
+// StartSymbol2  : 1 byte
+// ControlCode   : 1 byte
+// DataLen       : 1 byte
+// Data          : n byte
+// CheckSUm      : 1 byte
+// EndSymbol     : 1 byte
+func (dtl *rtu1997Packager) Encode(frame *FramePayLoad) (raw []byte, err error) {
+	dataDomainLen := len(frame.Data)
+	if frame.FunctionCode == FunctionCode1997WriteData && dataDomainLen > WriteDataDomain1997MaxSize {
+		err = fmt.Errorf("dtl: length of data domain '%v' must not be bigger than '%v'", dataDomainLen, WriteDataDomain1997MaxSize)
+		return
+	}
+	if dataDomainLen > ReadDataDomainMaxSize {
+		err = fmt.Errorf("dtl: length of data domain '%v' must not be bigger than '%v'", dataDomainLen, ReadDataDomainMaxSize)
+		return
+	}
+	raw = encodeFrame(addressToDataDomain(dtl.SlaveAddr), frame.FunctionCode&0x1F, frame.Data)
+	return
+}
+
+// Decode a DTL645-1997 frame, the error word of an abnormal response:
+//
+// bit 0 : illegal data
+// bit 1 : data identifier error
+// bit 2 : password error
+// bit 4 : number of time zones exceeded
+// bit 5 : number of day periods exceeded
+// bit 6 : number of rates exceeded
+func (dtl *rtu1997Packager) Decode(raw []byte) (payload *FramePayLoad, err error) {
+	payload, err = decodeFrame(raw)
+	var securityError *SecurityError
+	if errors.As(err, &securityError) {
+		// 0x03 is re-read data, there is no security authentication
+		err = responseError(payload.FunctionCode, payload.Data[0])
+	}
+	var dltError *DltError
+	if errors.As(err, &dltError) {
+		dltError.names = exceptionNames1997
+	}
+	return
+}
+
+// Verify verifies response length and slave id.
+func (dtl *rtu1997Packager) Verify(request []byte, response []byte) (err error) {
+	return verifyFrame(request, response)
+}
+
+// client1997 implements Client interface on top of the DL/T 645-1997
+// function codes. Commands DL/T 645-1997 does not define return
+// ErrNotSupported.
+type client1997 struct {
+	client client
+}
+
+// ReadData reads a 2 byte data identifier, dataMarker must not exceed 0xFFFF.
+// Block reads with a start time do not exist in DL/T 645-1997.
+func (dtl *client1997) ReadData(dataMarker uint32, blockQuantity uint8, year, month, day, hour, minute uint8) (results []byte, err error) {
+	return dtl.ReadDataContext(context.Background(), dataMarker, blockQuantity, year, month, day, hour, minute)
+}
+
+// ReadDataContext is like ReadData but aborts when ctx is done.
+func (dtl *client1997) ReadDataContext(ctx context.Context, dataMarker uint32, blockQuantity uint8, year, month, day, hour, minute uint8) (results []byte, err error) {
+	if dataMarker > 0xFFFF {
+		err = fmt.Errorf("dlt645: data identifier '%x' must be less than '%v'", dataMarker, "2byte")
+		return
+	}
+	if blockQuantity > 0 || year > 0 {
+		err = fmt.Errorf("dlt645: DL/T 645-1997 has no block read: %w", ErrNotSupported)
+		return
+	}
+
+	request := FramePayLoad{
+		FunctionCode: byte(FunctionCode1997ReadData),
+		Data:         uintArrayToDataDomain(uint16(dataMarker)),
+	}
+	response, err := dtl.client.send(ctx, &request)
+	if err != nil {
+		return
+	}
+	if results, err = stripDataMarker1997(response, dataMarker); err != nil {
+		return
+	}
+
+	for frames := 1; response.HasFollowUpData; frames++ {
+		// a meter flagging follow-up data forever is broken
+		if frames > 255 {
+			err = fmt.Errorf("%w: follow-up data of '%04x' exceeds '255' frames", ErrMalformedFrame, dataMarker)
+			return
+		}
+		request := FramePayLoad{
+			FunctionCode: byte(FunctionCode1997ReadFollowUpData),
+			Data:         uintArrayToDataDomain(uint16(dataMarker)),
+		}
+		response, err = dtl.client.send(ctx, &request)
+		if err != nil {
+			return
+		}
+		var data []byte
+		if data, err = stripDataMarker1997(response, dataMarker); err != nil {
+			return
+		}
+		results = append(results, data...)
+	}
+
+	return
+}
+
+// WriteData writes a 2 byte data identifier. DL/T 645-1997 has no operator
+// code, operatorCode is ignored.
+func (dtl *client1997) WriteData(dataMarker uint32, passwordPermission uint8, password uint32, operatorCode uint32, data []byte) (results []byte, err error) {
+	return dtl.WriteDataContext(context.Background(), dataMarker, passwordPermission, password, operatorCode, data)
+}
+
+// WriteDataContext is like WriteData but aborts when ctx is done.
+func (dtl *client1997) WriteDataContext(ctx context.Context, dataMarker uint32, passwordPermission uint8, password uint32, operatorCode uint32, data []byte) (results []byte, err error) {
+	if dataMarker > 0xFFFF {
+		err = fmt.Errorf("dlt645: data identifier '%x' must be less than '%v'", dataMarker, "2byte")
+		return
+	}
+	if passwordPermission > 9 {
+		err = fmt.Errorf("dlt645: password permission '%v must be between '%v' and '%v',", passwordPermission, "0", "9")
+		return
+	}
+	if (password >> 24) > 0 {
+		err = fmt.Errorf("dlt645: password '%v' must be less than '%v'", password, "3byte")
+		return
+	}
+
+	request := FramePayLoad{
+		FunctionCode: byte(FunctionCode1997WriteData),
+		Data:         uintArrayToDataDomain(uint16(dataMarker), passwordField(passwordPermission, password), data),
+	}
+	response, err := dtl.client.send(ctx, &request)
+	if err != nil {
+		return
+	}
+
+	results = response.Data
+	return
+}
+
+// ReadCommunicationAddress is not defined in DL/T 645-1997.
+func (dtl *client1997) ReadCommunicationAddress() (results []byte, err error) {
+	return dtl.ReadCommunicationAddressContext(context.Background())
+}
+
+// ReadCommunicationAddressContext is like ReadCommunicationAddress but aborts when ctx is done.
+func (dtl *client1997) ReadCommunicationAddressContext(ctx context.Context) (results []byte, err error) {
+	err = fmt.Errorf("dlt645: DL/T 645-1997 has no read communication address command: %w", ErrNotSupported)
+	return
+}
+
+// WriteCommunicationAddress
+func (dtl *client1997) WriteCommunicationAddress(commAddr uint64) (results []byte, err error) {
+	return dtl.WriteCommunicationAddressContext(context.Background(), commAddr)
+}
+
+// WriteCommunicationAddressContext is like WriteCommunicationAddress but aborts when ctx is done.
+func (dtl *client1997) WriteCommunicationAddressContext(ctx context.Context, commAddr uint64) (results []byte, err error) {
+	if (commAddr >> 48) > 0 {
+		err = fmt.Errorf("dlt645: communication address '%v' must be between '%v' and '%v',", commAddr, "0byte", "6byte")
+		return
+	}
+
+	request := FramePayLoad{
+		FunctionCode: byte(FunctionCode1997WriteCommunicationAddress),
+		Data:         addressToDataDomain(commAddr),
+	}
+	response, err := dtl.client.send(ctx, &request)
+	if err != nil {
+		return
+	}
+	results = response.Data
+	return
+}
+
+// BroadcastTiming
+func (dtl *client1997) BroadcastTiming(year, month, day, hour, minute, second uint8) (err error) {
+	return dtl.BroadcastTimingContext(context.Background(), year, month, day, hour, minute, second)
+}
+
+// BroadcastTimingContext is like BroadcastTiming but aborts when ctx is done.
+func (dtl *client1997) BroadcastTimingContext(ctx context.Context, year, month, day, hour, minute, second uint8) (err error) {
+	request := FramePayLoad{
+		FunctionCode: byte(FunctionCode1997BroadcastTiming),
+		Data:         bcdArrayToDataDomain(second, minute, hour, day, month, year),
+	}
+
+	_, err = dtl.client.send(ctx, &request, true)
+	return
+}
+
+// FreezeCommand is not defined in DL/T 645-1997.
+func (dtl *client1997) FreezeCommand(month, day, hour, minute uint8) (results []byte, err error) {
+	return dtl.FreezeCommandContext(context.Background(), month, day, hour, minute)
+}
+
+// FreezeCommandContext is like FreezeCommand but aborts when ctx is done.
+func (dtl *client1997) FreezeCommandContext(ctx context.Context, month, day, hour, minute uint8) (results []byte, err error) {
+	err = fmt.Errorf("dlt645: DL/T 645-1997 has no freeze command: %w", ErrNotSupported)
+	return
+}
+
+// change communication speed  Word 特征字
+func (dtl *client1997) ChangeCommunicationRate(word uint8) (results []byte, err error) {
+	return dtl.ChangeCommunicationRateContext(context.Background(), word)
+}
+
+// ChangeCommunicationRateContext is like ChangeCommunicationRate but aborts when ctx is done.
+func (dtl *client1997) ChangeCommunicationRateContext(ctx context.Context, word uint8) (results []byte, err error) {
+	request := FramePayLoad{
+		FunctionCode: byte(FunctionCode1997ChangeCommunicationRate),
+		Data:         uintArrayToDataDomain(word),
+	}
+	response, err := dtl.client.send(ctx, &request)
+	if err != nil {
+		return
+	}
+	results = response.Data
+
+	return
+}
+
+// change password, DL/T 645-1997 has no password data identifier and
+// dataMarker is ignored.
+func (dtl *client1997) ChangePassword(dataMarker uint32, oldPasswordPermission uint8, oldPassword uint32, newPasswordPermission uint8, newPassword uint32) (results []byte, err error) {
+	return dtl.ChangePasswordContext(context.Background(), dataMarker, oldPasswordPermission, oldPassword, newPasswordPermission, newPassword)
+}
+
+// ChangePasswordContext is like ChangePassword but aborts when ctx is done.
+func (dtl *client1997) ChangePasswordContext(ctx context.Context, dataMarker uint32, oldPasswordPermission uint8, oldPassword uint32, newPasswordPermission uint8, newPassword uint32) (results []byte, err error) {
+	if oldPasswordPermission > 9 || newPasswordPermission > 9 {
+		err = fmt.Errorf("dlt645: old or new password permission '%v'&'%v' must be between '%v' and '%v',", oldPasswordPermission, newPasswordPermission, "0", "9")
+		return
+	}
+	if (oldPassword>>24) > 0 || (newPassword>>24) > 0 {
+		err = fmt.Errorf("dlt645: old or new password '%v'&'%v' must be less than '%v'", oldPassword, newPassword, "3byte")
+		return
+	}
+
+	request := FramePayLoad{
+		FunctionCode: byte(FunctionCode1997ChangePassword),
+		Data:         uintArrayToDataDomain(passwordField(oldPasswordPermission, oldPassword), passwordField(newPasswordPermission, newPassword)),
+	}
+	response, err := dtl.client.send(ctx, &request)
+	if err != nil {
+		return
+	}
+	results = response.Data
+
+	return
+}
+
+// Clear the maximum demand, the DL/T 645-1997 command carries no password
+// and the arguments are ignored.
+func (dtl *client1997) ClearMaximumDemand(passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	return dtl.ClearMaximumDemandContext(context.Background(), passwordPermission, password, operatorCode)
+}
+
+// ClearMaximumDemandContext is like ClearMaximumDemand but aborts when ctx is done.
+func (dtl *client1997) ClearMaximumDemandContext(ctx context.Context, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	request := FramePayLoad{
+		FunctionCode: byte(FunctionCode1997ClearMaximumDemand),
+	}
+	response, err := dtl.client.send(ctx, &request)
+	if err != nil {
+		return
+	}
+	results = response.Data
+
+	return
+}
+
+// ClearAmmeter is not defined in DL/T 645-1997.
+func (dtl *client1997) ClearAmmeter(passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	return dtl.ClearAmmeterContext(context.Background(), passwordPermission, password, operatorCode)
+}
+
+// ClearAmmeterContext is like ClearAmmeter but aborts when ctx is done.
+func (dtl *client1997) ClearAmmeterContext(ctx context.Context, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	err = fmt.Errorf("dlt645: DL/T 645-1997 has no clear ammeter command: %w", ErrNotSupported)
+	return
+}
+
+// ClearEvent is not defined in DL/T 645-1997.
+func (dtl *client1997) ClearEvent(dataMarker uint32, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	return dtl.ClearEventContext(context.Background(), dataMarker, passwordPermission, password, operatorCode)
+}
+
+// ClearEventContext is like ClearEvent but aborts when ctx is done.
+func (dtl *client1997) ClearEventContext(ctx context.Context, dataMarker uint32, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	err = fmt.Errorf("dlt645: DL/T 645-1997 has no clear event command: %w", ErrNotSupported)
+	return
+}
+
+// RelayControl is not defined in DL/T 645-1997.
+func (dtl *client1997) RelayControl(command RelayCommand, validUntil time.Time, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	return dtl.RelayControlContext(context.Background(), command, validUntil, passwordPermission, password, operatorCode)
+}
+
+// RelayControlContext is like RelayControl but aborts when ctx is done.
+func (dtl *client1997) RelayControlContext(ctx context.Context, command RelayCommand, validUntil time.Time, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	err = fmt.Errorf("dlt645: DL/T 645-1997 has no relay control command: %w", ErrNotSupported)
+	return
+}
+
+// MultiFunctionOutput is not defined in DL/T 645-1997.
+func (dtl *client1997) MultiFunctionOutput(output TerminalOutput) (results []byte, err error) {
+	return dtl.MultiFunctionOutputContext(context.Background(), output)
+}
+
+// MultiFunctionOutputContext is like MultiFunctionOutput but aborts when ctx is done.
+func (dtl *client1997) MultiFunctionOutputContext(ctx context.Context, output TerminalOutput) (results []byte, err error) {
+	err = fmt.Errorf("dlt645: DL/T 645-1997 has no multi-function terminal output command: %w", ErrNotSupported)
+	return
+}
+
+// SecurityAuthentication is not defined in DL/T 645-1997.
+func (dtl *client1997) SecurityAuthentication(dataMarker uint32, operatorCode uint32, data []byte) (results []byte, err error) {
+	return dtl.SecurityAuthenticationContext(context.Background(), dataMarker, operatorCode, data)
+}
+
+// SecurityAuthenticationContext is like SecurityAuthentication but aborts when ctx is done.
+func (dtl *client1997) SecurityAuthenticationContext(ctx context.Context, dataMarker uint32, operatorCode uint32, data []byte) (results []byte, err error) {
+	err = fmt.Errorf("dlt645: DL/T 645-1997 has no security authentication command: %w", ErrNotSupported)
+	return
+}
+
+// SecureRelayControl is not defined in DL/T 645-1997.
+func (dtl *client1997) SecureRelayControl(operatorCode uint32, ciphertext []byte) (results []byte, err error) {
+	return dtl.SecureRelayControlContext(context.Background(), operatorCode, ciphertext)
+}
+
+// SecureRelayControlContext is like SecureRelayControl but aborts when ctx is done.
+func (dtl *client1997) SecureRelayControlContext(ctx context.Context, operatorCode uint32, ciphertext []byte) (results []byte, err error) {
+	err = fmt.Errorf("dlt645: DL/T 645-1997 has no relay control command: %w", ErrNotSupported)
+	return
+}
+
+// stripDataMarker1997 removes the 2 byte data identifier echoed in front of
+// the data of a read response, it must be the one requested.
+func stripDataMarker1997(response *FramePayLoad, dataMarker uint32) (data []byte, err error) {
+	if len(response.Data) < 2 {
+		err = fmt.Errorf("dlt645: response data length '%v' does not meet minimum '%v'", len(response.Data), 2)
+		return
+	}
+	if echoed := uint32(response.Data[0]) | uint32(response.Data[1])<<8; echoed != dataMarker {
+		err = fmt.Errorf("%w: response data identifier '%04x' does not match request '%04x'", ErrMalformedFrame, echoed, dataMarker)
+		return
+	}
+	data = response.Data[2:]
+	return
+}
@@ -0,0 +1,130 @@
+package dlt645
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient1997RequestFrames(t *testing.T) {
+	const meter = 304257140001
+	tests := []struct {
+		name string
+		addr uint64
+		send func(c Client) error
+		want string
+	}{
+		{"read data", meter, func(c Client) (err error) {
+			_, err = c.ReadData(0x9010, 0, 0, 0, 0, 0, 0)
+			return
+		}, "68 01 00 14 57 42 30 68 01 02 43 c3 b7 16"},
+		{"write data", meter, func(c Client) (err error) {
+			_, err = c.WriteData(0xC010, 2, 0x123456, 0x11223344, []byte{0x15})
+			return
+		}, "68 01 00 14 57 42 30 68 04 07 43 f3 35 89 67 45 48 a1 16"},
+		{"write communication address", WildcardAddressDomain, func(c Client) (err error) {
+			_, err = c.WriteCommunicationAddress(304257140002)
+			return
+		}, "68 aa aa aa aa aa aa 68 0a 06 35 33 47 8a 75 63 ed 16"},
+		{"broadcast timing", BroadcastAddressDomain, func(c Client) (err error) {
+			return c.BroadcastTiming(24, 5, 6, 7, 8, 9)
+		}, "68 99 99 99 99 99 99 68 08 06 3c 3b 3a 39 38 57 ed 16"},
+		{"change communication rate", meter, func(c Client) (err error) {
+			_, err = c.ChangeCommunicationRate(CommunicationRate9600)
+			return
+		}, "68 01 00 14 57 42 30 68 0c 01 53 0e 16"},
+		{"change password", meter, func(c Client) (err error) {
+			_, err = c.ChangePassword(0, 2, 0x123456, 2, 0x654321)
+			return
+		}, "68 01 00 14 57 42 30 68 0f 08 35 89 67 45 35 54 76 98 c6 16"},
+		{"clear maximum demand", meter, func(c Client) (err error) {
+			_, err = c.ClearMaximumDemand(2, 0x123456, 0x11223344)
+			return
+		}, "68 01 00 14 57 42 30 68 10 00 be 16"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transporter := &recordingTransporter{}
+			if err := test.send(NewMeter1997Client(transporter, test.addr)); err != nil && err != errRecorded {
+				t.Fatal(err)
+			}
+			if got, want := transporter.request(t), unspaced(test.want); got != want {
+				t.Fatalf("request %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestClient1997NotSupported(t *testing.T) {
+	transporter := &recordingTransporter{}
+	c := NewMeter1997Client(transporter, 304257140001)
+	validUntil := time.Now()
+	tests := []struct {
+		name string
+		send func() error
+	}{
+		{"read communication address", func() (err error) { _, err = c.ReadCommunicationAddress(); return }},
+		{"freeze", func() (err error) { _, err = c.FreezeCommand(99, 1, 0, 0); return }},
+		{"clear ammeter", func() (err error) { _, err = c.ClearAmmeter(2, 0, 0); return }},
+		{"clear event", func() (err error) { _, err = c.ClearEvent(0xFFFFFFFF, 2, 0, 0); return }},
+		{"relay control", func() (err error) { _, err = c.(RelayClient).RelayControl(RelayTrip, validUntil, 2, 0, 0); return }},
+		{"multi-function output", func() (err error) { _, err = c.(RelayClient).MultiFunctionOutput(TerminalOutputClockPulse); return }},
+		{"security authentication", func() (err error) { _, err = c.(SecurityClient).SecurityAuthentication(0x070000FF, 0, nil); return }},
+		{"secure relay control", func() (err error) { _, err = c.(SecurityClient).SecureRelayControl(0, nil); return }},
+		{"block read", func() (err error) { _, err = c.ReadData(0x9010, 1, 0, 0, 0, 0, 0); return }},
+	}
+	for _, test := range tests {
+		if err := test.send(); !errors.Is(err, ErrNotSupported) {
+			t.Errorf("%s: error %v, want ErrNotSupported", test.name, err)
+		}
+	}
+	if len(transporter.requests) > 0 {
+		t.Errorf("%d requests sent for unsupported commands", len(transporter.requests))
+	}
+	if _, err := c.ReadData(0x10000, 0, 0, 0, 0, 0, 0); err == nil || errors.Is(err, errRecorded) {
+		t.Errorf("3 byte data identifier: error %v", err)
+	}
+}
+
+func TestRtu1997PackagerDecode(t *testing.T) {
+	addr := addressToDataDomain(304257140001)
+	packager := &rtu1997Packager{SlaveAddr: 304257140001}
+
+	payload, err := packager.Decode(encodeFrame(addr, 0xA1, []byte{0x10, 0x90, 0x12, 0x34, 0x56, 0x00}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.FunctionCode != FunctionCode1997ReadData || !payload.HasFollowUpData || !bytes.Equal(payload.Data, []byte{0x10, 0x90, 0x12, 0x34, 0x56, 0x00}) {
+		t.Fatalf("payload %+v", payload)
+	}
+	data, err := stripDataMarker1997(payload, 0x9010)
+	if err != nil || !bytes.Equal(data, []byte{0x12, 0x34, 0x56, 0x00}) {
+		t.Fatalf("data % x, error %v", data, err)
+	}
+
+	tests := []struct {
+		controlCode byte
+		word        byte
+		name        string
+	}{
+		{0xC1, ExceptionCode1997DataMarkerError, "Data identifier error"},
+		{0xC1, ExceptionCode1997IllegalData, "Illegal data"},
+		{0xC4, ExceptionCode1997IllegalPassword, "Incorrect password"},
+		{0xC4, 0x08, "Unknown"},
+		// re-read data shares its function code with the 2007 security
+		// authentication
+		{0xC3, ExceptionCode1997DataMarkerError, "Data identifier error"},
+	}
+	for _, test := range tests {
+		_, err := packager.Decode(encodeFrame(addr, test.controlCode, []byte{test.word, 0x00}))
+		var dltError *DltError
+		if !errors.As(err, &dltError) || dltError.ExceptionCode != test.word || !strings.Contains(err.Error(), test.name) {
+			t.Errorf("exception '%02x': error %v, want %s", test.word, err, test.name)
+		}
+		if strings.Contains(err.Error(), "Request without data") || strings.Contains(err.Error(), "Other error") {
+			t.Errorf("exception '%02x': error %v named after DL/T 645-2007", test.word, err)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package dlt645
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"reflect"
@@ -45,6 +47,12 @@ func Client2007(address string) Client {
 	return NewClient(handler)
 }
 
+// Meter returns a Client bound to the meter at addr, sharing the serial port
+// of the handler with every other meter on the bus.
+func (handler *Client2007Handler) Meter(addr uint64) Client {
+	return NewMeterClient(handler, addr)
+}
+
 type rtuPackager struct {
 	SlaveAddr uint64
 }
@@ -60,42 +68,38 @@ type rtuPackager struct {
 // CheckSUm      : 1 byte
 // EndSymbol     : 1 byte
 func (dtl *rtuPackager) Encode(frame *FramePayLoad) (raw []byte, err error) {
-	dataDomainLen := len(frame.Data)
-
-	rawLen := 12 + dataDomainLen
-
-	if dataDomainLen > ReadDataDomainMaxSize {
-		err = fmt.Errorf("dtl: length of data domain '%v' must not be bigger than '%v'", dataDomainLen, ReadDataDomainMaxSize)
+	if len(frame.Data) > ReadDataDomainMaxSize {
+		err = fmt.Errorf("dtl: length of data domain '%v' must not be bigger than '%v'", len(frame.Data), ReadDataDomainMaxSize)
 		return
 	}
+	raw = encodeFrame(addressToDataDomain(dtl.SlaveAddr), frame.FunctionCode&0x1F, frame.Data)
+	return
+}
+
+// encodeFrame builds a frame from the 6 address bytes as transmitted, the
+// control code and the data domain in transmission order, the data domain
+// is scrambled with 0x33 here.
+func encodeFrame(address []byte, controlCode byte, data []byte) (raw []byte) {
+	dataDomainLen := len(data)
+
+	rawLen := 12 + dataDomainLen
 
 	raw = make([]byte, rawLen)
 
 	raw[0] = FrameHead
-	slaveAddrBCD := utils.BCDFromUint(dtl.SlaveAddr, 6)
-	raw[1] = slaveAddrBCD[5]
-	raw[2] = slaveAddrBCD[4]
-	raw[3] = slaveAddrBCD[3]
-	raw[4] = slaveAddrBCD[2]
-	raw[5] = slaveAddrBCD[1]
-	raw[6] = slaveAddrBCD[0]
+	copy(raw[1:7], address)
 	raw[7] = FrameHead
 	// controlCode
 	// 8 bit   : 0 master send   1 slave send
 	// 7 biy   : 0 slave ok   1 slave err
 	// 6 bit   : 0 have not follow-up data    1 have follow-up data
 	// 1-5 bit : function code
-	controlCode := frame.FunctionCode
-	controlCode = controlCode & 0x1F // 0001 1111
 	raw[8] = controlCode
 
 	raw[9] = byte(dataDomainLen)
-	dataDomain := make([]byte, len(frame.Data))
-	for k, v := range frame.Data {
-		dataDomain[k] = v + 0x33
+	for k, v := range data {
+		raw[10+k] = v + 0x33
 	}
-	Reverse(dataDomain)
-	copy(raw[10:], dataDomain)
 
 	// append check sum
 	checkSum := utils.GenerateCheckSum(raw[:rawLen-2])
@@ -105,6 +109,19 @@ func (dtl *rtuPackager) Encode(frame *FramePayLoad) (raw []byte, err error) {
 	return
 }
 
+// addressToDataDomain converts a meter address to its 6 byte BCD form,
+// low byte first as transmitted. Addresses above 999999999999 are taken as
+// the hex image of the address field, e.g. BroadcastAddressDomain or
+// WildcardAddressDomain.
+func addressToDataDomain(addr uint64) []byte {
+	if addr > maxAddress {
+		return uintToBytes(addr)[:6]
+	}
+	addrBCD := utils.BCDFromUint(addr, 6)
+	Reverse(addrBCD)
+	return addrBCD
+}
+
 // Reverse reverses the elements of s in place.
 func Reverse(s interface{}) {
 	// Check if s is a slice
@@ -131,12 +148,24 @@ func Reverse(s interface{}) {
 // CheckSUm      : 1 byte
 // EndSymbol     : 1 byte
 func (dlt *rtuPackager) Decode(raw []byte) (payload *FramePayLoad, err error) {
+	return decodeFrame(raw)
+}
+
+func decodeFrame(raw []byte) (payload *FramePayLoad, err error) {
 	length := len(raw)
+	if length < rtuMinSize+2 {
+		err = fmt.Errorf("%w: response length '%v' does not meet minimum '%v'", ErrFrameTooShort, length, rtuMinSize+2)
+		return
+	}
+	if raw[0] != FrameHead || raw[7] != FrameHead || raw[length-1] != FrameTail || int(raw[9])+12 != length {
+		err = fmt.Errorf("%w: % x", ErrMalformedFrame, raw)
+		return
+	}
 	// Calculate checksum
 	checkSum := utils.GenerateCheckSum(raw[:length-2])
 
 	if checkSum != raw[length-2] {
-		err = fmt.Errorf("dlt645: response check sum '%v' does not match expected '%v'", raw[length-2], checkSum)
+		err = fmt.Errorf("%w: response check sum '%v' does not match expected '%v'", ErrChecksum, raw[length-2], checkSum)
 		return
 	}
 	// Function code & data
@@ -150,6 +179,11 @@ func (dlt *rtuPackager) Decode(raw []byte) (payload *FramePayLoad, err error) {
 	payload.Data = dataDomain
 	// check err word
 	IsSlaveErr := (raw[8]&0x40)>>6 != 0 // 0100 0000
+	if IsSlaveErr && payload.FunctionCode == FunctionCodeSecurityAuthentication && len(dataDomain) >= 2 {
+		// SERR, the 2 byte security error word
+		err = &SecurityError{Code: uint16(dataDomain[0]) | uint16(dataDomain[1])<<8}
+		return
+	}
 	if IsSlaveErr && len(dataDomain) > 0 {
 		err = responseError(payload.FunctionCode, dataDomain[0])
 		return
@@ -169,18 +203,25 @@ func (dlt *rtuPackager) Decode(raw []byte) (payload *FramePayLoad, err error) {
 // CheckSUm      : 1 byte
 // EndSymbol     : 1 byte
 func (dlt *rtuPackager) Verify(request []byte, response []byte) (err error) {
+	return verifyFrame(request, response)
+}
+
+func verifyFrame(request []byte, response []byte) (err error) {
 	length := len(response)
 	// Minimum size (including address, function and CRC)
 	if length < rtuMinSize {
-		err = fmt.Errorf("dlt: response length '%v' does not meet minimum '%v'", length, rtuMinSize)
+		err = fmt.Errorf("%w: response length '%v' does not meet minimum '%v'", ErrFrameTooShort, length, rtuMinSize)
 		return
 	}
-	// Slave address must match
-	for k, v := range response[1:7] {
-		if v != request[k+1] {
-			err = fmt.Errorf("dlt: response slave id '%v' does not match request '%v'", response[1:7], request[1:7])
-			return
-		}
+	// Slave address must match, AA wildcard bytes match any
+	if !matchAddress(request[1:7], response[1:7]) {
+		err = fmt.Errorf("%w: response slave id '%v' does not match request '%v'", ErrAddressMismatch, response[1:7], request[1:7])
+		return
+	}
+	// Response must come from the slave and answer the request
+	if response[8]&0x80 == 0 || response[8]&0x1F != request[8]&0x1F {
+		err = fmt.Errorf("%w: response control code '%x' does not answer request '%x'", ErrUnexpectedFunctionCode, response[8], request[8])
+		return
 	}
 
 	return
@@ -202,19 +243,48 @@ type rtuSerialTransporter struct {
 }
 
 func (dlt *rtuSerialTransporter) Send(request []byte) (response []byte, err error) {
+	return dlt.SendContext(context.Background(), request)
+}
+
+// SendContext is like Send but aborts when ctx is done.
+//
+// The response must start within Timeout and ends as soon as a complete
+// frame was received, a silence of InterCharacterTimeout after the first
+// byte ends it early. Input left by a failed exchange is drained before the
+// request is written.
+func (dlt *rtuSerialTransporter) SendContext(ctx context.Context, request []byte) (response []byte, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	// the bus is shared by all meters on it, one exchange at a time
+	dlt.serialPort.mu.Lock()
+	defer dlt.serialPort.mu.Unlock()
+
 	// make sure port is connected
 	if err = dlt.serialPort.connect(); err != nil {
 		return
 	}
+	defer func() {
+		if err != nil {
+			// a late answer may follow
+			dlt.serialPort.dirty = true
+		}
+		if err != nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+	}()
 
 	dlt.serialPort.lastActivity = time.Now()
 	dlt.serialPort.startCloseTimer()
 
+	if err = dlt.serialPort.drain(ctx); err != nil {
+		return
+	}
 	raw := append([]byte{0xfe, 0xfe, 0xfe, 0xfe}, request...)
 
 	// Send the request
 	dlt.serialPort.logf("dlt: sending % x\n", raw)
-	if _, err = dlt.port.Write(raw); err != nil {
+	if err = dlt.serialPort.write(ctx, raw); err != nil {
 		return
 	}
 	// controlCode
@@ -224,32 +294,7 @@ func (dlt *rtuSerialTransporter) Send(request []byte) (response []byte, err erro
 	// 1-5 bit : function code
 	// functionCode := request[8] & 0xE0 // 0001 1111
 
-	time.Sleep(dlt.calculateDelay(len(raw) + rtuMaxSize))
-
-	var n, n1 int
-	var data [rtuMaxSize]byte
-	// read frame head
-	n, err = io.ReadAtLeast(dlt.port, data[:], rtuMinSize)
-	if err != nil {
-		return
-	}
-	dataDomainLen := int(data[9])
-	bytesToRead := rtuMinSize + dataDomainLen + 2
-	// read remaining data
-	if n < bytesToRead {
-		if bytesToRead <= rtuMaxSize {
-			if bytesToRead > n {
-				n1, err = io.ReadFull(dlt.port, data[n:bytesToRead])
-				n += n1
-			}
-		}
-	}
-	if err != nil {
-		return
-	}
-
-	response, err = dlt.ProcessPacket(data[:bytesToRead])
-	if err != nil {
+	if response, err = readFrame(dlt.serialPort.reader(ctx)); err != nil {
 		return
 	}
 
@@ -258,6 +303,19 @@ func (dlt *rtuSerialTransporter) Send(request []byte) (response []byte, err erro
 }
 
 func (dlt *rtuSerialTransporter) SendNotResponse(request []byte) (err error) {
+	return dlt.SendNotResponseContext(context.Background(), request)
+}
+
+// SendNotResponseContext is like SendNotResponse but does not write once
+// ctx is done.
+func (dlt *rtuSerialTransporter) SendNotResponseContext(ctx context.Context, request []byte) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	// the bus is shared by all meters on it, one exchange at a time
+	dlt.serialPort.mu.Lock()
+	defer dlt.serialPort.mu.Unlock()
+
 	// make sure port is connected
 	if err = dlt.serialPort.connect(); err != nil {
 		return
@@ -266,11 +324,16 @@ func (dlt *rtuSerialTransporter) SendNotResponse(request []byte) (err error) {
 	dlt.serialPort.lastActivity = time.Now()
 	dlt.serialPort.startCloseTimer()
 
+	if err = dlt.serialPort.drain(ctx); err != nil {
+		return
+	}
 	raw := append([]byte{0xfe, 0xfe, 0xfe, 0xfe}, request...)
 
 	// Send the request
 	dlt.serialPort.logf("dlt: sending % x\n", raw)
-	if _, err = dlt.port.Write(raw); err != nil {
+	// an answer nobody waits for may follow
+	dlt.serialPort.dirty = true
+	if err = dlt.serialPort.write(ctx, raw); err != nil {
 		return
 	}
 	// controlCode
@@ -287,38 +350,10 @@ func (dlt *rtuSerialTransporter) SendNotResponse(request []byte) (err error) {
 	return
 }
 
+// ProcessPacket returns the first valid frame in data.
 func (dlt *rtuSerialTransporter) ProcessPacket(data []byte) (result []byte, err error) {
-	var frameStart int = -1
-	var frameEnd int = -1
-
-	for i, b := range data {
-		if b == FrameHead && frameStart == -1 {
-			frameStart = i
-			continue
-		}
-
-		if b == FrameTail && frameStart != -1 {
-			frameEnd = i
-			break
-		}
-	}
-	if frameStart == -1 || frameEnd == -1 {
-		err = fmt.Errorf("dlt645: is not valid frame")
-		return
+	if result, err = newFrameScanner(bytes.NewReader(data)).next(); err == io.EOF {
+		err = fmt.Errorf("%w: no frame in % x", ErrMalformedFrame, data)
 	}
-	result = data[frameStart : frameEnd+1]
 	return
 }
-
-func (dlt *rtuSerialTransporter) calculateDelay(chars int) time.Duration {
-	var characterDelay, frameDelay int // us
-
-	if dlt.BaudRate <= 0 || dlt.BaudRate > 19200 {
-		characterDelay = 750
-		frameDelay = 1750
-	} else {
-		characterDelay = 15000000 / dlt.BaudRate
-		frameDelay = 35000000 / dlt.BaudRate
-	}
-	return time.Duration(characterDelay*chars+frameDelay) * time.Microsecond
-}
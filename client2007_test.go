@@ -0,0 +1,176 @@
+package dlt645
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var errRecorded = errors.New("recorded")
+
+// recordingTransporter records the requests and answers none.
+type recordingTransporter struct {
+	requests [][]byte
+}
+
+func (r *recordingTransporter) Send(request []byte) (response []byte, err error) {
+	r.requests = append(r.requests, request)
+	err = errRecorded
+	return
+}
+
+func (r *recordingTransporter) SendNotResponse(request []byte) (err error) {
+	r.requests = append(r.requests, request)
+	return
+}
+
+// request returns the only request recorded, as hex.
+func (r *recordingTransporter) request(t *testing.T) string {
+	t.Helper()
+	if len(r.requests) != 1 {
+		t.Fatalf("%d requests sent, want 1", len(r.requests))
+	}
+	return hex.EncodeToString(r.requests[0])
+}
+
+func unspaced(s string) string {
+	return strings.ReplaceAll(s, " ", "")
+}
+
+// The data domains follow DL/T 645-2007 with every field low byte first, the
+// password field PA P0 P1 P2 starts with the permission.
+func TestClientRequestFrames(t *testing.T) {
+	const meter = 304257140001
+	validUntil := time.Date(2024, 5, 6, 7, 8, 9, 0, time.Local)
+	tests := []struct {
+		name string
+		addr uint64
+		send func(c Client) error
+		want string
+	}{
+		{"read data", meter, func(c Client) (err error) {
+			_, err = c.ReadData(0x00010000, 0, 0, 0, 0, 0, 0)
+			return
+		}, "68 01 00 14 57 42 30 68 11 04 33 33 34 33 90 16"},
+		{"read load profile block", meter, func(c Client) (err error) {
+			_, err = c.ReadData(0x06000001, 1, 24, 5, 6, 7, 8)
+			return
+		}, "68 01 00 14 57 42 30 68 11 0a 34 33 33 39 34 3b 3a 39 38 57 0d 16"},
+		{"write data", meter, func(c Client) (err error) {
+			_, err = c.WriteData(0x04000103, 2, 0x123456, 0x11223344, []byte{0x15})
+			return
+		}, "68 01 00 14 57 42 30 68 14 0d 36 34 33 37 35 89 67 45 77 66 55 44 48 cb 16"},
+		{"read communication address", WildcardAddressDomain, func(c Client) (err error) {
+			_, err = c.ReadCommunicationAddress()
+			return
+		}, "68 aa aa aa aa aa aa 68 13 00 df 16"},
+		{"write communication address", WildcardAddressDomain, func(c Client) (err error) {
+			_, err = c.WriteCommunicationAddress(304257140002)
+			return
+		}, "68 aa aa aa aa aa aa 68 15 06 35 33 47 8a 75 63 f8 16"},
+		{"broadcast timing", BroadcastAddressDomain, func(c Client) (err error) {
+			return c.BroadcastTiming(24, 5, 6, 7, 8, 9)
+		}, "68 99 99 99 99 99 99 68 08 06 3c 3b 3a 39 38 57 ed 16"},
+		{"freeze", meter, func(c Client) (err error) {
+			_, err = c.FreezeCommand(99, 1, 0, 0)
+			return
+		}, "68 01 00 14 57 42 30 68 16 04 33 33 34 cc 2e 16"},
+		{"change communication rate", meter, func(c Client) (err error) {
+			_, err = c.ChangeCommunicationRate(CommunicationRate9600)
+			return
+		}, "68 01 00 14 57 42 30 68 17 01 53 19 16"},
+		{"change password", meter, func(c Client) (err error) {
+			_, err = c.ChangePassword(0x04000C03, 2, 0x123456, 4, 0x654321)
+			return
+		}, "68 01 00 14 57 42 30 68 18 0c 36 3f 33 37 35 89 67 45 37 54 76 98 b4 16"},
+		{"clear maximum demand", meter, func(c Client) (err error) {
+			_, err = c.ClearMaximumDemand(2, 0x123456, 0x11223344)
+			return
+		}, "68 01 00 14 57 42 30 68 19 08 35 89 67 45 77 66 55 44 af 16"},
+		{"clear ammeter", meter, func(c Client) (err error) {
+			_, err = c.ClearAmmeter(2, 0x123456, 0x11223344)
+			return
+		}, "68 01 00 14 57 42 30 68 1a 08 35 89 67 45 77 66 55 44 b0 16"},
+		{"clear event", meter, func(c Client) (err error) {
+			_, err = c.ClearEvent(0xFFFFFFFF, 2, 0x123456, 0x11223344)
+			return
+		}, "68 01 00 14 57 42 30 68 1b 0c 35 89 67 45 77 66 55 44 32 32 32 32 7d 16"},
+		{"relay control", meter, func(c Client) (err error) {
+			_, err = c.(RelayClient).RelayControl(RelayTrip, validUntil, 2, 0x123456, 0x11223344)
+			return
+		}, "68 01 00 14 57 42 30 68 1c 10 35 89 67 45 77 66 55 44 4d 33 3c 3b 3a 39 38 57 b3 16"},
+		{"multi-function output", meter, func(c Client) (err error) {
+			_, err = c.(RelayClient).MultiFunctionOutput(TerminalOutputTariffSwitch)
+			return
+		}, "68 01 00 14 57 42 30 68 1d 01 35 01 16"},
+		{"security authentication", meter, func(c Client) (err error) {
+			_, err = c.(SecurityClient).SecurityAuthentication(0x070000FF, 0x11223344, []byte{0x01, 0x02})
+			return
+		}, "68 01 00 14 57 42 30 68 03 0a 32 33 33 3a 77 66 55 44 34 35 6c 16"},
+		{"secure relay control", meter, func(c Client) (err error) {
+			_, err = c.(SecurityClient).SecureRelayControl(0x11223344, []byte{0xC1, 0xC2})
+			return
+		}, "68 01 00 14 57 42 30 68 1c 0a cb 33 33 33 77 66 55 44 f4 f5 97 16"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transporter := &recordingTransporter{}
+			if err := test.send(NewMeterClient(transporter, test.addr)); err != nil && err != errRecorded {
+				t.Fatal(err)
+			}
+			if got, want := transporter.request(t), unspaced(test.want); got != want {
+				t.Fatalf("request %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeFrame(t *testing.T) {
+	addr := addressToDataDomain(304257140001)
+	payload, err := decodeFrame(encodeFrame(addr, 0xB1, []byte{0x00, 0x00, 0x00, 0x00, 0x12}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.FunctionCode != FunctionCodeReadData || !payload.HasFollowUpData || hex.EncodeToString(payload.Data) != "0000000012" {
+		t.Fatalf("payload %+v", payload)
+	}
+
+	_, err = decodeFrame(encodeFrame(addr, 0xD4, []byte{ExceptionCodeIllegalPassword}))
+	var dltError *DltError
+	if !errors.As(err, &dltError) || dltError.FunctionCode != FunctionCodeWriteData || !strings.Contains(err.Error(), "Incorrect password or no permission") {
+		t.Fatalf("exception answer error %v", err)
+	}
+
+	_, err = decodeFrame(encodeFrame(addr, 0xC3, []byte{0x08, 0x00}))
+	if !errors.Is(err, &SecurityError{Code: SecurityErrorAuthentication}) {
+		t.Fatalf("security exception answer error %v", err)
+	}
+}
+
+func TestVerifyFrameWildcard(t *testing.T) {
+	response := encodeFrame(addressToDataDomain(304257140001), 0x93, addressToDataDomain(304257140001))
+	tests := []struct {
+		addr uint64
+		want error
+	}{
+		{304257140001, nil},
+		{WildcardAddressDomain, nil},
+		{0xAAAAAAAA0001, nil},
+		{0xAAAAAAAAAA01, nil},
+		{304257140002, ErrAddressMismatch},
+		{0xAAAAAAAA0002, ErrAddressMismatch},
+	}
+	for _, test := range tests {
+		request := encodeFrame(addressToDataDomain(test.addr), FunctionCodeReadCommunicationAddress, nil)
+		if err := verifyFrame(request, response); !errors.Is(err, test.want) || (err == nil) != (test.want == nil) {
+			t.Errorf("request to %x: error %v, want %v", test.addr, err, test.want)
+		}
+	}
+
+	request := encodeFrame(addressToDataDomain(WildcardAddressDomain), FunctionCodeReadData, nil)
+	if err := verifyFrame(request, response); !errors.Is(err, ErrUnexpectedFunctionCode) {
+		t.Errorf("answer to another command: error %v, want ErrUnexpectedFunctionCode", err)
+	}
+}
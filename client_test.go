@@ -0,0 +1,236 @@
+package dlt645
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClientContextCancelled(t *testing.T) {
+	transporter := &recordingTransporter{}
+	c := NewMeterClient(transporter, 304257140001).(ContextClient)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		send func() error
+	}{
+		{"read data", func() (err error) { _, err = c.ReadDataContext(ctx, 0x00000000, 0, 0, 0, 0, 0, 0); return }},
+		{"write data", func() (err error) { _, err = c.WriteDataContext(ctx, 0x04000103, 2, 0, 0, []byte{0x15}); return }},
+		{"read communication address", func() (err error) { _, err = c.ReadCommunicationAddressContext(ctx); return }},
+		{"write communication address", func() (err error) { _, err = c.WriteCommunicationAddressContext(ctx, 304257140002); return }},
+		{"broadcast timing", func() error { return c.BroadcastTimingContext(ctx, 24, 5, 6, 7, 8, 9) }},
+		{"freeze", func() (err error) { _, err = c.FreezeCommandContext(ctx, 99, 1, 0, 0); return }},
+		{"change communication rate", func() (err error) { _, err = c.ChangeCommunicationRateContext(ctx, CommunicationRate9600); return }},
+		{"change password", func() (err error) { _, err = c.ChangePasswordContext(ctx, 0x04000C03, 2, 0, 4, 0); return }},
+		{"clear maximum demand", func() (err error) { _, err = c.ClearMaximumDemandContext(ctx, 2, 0, 0); return }},
+		{"clear ammeter", func() (err error) { _, err = c.ClearAmmeterContext(ctx, 2, 0, 0); return }},
+		{"clear event", func() (err error) { _, err = c.ClearEventContext(ctx, 0xFFFFFFFF, 2, 0, 0); return }},
+	}
+	for _, test := range tests {
+		if err := test.send(); err != context.Canceled {
+			t.Errorf("%s: error %v, want context.Canceled", test.name, err)
+		}
+	}
+	if len(transporter.requests) > 0 {
+		t.Errorf("%d requests sent with a cancelled context", len(transporter.requests))
+	}
+}
+
+func TestMeterClientFrames(t *testing.T) {
+	tests := []struct {
+		name        string
+		client      func(transporter Transporter) Client
+		dataMarker  uint32
+		controlCode byte
+	}{
+		{"2007", func(transporter Transporter) Client { return NewMeterClient(transporter, 304257140002) }, 0x00010000, 0x11},
+		{"1997", func(transporter Transporter) Client { return NewMeter1997Client(transporter, 304257140002) }, 0x9010, 0x01},
+	}
+	for _, test := range tests {
+		transporter := &recordingTransporter{}
+		test.client(transporter).ReadData(test.dataMarker, 0, 0, 0, 0, 0, 0)
+		request := transporter.request(t)
+		if address := request[2:14]; address != "020014574230" {
+			t.Errorf("%s: address %s, want 02 00 14 57 42 30", test.name, address)
+		}
+		if controlCode := request[16:18]; controlCode != hex.EncodeToString([]byte{test.controlCode}) {
+			t.Errorf("%s: control code %s, want %02x", test.name, controlCode, test.controlCode)
+		}
+	}
+}
+
+func TestMeterClientsShareBus(t *testing.T) {
+	addrs := []uint64{304257140001, 304257140002}
+	var servers []*Server
+	for i, addr := range addrs {
+		store := NewMemoryStore()
+		store.Write(0x00010000, []byte{byte(i + 1), 0x00, 0x00, 0x00})
+		servers = append(servers, NewServer(addr, store))
+	}
+	handler := newSimulatedSerialHandler(t, servers...)
+
+	// every meter is polled from its own goroutine
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*len(addrs))
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func(meter Client, want []byte) {
+			defer wg.Done()
+			for n := 0; n < 2; n++ {
+				results, err := meter.ReadData(0x00010000, 0, 0, 0, 0, 0, 0)
+				if err == nil && !bytes.Equal(results, want) {
+					err = fmt.Errorf("results % x, want % x", results, want)
+				}
+				if err != nil {
+					errs <- err
+				}
+			}
+		}(handler.Meter(addr), []byte{byte(i + 1), 0x00, 0x00, 0x00})
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// newScriptedSerialHandler returns a handler whose line answers every
+// request with the next of answers.
+func newScriptedSerialHandler(answers ...[]byte) *Client2007Handler {
+	port := &testSerialPort{timeout: 5 * time.Millisecond}
+	port.line = lineFunc(func(b []byte) {
+		if len(answers) > 0 {
+			port.inject(answers[0])
+			answers = answers[1:]
+		}
+	})
+	return newTestSerialHandler(port)
+}
+
+func TestReadDataChecksDataMarker(t *testing.T) {
+	addr := addressToDataDomain(304257140001)
+	handler := newScriptedSerialHandler(
+		encodeFrame(addr, 0x91, []byte{0x00, 0x00, 0x01, 0x00, 0x22, 0x22, 0x22, 0x00}),
+		encodeFrame(addr, 0x91, []byte{0x00, 0x00, 0x00, 0x00, 0x11, 0x11, 0x11, 0x00}),
+	)
+	client := handler.Meter(304257140001)
+
+	if _, err := client.ReadData(0x00000000, 0, 0, 0, 0, 0, 0); !errors.Is(err, ErrMalformedFrame) {
+		t.Fatalf("answer to another identifier: error %v, want ErrMalformedFrame", err)
+	}
+	results, err := client.ReadData(0x00000000, 0, 0, 0, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x11, 0x11, 0x11, 0x00}; !bytes.Equal(results, want) {
+		t.Fatalf("results % x, want % x", results, want)
+	}
+}
+
+func TestReadDataFollowUp(t *testing.T) {
+	value := make([]byte, 500)
+	for k := range value {
+		value[k] = byte(k)
+	}
+	store := NewMemoryStore()
+	store.Write(0x0601FF00, value)
+	handler := newSimulatedSerialHandler(t, NewServer(304257140001, store))
+
+	results, err := handler.Meter(304257140001).ReadData(0x0601FF00, 0, 0, 0, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(results, value) {
+		t.Fatalf("results % x, want % x", results, value)
+	}
+}
+
+func TestReadData1997ChecksDataMarker(t *testing.T) {
+	addr := addressToDataDomain(304257140001)
+	handler := newScriptedSerialHandler(
+		encodeFrame(addr, 0x81, []byte{0x20, 0x90, 0x12, 0x34, 0x56, 0x00}),
+		encodeFrame(addr, 0x81, []byte{0x10, 0x90, 0x12, 0x34, 0x56, 0x00}),
+	)
+	client := NewMeter1997Client(handler, 304257140001)
+
+	if _, err := client.ReadData(0x9010, 0, 0, 0, 0, 0, 0); !errors.Is(err, ErrMalformedFrame) {
+		t.Fatalf("answer to another identifier: error %v, want ErrMalformedFrame", err)
+	}
+	results, err := client.ReadData(0x9010, 0, 0, 0, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x12, 0x34, 0x56, 0x00}; !bytes.Equal(results, want) {
+		t.Fatalf("results % x, want % x", results, want)
+	}
+}
+
+func TestReadData1997FollowUpLimit(t *testing.T) {
+	addr := addressToDataDomain(304257140001)
+	answers := [][]byte{encodeFrame(addr, 0xA1, []byte{0x10, 0x90, 0x00})}
+	for k := 1; k <= 255; k++ {
+		answers = append(answers, encodeFrame(addr, 0xA2, []byte{0x10, 0x90, byte(k)}))
+	}
+	client := NewMeter1997Client(newScriptedSerialHandler(answers...), 304257140001)
+
+	if _, err := client.ReadData(0x9010, 0, 0, 0, 0, 0, 0); !errors.Is(err, ErrMalformedFrame) {
+		t.Fatalf("endless follow-up data: error %v, want ErrMalformedFrame", err)
+	}
+}
+
+func TestClientInterfaces(t *testing.T) {
+	transporter := &recordingTransporter{}
+	for name, c := range map[string]Client{
+		"DL/T 645-2007": NewMeterClient(transporter, 304257140001),
+		"DL/T 645-1997": NewMeter1997Client(transporter, 304257140001),
+		"retry":         NewRetryClient(NewMeterClient(transporter, 304257140001), DefaultRetryPolicy()),
+	} {
+		if _, ok := c.(ContextClient); !ok {
+			t.Errorf("%s client is no ContextClient", name)
+		}
+		if _, ok := c.(RelayClient); !ok {
+			t.Errorf("%s client is no RelayClient", name)
+		}
+		if _, ok := c.(SecurityClient); !ok {
+			t.Errorf("%s client is no SecurityClient", name)
+		}
+	}
+}
+
+// A Client implemented outside the package has only the basic commands.
+func TestPlainClient(t *testing.T) {
+	store := NewMemoryStore()
+	store.Write(0x00000000, []byte{0x56, 0x34, 0x12, 0x00})
+	handler := newSimulatedSerialHandler(t, NewServer(304257140001, store))
+	c := struct{ Client }{handler.Meter(304257140001)}
+
+	device := NewDevice(c)
+	if data, err := device.ReadRaw(0x00000000); err != nil || !bytes.Equal(data, []byte{0x56, 0x34, 0x12, 0x00}) {
+		t.Errorf("data % x, error %v", data, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := device.WithContext(ctx).ReadRaw(0x00000000); err != context.Canceled {
+		t.Errorf("cancelled read: error %v, want context.Canceled", err)
+	}
+	if _, err := NewRetryClient(c, DefaultRetryPolicy()).ReadData(0x00000000, 0, 0, 0, 0, 0, 0); err != nil {
+		t.Errorf("retried read: %v", err)
+	}
+
+	if _, err := device.ControlRelay(RelayTrip, time.Now(), 2, 0, 0); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("relay control: error %v, want ErrNotSupported", err)
+	}
+	if _, err := NewRetryClient(c, DefaultRetryPolicy()).(RelayClient).MultiFunctionOutput(TerminalOutputClockPulse); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("multi-function output: error %v, want ErrNotSupported", err)
+	}
+	if err := NewSecuritySession(c, nil, 304257140001).Authenticate(context.Background()); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("security authentication: error %v, want ErrNotSupported", err)
+	}
+}
@@ -0,0 +1,201 @@
+package dlt645
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	clockDateMarker = 0x04000101 // YYMMDDWW
+	clockTimeMarker = 0x04000102 // hhmmss
+
+	// meters only follow a broadcast timing moving their clock by no more
+	maxBroadcastDrift  = 5 * time.Minute
+	clockSyncThreshold = 5 * time.Second
+)
+
+// ReadClock reads the date and time of the meter clock.
+func (d *Device) ReadClock() (clock time.Time, err error) {
+	date, err := d.ReadRaw(clockDateMarker)
+	if err != nil {
+		return
+	}
+	clockTime, err := d.ReadRaw(clockTimeMarker)
+	if err != nil {
+		return
+	}
+	// the date may have been read just before midnight
+	if len(clockTime) == 3 && clockTime[2] == 0 && clockTime[1] == 0 {
+		if date, err = d.ReadRaw(clockDateMarker); err != nil {
+			return
+		}
+	}
+	if len(date) != 4 || len(clockTime) != 3 {
+		err = fmt.Errorf("dlt645: clock data length '%v' and '%v' does not match expected '4' and '3'", len(date), len(clockTime))
+		return
+	}
+	// WW DD MM YY and ss mm hh, low byte first
+	if clock, err = decodeBCDTime("YYMMDDhhmmss", append(append([]byte(nil), clockTime...), date[1:]...)); err != nil {
+		return
+	}
+	if clock.IsZero() {
+		err = fmt.Errorf("dlt645: meter clock is not set")
+	}
+	return
+}
+
+// WriteClock sets the meter clock to t, which needs the permission of a
+// parameter write.
+func (d *Device) WriteClock(t time.Time, passwordPermission uint8, password uint32, operatorCode uint32) (err error) {
+	t = t.Local()
+	date := bcdArrayToDataDomain(uint8(t.Weekday()), uint8(t.Day()), uint8(t.Month()), uint8(t.Year()%100))
+	if _, err = contextClient(d.Client).WriteDataContext(d.Context(), clockDateMarker, passwordPermission, password, operatorCode, date); err != nil {
+		return
+	}
+	clockTime := bcdArrayToDataDomain(uint8(t.Second()), uint8(t.Minute()), uint8(t.Hour()))
+	_, err = contextClient(d.Client).WriteDataContext(d.Context(), clockTimeMarker, passwordPermission, password, operatorCode, clockTime)
+	return
+}
+
+// BroadcastTime sends a broadcast timing to all meters on the bus of
+// transporter. Meters only follow it when their clock is off by no more
+// than 5 minutes.
+func BroadcastTime(ctx context.Context, transporter Transporter, t time.Time) error {
+	t = t.Local()
+	client := NewMeterClient(transporter, BroadcastAddressDomain)
+	return contextClient(client).BroadcastTimingContext(ctx, uint8(t.Year()%100), uint8(t.Month()), uint8(t.Day()), uint8(t.Hour()), uint8(t.Minute()), uint8(t.Second()))
+}
+
+// ClockStatus is the clock of one meter found by ClockSync.
+type ClockStatus struct {
+	Address uint64
+	// Clock is the meter clock when read, Drift how far it is ahead
+	Clock time.Time
+	Drift time.Duration
+	// NeedsWrite means the drift exceeds the threshold but can't be
+	// corrected by broadcast timing, Written that it was written directly
+	NeedsWrite bool
+	Written    bool
+	Err        error
+}
+
+// ClockSync corrects the clocks of the meters on one bus.
+//
+// Meters drifting more than Threshold are corrected by a single broadcast
+// timing, which the standard limits to corrections of up to 5 minutes that
+// do not move the clock across midnight, not to disturb the daily freeze.
+// The other meters are reported with NeedsWrite and, if Write is set,
+// written directly with the credentials of ClockSync.
+type ClockSync struct {
+	Transporter Transporter
+	// Meter returns the client for an address, e.g. the Meter method of
+	// a handler, nil means NewMeterClient on Transporter
+	Meter func(addr uint64) Client
+	// Threshold is the drift tolerated, zero means 5 seconds
+	Threshold time.Duration
+
+	Write              bool
+	PasswordPermission uint8
+	Password           uint32
+	OperatorCode       uint32
+}
+
+// Sync reads the clocks of the meters at addrs and corrects them. err is
+// only set if the broadcast fails, the errors of single meters are
+// reported in their status.
+func (s *ClockSync) Sync(ctx context.Context, addrs []uint64) (statuses []*ClockStatus, err error) {
+	threshold := s.Threshold
+	if threshold <= 0 {
+		threshold = clockSyncThreshold
+	}
+
+	// meters to correct by broadcast and when their clock was read
+	type candidate struct {
+		status    *ClockStatus
+		reference time.Time
+	}
+	var candidates []candidate
+	for _, addr := range addrs {
+		status := &ClockStatus{Address: addr}
+		statuses = append(statuses, status)
+
+		device := NewDevice(s.meter(addr)).WithContext(ctx)
+		start := time.Now()
+		if status.Clock, status.Err = device.ReadClock(); status.Err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+				return
+			}
+			continue
+		}
+		// the clock was read somewhere in between, it counts whole seconds
+		reference := start.Add(time.Since(start) / 2).Truncate(time.Second)
+		status.Drift = status.Clock.Sub(reference)
+		if status.Drift.Abs() <= threshold {
+			continue
+		}
+		if canBroadcastTime(status.Clock, reference) {
+			candidates = append(candidates, candidate{status, reference})
+		} else {
+			status.NeedsWrite = true
+		}
+	}
+
+	// reading the other meters took time, the clocks may have moved past
+	// midnight since
+	now := time.Now()
+	broadcast := false
+	for _, c := range candidates {
+		if broadcastable(c.status.Clock, c.reference, now) {
+			broadcast = true
+		} else {
+			c.status.NeedsWrite = true
+		}
+	}
+	if broadcast {
+		if err = BroadcastTime(ctx, s.Transporter, now); err != nil {
+			return
+		}
+	}
+	if !s.Write {
+		return
+	}
+	for _, status := range statuses {
+		if !status.NeedsWrite {
+			continue
+		}
+		device := NewDevice(s.meter(status.Address)).WithContext(ctx)
+		if status.Err = device.WriteClock(time.Now(), s.PasswordPermission, s.Password, s.OperatorCode); status.Err == nil {
+			status.Written = true
+		} else if ctx.Err() != nil {
+			err = ctx.Err()
+			return
+		}
+	}
+	return
+}
+
+func (s *ClockSync) meter(addr uint64) Client {
+	if s.Meter != nil {
+		return s.Meter(addr)
+	}
+	return NewMeterClient(s.Transporter, addr)
+}
+
+// broadcastable reports whether a broadcast timing of now corrects the clock
+// read at reference, the meter clock went on since.
+func broadcastable(clock, reference, now time.Time) bool {
+	return canBroadcastTime(clock.Add(now.Sub(reference)), now)
+}
+
+// canBroadcastTime reports whether broadcast timing moves clock to t: by
+// no more than 5 minutes and without crossing midnight.
+func canBroadcastTime(clock, t time.Time) bool {
+	if clock.Sub(t).Abs() > maxBroadcastDrift {
+		return false
+	}
+	y1, m1, d1 := clock.Date()
+	y2, m2, d2 := t.Local().Date()
+	return y1 == y2 && m1 == m2 && d1 == d2
+}
@@ -0,0 +1,138 @@
+package dlt645
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// meterClock returns the date and time registers of a meter clock at t.
+func meterClock(t time.Time) (date, clockTime []byte) {
+	date = bcdArrayToDataDomain(uint8(t.Weekday()), uint8(t.Day()), uint8(t.Month()), uint8(t.Year()%100))
+	clockTime = bcdArrayToDataDomain(uint8(t.Second()), uint8(t.Minute()), uint8(t.Hour()))
+	return
+}
+
+func TestBroadcastable(t *testing.T) {
+	at := func(day, hour, minute, second int) time.Time {
+		return time.Date(2024, 5, day, hour, minute, second, 0, time.Local)
+	}
+	tests := []struct {
+		name                  string
+		clock, reference, now time.Time
+		want                  bool
+	}{
+		{"ahead", at(6, 12, 2, 0), at(6, 12, 0, 0), at(6, 12, 0, 30), true},
+		{"behind", at(6, 11, 58, 0), at(6, 12, 0, 0), at(6, 12, 0, 30), true},
+		{"more than 5 minutes", at(6, 12, 6, 0), at(6, 12, 0, 0), at(6, 12, 0, 0), false},
+		{"ahead before midnight", at(6, 23, 59, 30), at(6, 23, 57, 0), at(6, 23, 57, 10), true},
+		// the clock passed midnight while the other meters were read
+		{"ahead past midnight since", at(6, 23, 59, 30), at(6, 23, 57, 0), at(6, 23, 58, 0), false},
+		{"behind, midnight passed since", at(6, 23, 57, 0), at(6, 23, 59, 0), at(7, 0, 0, 30), false},
+		{"behind after midnight", at(7, 0, 0, 0), at(7, 0, 2, 0), at(7, 0, 2, 30), true},
+	}
+	for _, test := range tests {
+		if got := broadcastable(test.clock, test.reference, test.now); got != test.want {
+			t.Errorf("%s: broadcastable(%v, %v, %v) = %v, want %v", test.name, test.clock, test.reference, test.now, got, test.want)
+		}
+	}
+}
+
+func TestCanBroadcastTime(t *testing.T) {
+	at := func(day, hour, minute, second int) time.Time {
+		return time.Date(2024, 5, day, hour, minute, second, 0, time.Local)
+	}
+	tests := []struct {
+		name     string
+		clock, t time.Time
+		want     bool
+	}{
+		{"ahead", at(6, 12, 2, 0), at(6, 12, 0, 0), true},
+		{"behind", at(6, 11, 58, 0), at(6, 12, 0, 0), true},
+		{"5 minutes", at(6, 12, 5, 0), at(6, 12, 0, 0), true},
+		{"more than 5 minutes", at(6, 12, 6, 0), at(6, 12, 0, 0), false},
+		{"ahead past midnight", at(7, 0, 1, 0), at(6, 23, 59, 0), false},
+		{"behind past midnight", at(6, 23, 59, 0), at(7, 0, 1, 0), false},
+	}
+	for _, test := range tests {
+		if got := canBroadcastTime(test.clock, test.t); got != test.want {
+			t.Errorf("%s: canBroadcastTime(%v, %v) = %v, want %v", test.name, test.clock, test.t, got, test.want)
+		}
+	}
+}
+
+func TestClockSyncSimulator(t *testing.T) {
+	now := time.Now()
+	// keep the drifting clock on the same day
+	drift := 2 * time.Minute
+	if now.Hour() >= 12 {
+		drift = -drift
+	}
+	clocks := map[uint64]time.Time{
+		304257140001: now,
+		304257140002: now.Add(drift),
+		304257140003: now.Add(12 * time.Hour),
+	}
+	var servers []*Server
+	broadcasts := make(chan time.Time, len(clocks))
+	for addr, clock := range clocks {
+		store := NewMemoryStore()
+		date, clockTime := meterClock(clock)
+		store.Write(clockDateMarker, date)
+		store.Write(clockTimeMarker, clockTime)
+		server := NewServer(addr, store)
+		server.OnBroadcastTiming = func(t time.Time) { broadcasts <- t }
+		servers = append(servers, server)
+	}
+	handler := newSimulatedSerialHandler(t, servers...)
+
+	sync := &ClockSync{Transporter: handler, Meter: handler.Meter, Write: true, PasswordPermission: 2}
+	statuses, err := sync.Sync(context.Background(), []uint64{304257140001, 304257140002, 304257140003, 304257140004})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 4 {
+		t.Fatalf("%d statuses, want 4", len(statuses))
+	}
+	want := []struct {
+		drift      time.Duration
+		needsWrite bool
+	}{
+		{0, false},
+		{drift, false},
+		{12 * time.Hour, true},
+	}
+	for i, w := range want {
+		status := statuses[i]
+		if status.Err != nil {
+			t.Errorf("meter %d: %v", status.Address, status.Err)
+			continue
+		}
+		if (status.Drift-w.drift).Abs() > 2*time.Second || status.NeedsWrite != w.needsWrite || status.Written != w.needsWrite {
+			t.Errorf("meter %d: drift %v needs write %v written %v, want drift %v needs write %v", status.Address, status.Drift, status.NeedsWrite, status.Written, w.drift, w.needsWrite)
+		}
+	}
+	if statuses[3].Err == nil {
+		t.Error("missing meter: no error")
+	}
+
+	for range servers {
+		select {
+		case b := <-broadcasts:
+			if b.Sub(time.Now()).Abs() > 2*time.Second {
+				t.Errorf("broadcast time %v, want about %v", b, time.Now())
+			}
+		case <-time.After(time.Second):
+			t.Fatal("broadcast timing not received")
+		}
+	}
+
+	device := NewDevice(handler.Meter(304257140003))
+	clock, err := device.ReadClock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clock.Sub(time.Now()).Abs() > 2*time.Second {
+		t.Errorf("written clock %v, want about %v", clock, time.Now())
+	}
+}
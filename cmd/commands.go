@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	dlt "github.com/xgbt/dlt645-go"
+)
+
+// communicationRates maps baud rates to the rate words of the change
+// communication rate command.
+var communicationRates = map[int]uint8{
+	600:   dlt.CommunicationRate600,
+	1200:  dlt.CommunicationRate1200,
+	2400:  dlt.CommunicationRate2400,
+	4800:  dlt.CommunicationRate4800,
+	9600:  dlt.CommunicationRate9600,
+	19200: dlt.CommunicationRate19200,
+}
+
+func runRead(o *options, args []string) (err error) {
+	if len(args) == 0 {
+		return fmt.Errorf("read: missing data identifier")
+	}
+	if o.block > 255 {
+		return fmt.Errorf("read: block count %d must not exceed 255", o.block)
+	}
+	var markers []uint32
+	for _, arg := range args {
+		var marker uint32
+		if marker, err = parseDataMarker(arg, o.protocol); err != nil {
+			return
+		}
+		markers = append(markers, marker)
+	}
+	client, h, err := o.meter()
+	if err != nil {
+		return
+	}
+	defer h.Close()
+
+	for _, marker := range markers {
+		var data []byte
+		if data, err = client.ReadData(marker, uint8(o.block), 0, 0, 0, 0, 0); err != nil {
+			return fmt.Errorf("read %08X: %w", marker, err)
+		}
+		if err = printData(o, marker, data); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func runWrite(o *options, args []string) (err error) {
+	if len(args) != 2 {
+		return fmt.Errorf("write: want DI and HEXDATA")
+	}
+	marker, err := parseDataMarker(args[0], o.protocol)
+	if err != nil {
+		return
+	}
+	data, err := hex.DecodeString(args[1])
+	if err != nil {
+		return fmt.Errorf("write: invalid hex data %q", args[1])
+	}
+	// transmitted low byte first
+	dlt.Reverse(data)
+	permission, password, operator, err := o.credentials()
+	if err != nil {
+		return
+	}
+	client, h, err := o.meter()
+	if err != nil {
+		return
+	}
+	defer h.Close()
+
+	if _, err = client.WriteData(marker, permission, password, operator, data); err != nil {
+		return
+	}
+	return printOK(o, "write")
+}
+
+func runAddr(o *options, args []string) (err error) {
+	if len(args) > 1 {
+		return fmt.Errorf("addr: want at most one new address")
+	}
+	client, h, err := o.meter()
+	if err != nil {
+		return
+	}
+	defer h.Close()
+
+	if len(args) == 1 {
+		var addr uint64
+		if addr, err = parseAddress(args[0]); err != nil {
+			return
+		}
+		if _, err = client.WriteCommunicationAddress(addr); err != nil {
+			return
+		}
+		return printOK(o, "addr")
+	}
+	data, err := client.ReadCommunicationAddress()
+	if err != nil {
+		return
+	}
+	return printAddress(o, data)
+}
+
+func runSetTime(o *options, args []string) (err error) {
+	t := time.Now()
+	if o.clock != "" {
+		if t, err = time.ParseInLocation("2006-01-02 15:04:05", o.clock, time.Local); err != nil {
+			return fmt.Errorf("settime: invalid time %q", o.clock)
+		}
+	}
+	client, h, err := o.client(dlt.BroadcastAddressDomain)
+	if err != nil {
+		return
+	}
+	defer h.Close()
+
+	if err = client.BroadcastTiming(uint8(t.Year()%100), uint8(t.Month()), uint8(t.Day()), uint8(t.Hour()), uint8(t.Minute()), uint8(t.Second())); err != nil {
+		return
+	}
+	return printOK(o, "settime")
+}
+
+func runFreeze(o *options, args []string) (err error) {
+	when := "99999999"
+	if len(args) == 1 {
+		when = args[0]
+	} else if len(args) > 1 {
+		return fmt.Errorf("freeze: want at most MMDDhhmm")
+	}
+	if len(when) != 8 {
+		return fmt.Errorf("freeze: invalid time %q, want MMDDhhmm", when)
+	}
+	var fields [4]uint8
+	for i := range fields {
+		var v uint64
+		if v, err = strconv.ParseUint(when[2*i:2*i+2], 10, 8); err != nil {
+			return fmt.Errorf("freeze: invalid time %q, want MMDDhhmm", when)
+		}
+		fields[i] = uint8(v)
+	}
+	client, h, err := o.meter()
+	if err != nil {
+		return
+	}
+	defer h.Close()
+
+	if _, err = client.FreezeCommand(fields[0], fields[1], fields[2], fields[3]); err != nil {
+		return
+	}
+	return printOK(o, "freeze")
+}
+
+func runRate(o *options, args []string) (err error) {
+	if len(args) != 1 {
+		return fmt.Errorf("rate: want BAUD")
+	}
+	baud, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("rate: invalid baud rate %q", args[0])
+	}
+	word, ok := communicationRates[baud]
+	if !ok {
+		return fmt.Errorf("rate: unsupported baud rate %d", baud)
+	}
+	client, h, err := o.meter()
+	if err != nil {
+		return
+	}
+	defer h.Close()
+
+	if _, err = client.ChangeCommunicationRate(word); err != nil {
+		return
+	}
+	return printOK(o, "rate")
+}
+
+func runPasswd(o *options, args []string) (err error) {
+	if len(args) != 2 {
+		return fmt.Errorf("passwd: want LEVEL and NEWPASSWORD")
+	}
+	level, err := strconv.ParseUint(args[0], 10, 8)
+	if err != nil || level > 9 {
+		return fmt.Errorf("passwd: level %q must be between 0 and 9", args[0])
+	}
+	newPassword, err := parseHex(args[1], 6)
+	if err != nil {
+		return
+	}
+	permission, password, _, err := o.credentials()
+	if err != nil {
+		return
+	}
+	client, h, err := o.meter()
+	if err != nil {
+		return
+	}
+	defer h.Close()
+
+	// password of level n is data identifier 0x04000C01 + n
+	marker := uint32(0x04000C01) + uint32(level)
+	if _, err = client.ChangePassword(marker, permission, password, uint8(level), newPassword); err != nil {
+		return
+	}
+	return printOK(o, "passwd")
+}
+
+func runClearDemand(o *options, args []string) (err error) {
+	permission, password, operator, err := o.credentials()
+	if err != nil {
+		return
+	}
+	client, h, err := o.meter()
+	if err != nil {
+		return
+	}
+	defer h.Close()
+
+	if _, err = client.ClearMaximumDemand(permission, password, operator); err != nil {
+		return
+	}
+	return printOK(o, "clear-demand")
+}
+
+func runClearMeter(o *options, args []string) (err error) {
+	permission, password, operator, err := o.credentials()
+	if err != nil {
+		return
+	}
+	client, h, err := o.meter()
+	if err != nil {
+		return
+	}
+	defer h.Close()
+
+	if _, err = client.ClearAmmeter(permission, password, operator); err != nil {
+		return
+	}
+	return printOK(o, "clear-meter")
+}
+
+func runClearEvent(o *options, args []string) (err error) {
+	marker := uint32(0xFFFFFFFF)
+	if len(args) == 1 {
+		if marker, err = parseDataMarker(args[0], o.protocol); err != nil {
+			return
+		}
+	} else if len(args) > 1 {
+		return fmt.Errorf("clear-event: want at most one DI")
+	}
+	permission, password, operator, err := o.credentials()
+	if err != nil {
+		return
+	}
+	client, h, err := o.meter()
+	if err != nil {
+		return
+	}
+	defer h.Close()
+
+	if _, err = client.ClearEvent(marker, permission, password, operator); err != nil {
+		return
+	}
+	return printOK(o, "clear-event")
+}
+
+var relayCommands = map[string]dlt.RelayCommand{
+	"trip":           dlt.RelayTrip,
+	"allow-close":    dlt.RelayAllowClose,
+	"close":          dlt.RelayClose,
+	"alarm":          dlt.RelayAlarm,
+	"alarm-off":      dlt.RelayAlarmOff,
+	"keep-power":     dlt.RelayKeepPower,
+	"keep-power-off": dlt.RelayKeepPowerOff,
+}
+
+func runRelay(o *options, args []string) (err error) {
+	if len(args) != 1 {
+		return fmt.Errorf("relay: want one COMMAND")
+	}
+	command, ok := relayCommands[args[0]]
+	if !ok {
+		return fmt.Errorf("relay: unknown command %q", args[0])
+	}
+	permission, password, operator, err := o.credentials()
+	if err != nil {
+		return
+	}
+	client, h, err := o.meter()
+	if err != nil {
+		return
+	}
+	defer h.Close()
+
+	device := dlt.NewDevice(client)
+	if _, err = device.ControlRelay(command, time.Now().Add(o.valid), permission, password, operator); err != nil {
+		return
+	}
+	return printOK(o, "relay")
+}
+
+func runScan(o *options, args []string) (err error) {
+	h, err := o.open()
+	if err != nil {
+		return
+	}
+	defer h.Close()
+
+	addrs, err := dlt.ScanBus(context.Background(), h)
+	if printErr := printAddresses(o, addrs); printErr != nil && err == nil {
+		err = printErr
+	}
+	return
+}
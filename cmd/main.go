@@ -1,37 +1,263 @@
+// Command dlt645 talks to DL/T 645 meters over a serial port or a
+// serial-to-Ethernet converter.
+//
+// Usage:
+//
+//	dlt645 <command> [flags] [arguments]
+//
+// Run "dlt645 help" for the list of commands.
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	dlt "github.com/xgbt/dlt645-go"
 )
 
-const (
-	rtuDevice = "/dev/ttyS9"
-	Address   = 304257140001
-)
+// command is one subcommand of the tool.
+type command struct {
+	name  string
+	args  string
+	short string
+	run   func(o *options, args []string) error
+}
+
+var commands = []*command{
+	{"read", "DI...", "read data identifiers, e.g. 00000000 0201FF00", runRead},
+	{"write", "DI HEXDATA", "write a data identifier, data high byte first", runWrite},
+	{"addr", "[NEWADDR]", "read the communication address, or write NEWADDR", runAddr},
+	{"settime", "", "broadcast timing with -time or the local time", runSetTime},
+	{"freeze", "[MMDDhhmm]", "freeze command, 99 wildcards a field (default 99999999)", runFreeze},
+	{"rate", "BAUD", "change the communication rate", runRate},
+	{"passwd", "LEVEL NEWPASSWORD", "change the password of LEVEL", runPasswd},
+	{"clear-demand", "", "clear the maximum demand", runClearDemand},
+	{"clear-meter", "", "clear the meter", runClearMeter},
+	{"clear-event", "[DI]", "clear events of DI (default FFFFFFFF, all events)", runClearEvent},
+	{"relay", "COMMAND", "trip, allow-close, close, alarm, alarm-off, keep-power or keep-power-off", runRelay},
+	{"scan", "", "list the addresses of all meters on the bus", runScan},
+}
 
 func main() {
-	handler := dlt.NewClient2007Handler(rtuDevice)
-	handler.BaudRate = 4800
-	handler.DataBits = 8
-	handler.Parity = "N"
-	handler.StopBits = 1
-	handler.RS485.Enabled = false
-	handler.SlaveAddr = Address // [6]uint8{0x99, 0x99, 0x99, 0x99, 0x99, 0x99}
-	handler.Logger = log.New(os.Stdout, "dlt645: ", log.LstdFlags)
-	err := handler.Connect()
+	log.SetFlags(0)
+	log.SetPrefix("dlt645: ")
+
+	if len(os.Args) < 2 || os.Args[1] == "help" || os.Args[1] == "-h" || os.Args[1] == "--help" {
+		usage(os.Stdout)
+		return
+	}
+	name := os.Args[1]
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		o := &options{}
+		flags := o.flagSet(cmd)
+		if err := flags.Parse(os.Args[2:]); err != nil {
+			os.Exit(2)
+		}
+		if err := cmd.run(o, flags.Args()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "dlt645: unknown command %q\n\n", name)
+	usage(os.Stderr)
+	os.Exit(2)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: dlt645 <command> [flags] [arguments]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-13s %-18s %s\n", cmd.name, cmd.args, cmd.short)
+	}
+	fmt.Fprintf(w, "\nRun \"dlt645 <command> -h\" for the flags of a command.\n")
+}
+
+// options holds the flags shared by all commands.
+type options struct {
+	device   string
+	baud     int
+	dataBits int
+	parity   string
+	stopBits int
+	rs485    bool
+	address  string
+	protocol int
+	timeout  time.Duration
+	retries  int
+	verbose  bool
+	format   string
+
+	permission uint
+	password   string
+	operator   string
+
+	block  uint
+	clock  string
+	events string
+	valid  time.Duration
+}
+
+func (o *options) flagSet(cmd *command) *flag.FlagSet {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: dlt645 %s [flags] %s\n\n%s\n\nFlags:\n", cmd.name, cmd.args, cmd.short)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&o.device, "device", "/dev/ttyUSB0", "serial device, or tcp://host:port of a converter")
+	flags.IntVar(&o.baud, "baud", 2400, "baud rate")
+	flags.IntVar(&o.dataBits, "databits", 8, "data bits")
+	flags.StringVar(&o.parity, "parity", "E", "parity: N, E or O")
+	flags.IntVar(&o.stopBits, "stopbits", 1, "stop bits")
+	flags.BoolVar(&o.rs485, "rs485", false, "enable RS485 mode of the serial driver")
+	flags.StringVar(&o.address, "addr", "AAAAAAAAAAAA", "meter address, AA bytes are wildcards")
+	flags.IntVar(&o.protocol, "protocol", 2007, "protocol version: 2007 or 1997")
+	flags.DurationVar(&o.timeout, "timeout", 2*time.Second, "response timeout")
+	flags.IntVar(&o.retries, "retries", 1, "attempts for reads failing on transmission errors")
+	flags.BoolVar(&o.verbose, "v", false, "log the frames sent and received")
+	flags.StringVar(&o.format, "format", "decoded", "output format: hex, decoded or json")
+	flags.UintVar(&o.permission, "permission", 2, "password permission level 0-9")
+	flags.StringVar(&o.password, "password", "000000", "password, 6 hex digits")
+	flags.StringVar(&o.operator, "operator", "00000000", "operator code, 8 hex digits")
+	switch cmd.name {
+	case "read":
+		flags.UintVar(&o.block, "block", 0, "number of blocks for load profile reads")
+	case "settime":
+		flags.StringVar(&o.clock, "time", "", "time to set, \"2006-01-02 15:04:05\" (default now)")
+	case "relay":
+		flags.DurationVar(&o.valid, "valid", 10*time.Minute, "time the meter accepts the command for")
+	}
+	return flags
+}
+
+// handler is implemented by the serial and TCP handlers.
+type handler interface {
+	dlt.Transporter
+	Meter(addr uint64) dlt.Client
+	Close() error
+}
+
+// open opens the transport selected by the flags.
+func (o *options) open() (h handler, err error) {
+	var logger *log.Logger
+	if o.verbose {
+		logger = log.New(os.Stderr, "", log.Ltime|log.Lmicroseconds)
+	}
+	if strings.HasPrefix(o.device, "tcp://") {
+		tcp := dlt.NewClientTCPHandler(strings.TrimPrefix(o.device, "tcp://"))
+		tcp.Timeout = o.timeout
+		tcp.Logger = logger
+		if err = tcp.Connect(); err != nil {
+			return
+		}
+		h = tcp
+		return
+	}
+	serial := dlt.NewClient2007Handler(o.device)
+	serial.BaudRate = o.baud
+	serial.DataBits = o.dataBits
+	serial.Parity = strings.ToUpper(o.parity)
+	serial.StopBits = o.stopBits
+	serial.RS485.Enabled = o.rs485
+	serial.Timeout = o.timeout
+	serial.Logger = logger
+	if err = serial.Connect(); err != nil {
+		return
+	}
+	h = serial
+	return
+}
+
+// client opens the transport and returns a client for addr.
+func (o *options) client(addr uint64) (client dlt.Client, h handler, err error) {
+	if h, err = o.open(); err != nil {
+		return
+	}
+	switch o.protocol {
+	case 2007:
+		client = h.Meter(addr)
+	case 1997:
+		client = dlt.NewMeter1997Client(h, addr)
+	default:
+		h.Close()
+		err = fmt.Errorf("unknown protocol version %d", o.protocol)
+		return
+	}
+	if o.retries > 1 {
+		policy := dlt.DefaultRetryPolicy()
+		policy.MaxAttempts = o.retries
+		client = dlt.NewRetryClient(client, policy)
+	}
+	return
+}
+
+// meter opens a client for the -addr flag.
+func (o *options) meter() (client dlt.Client, h handler, err error) {
+	addr, err := parseAddress(o.address)
 	if err != nil {
-		log.Fatal(err)
+		return
 	}
-	defer handler.Close()
+	return o.client(addr)
+}
 
-	client := dlt.NewClient(handler)
-	results, err := client.ReadData(0x00000000, 0, 0, 0, 0, 0, 0)
+// credentials returns the permission, password and operator code flags.
+func (o *options) credentials() (permission uint8, password uint32, operator uint32, err error) {
+	if o.permission > 9 {
+		err = fmt.Errorf("permission %d must be between 0 and 9", o.permission)
+		return
+	}
+	permission = uint8(o.permission)
+	if password, err = parseHex(o.password, 6); err != nil {
+		return
+	}
+	operator, err = parseHex(o.operator, 8)
+	return
+}
+
+// parseAddress parses a decimal address, or the hex image of the address
+// field if it holds AA wildcard bytes.
+func parseAddress(s string) (addr uint64, err error) {
+	if len(s) > 12 {
+		err = fmt.Errorf("address %q must not be longer than 12 digits", s)
+		return
+	}
+	if strings.ContainsAny(s, "Aa") {
+		addr, err = strconv.ParseUint(s, 16, 64)
+	} else {
+		addr, err = strconv.ParseUint(s, 10, 64)
+	}
 	if err != nil {
-		log.Fatal(err)
+		err = fmt.Errorf("invalid address %q", s)
 	}
+	return
+}
 
-	log.Printf("%#v\n", results)
+// parseHex parses up to digits hex digits.
+func parseHex(s string, digits int) (v uint32, err error) {
+	if len(s) > digits {
+		err = fmt.Errorf("%q must not be longer than %d hex digits", s, digits)
+		return
+	}
+	n, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		err = fmt.Errorf("invalid hex number %q", s)
+	}
+	v = uint32(n)
+	return
+}
+
+// parseDataMarker parses a data identifier, 8 hex digits for DL/T 645-2007
+// or 4 for DL/T 645-1997.
+func parseDataMarker(s string, protocol int) (uint32, error) {
+	if protocol == 1997 {
+		return parseHex(s, 4)
+	}
+	return parseHex(s, 8)
 }
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	dlt "github.com/xgbt/dlt645-go"
+)
+
+// serveMeter serves a simulated meter on a local port until the test ends
+// and returns the -device flag reaching it.
+func serveMeter(t *testing.T, server *dlt.Server) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				server.Serve(conn)
+			}()
+		}
+	}()
+	return "tcp://" + listener.Addr().String()
+}
+
+// run runs the command name with args as main does and returns what it
+// printed.
+func run(t *testing.T, name string, args ...string) (output string, err error) {
+	t.Helper()
+	var cmd *command
+	for _, c := range commands {
+		if c.name == name {
+			cmd = c
+		}
+	}
+	if cmd == nil {
+		t.Fatalf("no command %q", name)
+	}
+	o := &options{}
+	flags := o.flagSet(cmd)
+	flags.SetOutput(io.Discard)
+	if err = flags.Parse(args); err != nil {
+		return
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	printed := make(chan string)
+	go func() {
+		var b bytes.Buffer
+		io.Copy(&b, r)
+		printed <- b.String()
+	}()
+	err = cmd.run(o, flags.Args())
+	w.Close()
+	output = <-printed
+	return
+}
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		s    string
+		want uint64
+	}{
+		{"304257140001", 304257140001},
+		{"1", 1},
+		{"AAAAAAAAAAAA", dlt.WildcardAddressDomain},
+		{"aaaaaaaa0001", 0xAAAAAAAA0001},
+	}
+	for _, test := range tests {
+		if addr, err := parseAddress(test.s); err != nil || addr != test.want {
+			t.Errorf("parseAddress(%q) = %d, %v, want %d", test.s, addr, err, test.want)
+		}
+	}
+	for _, s := range []string{"", "3042571400011", "30425714000x", "-1"} {
+		if addr, err := parseAddress(s); err == nil {
+			t.Errorf("parseAddress(%q) = %d, want an error", s, addr)
+		}
+	}
+}
+
+func TestParseDataMarker(t *testing.T) {
+	tests := []struct {
+		s        string
+		protocol int
+		want     uint32
+	}{
+		{"00010000", 2007, 0x00010000},
+		{"4000103", 2007, 0x04000103},
+		{"9010", 1997, 0x9010},
+		{"c032", 1997, 0xC032},
+	}
+	for _, test := range tests {
+		if marker, err := parseDataMarker(test.s, test.protocol); err != nil || marker != test.want {
+			t.Errorf("parseDataMarker(%q, %d) = %x, %v, want %x", test.s, test.protocol, marker, err, test.want)
+		}
+	}
+	for _, s := range []string{"", "00009010", "90100", "901x"} {
+		if marker, err := parseDataMarker(s, 1997); err == nil {
+			t.Errorf("parseDataMarker(%q, 1997) = %x, want an error", s, marker)
+		}
+	}
+	if marker, err := parseDataMarker("000100000", 2007); err == nil {
+		t.Errorf("parseDataMarker(%q, 2007) = %x, want an error", "000100000", marker)
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	o := &options{permission: 2, password: "123456", operator: "11223344"}
+	permission, password, operator, err := o.credentials()
+	if err != nil || permission != 2 || password != 0x123456 || operator != 0x11223344 {
+		t.Fatalf("credentials = %d, %x, %x, %v", permission, password, operator, err)
+	}
+	for _, o := range []*options{
+		{permission: 10, password: "0", operator: "0"},
+		{permission: 2, password: "1234567", operator: "0"},
+		{permission: 2, password: "0", operator: "1122334x"},
+	} {
+		if _, _, _, err = o.credentials(); err == nil {
+			t.Errorf("credentials of %+v accepted", *o)
+		}
+	}
+}
+
+// The arguments are checked before the transport is opened.
+func TestInvalidArguments(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"read", nil},
+		{"read", []string{"000000001"}},
+		{"read", []string{"-block", "256", "00000000"}},
+		{"read", []string{"-protocol", "1997", "00009010"}},
+		{"write", []string{"04000103"}},
+		{"write", []string{"04000103", "1"}},
+		{"freeze", []string{"0101"}},
+		{"freeze", []string{"01x10000"}},
+		{"rate", []string{"1000"}},
+		{"passwd", []string{"10", "123456"}},
+		{"clear-event", []string{"1", "2"}},
+		{"settime", []string{"-time", "tomorrow"}},
+		{"relay", nil},
+		{"relay", []string{"open"}},
+	}
+	for _, test := range tests {
+		if _, err := run(t, test.name, append([]string{"-device", "/dev/null/none"}, test.args...)...); err == nil || strings.Contains(err.Error(), "/dev/null/none") {
+			t.Errorf("%s %v: error %v, want an argument error", test.name, test.args, err)
+		}
+	}
+}
+
+func TestCommandsSimulator(t *testing.T) {
+	store := dlt.NewMemoryStore()
+	store.Write(0x00000000, []byte{0x56, 0x34, 0x12, 0x00})
+	device := serveMeter(t, dlt.NewServer(304257140001, store))
+
+	output, err := run(t, "read", "-device", device, "-addr", "304257140001", "-format", "hex", "00000000")
+	if err != nil || output != "00000000 00123456\n" {
+		t.Errorf("read = %q, %v", output, err)
+	}
+	if output, err = run(t, "write", "-device", device, "-format", "hex", "04000103", "15"); err != nil || output != "write: ok\n" {
+		t.Errorf("write = %q, %v", output, err)
+	}
+	if output, err = run(t, "read", "-device", device, "-format", "hex", "04000103"); err != nil || output != "04000103 15\n" {
+		t.Errorf("read after write = %q, %v", output, err)
+	}
+	if output, err = run(t, "addr", "-device", device); err != nil || output != "304257140001\n" {
+		t.Errorf("addr = %q, %v", output, err)
+	}
+	if output, err = run(t, "scan", "-device", device, "-format", "json"); err != nil || !strings.Contains(output, `"304257140001"`) {
+		t.Errorf("scan = %q, %v", output, err)
+	}
+	if _, err = run(t, "read", "-device", device, "-addr", "304257140001", "04000401"); err == nil {
+		t.Error("read of a missing data identifier succeeded")
+	}
+}
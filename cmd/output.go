@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	dlt "github.com/xgbt/dlt645-go"
+)
+
+// jsonItem is the JSON form of a decoded item.
+type jsonItem struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+	Unit  string      `json:"unit,omitempty"`
+}
+
+// jsonData is the JSON form of a read.
+type jsonData struct {
+	DataIdentifier string     `json:"dataIdentifier"`
+	Name           string     `json:"name,omitempty"`
+	Raw            string     `json:"raw"`
+	Items          []jsonItem `json:"items,omitempty"`
+	Error          string     `json:"error,omitempty"`
+}
+
+// printData prints the data read for marker in the selected format. Data is
+// shown high byte first in hex format, the way the standard writes it.
+func printData(o *options, marker uint32, data []byte) error {
+	raw := append([]byte(nil), data...)
+	dlt.Reverse(raw)
+	switch o.format {
+	case "hex":
+		fmt.Printf("%08X %X\n", marker, raw)
+	case "json":
+		out := jsonData{DataIdentifier: fmt.Sprintf("%08X", marker), Raw: fmt.Sprintf("%X", raw)}
+		if value, err := dlt.DefaultRegistry.Decode(marker, data); err != nil {
+			out.Error = err.Error()
+		} else {
+			out.Name = value.DataIdentifier.Name
+			for _, item := range value.Items {
+				out.Items = append(out.Items, jsonItem{Name: item.Name, Value: itemValue(item), Unit: item.Unit})
+			}
+		}
+		return printJSON(out)
+	case "decoded":
+		value, err := dlt.DefaultRegistry.Decode(marker, data)
+		if err != nil {
+			fmt.Printf("%08X %X (%v)\n", marker, raw, err)
+			return nil
+		}
+		fmt.Printf("%08X %s\n", marker, value.DataIdentifier.Name)
+		for _, item := range value.Items {
+			fmt.Printf("  %-24s %s\n", item.Name, item)
+		}
+	default:
+		return fmt.Errorf("unknown format %q", o.format)
+	}
+	return nil
+}
+
+// itemValue returns the JSON value of an item.
+func itemValue(item dlt.Item) interface{} {
+	switch {
+	case item.Text != "":
+		return item.Text
+	case !item.Time.IsZero():
+		return item.String()
+	}
+	return item.Number
+}
+
+// printAddress prints an address read from a meter.
+func printAddress(o *options, data []byte) error {
+	addr := append([]byte(nil), data...)
+	dlt.Reverse(addr)
+	s := fmt.Sprintf("%X", addr)
+	if o.format == "json" {
+		return printJSON(map[string]string{"address": s})
+	}
+	fmt.Println(s)
+	return nil
+}
+
+// printAddresses prints the addresses found on a bus.
+func printAddresses(o *options, addrs []uint64) error {
+	list := make([]string, len(addrs))
+	for i, addr := range addrs {
+		list[i] = fmt.Sprintf("%012d", addr)
+	}
+	if o.format == "json" {
+		return printJSON(map[string][]string{"addresses": list})
+	}
+	for _, s := range list {
+		fmt.Println(s)
+	}
+	return nil
+}
+
+// printOK reports a successful command.
+func printOK(o *options, name string) error {
+	if o.format == "json" {
+		return printJSON(map[string]interface{}{"command": name, "ok": true})
+	}
+	fmt.Println(name + ": ok")
+	return nil
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,135 @@
+package dlt645
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// afterFunc arranges to call f in its own goroutine once ctx is done. The
+// returned stop prevents the call and reports whether it did so, when it
+// returns false f has already completed.
+func afterFunc(ctx context.Context, f func()) (stop func() bool) {
+	if ctx.Done() == nil {
+		return func() bool { return true }
+	}
+	var once sync.Once
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			once.Do(f)
+		case <-stopped:
+		}
+	}()
+	return func() (stop bool) {
+		once.Do(func() {
+			stop = true
+			close(stopped)
+		})
+		return
+	}
+}
+
+// contextErr returns the error of ctx, also when a read deadline taken from
+// ctx expired before ctx noticed itself.
+func contextErr(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+// contextClient returns client as a ContextClient. The commands of a Client
+// without context variants only check ctx before they start.
+func contextClient(client Client) ContextClient {
+	if c, ok := client.(ContextClient); ok {
+		return c
+	}
+	return plainClient{client}
+}
+
+// plainClient adds the context variants to a Client.
+type plainClient struct {
+	Client
+}
+
+func (c plainClient) ReadDataContext(ctx context.Context, dataMarker uint32, blockQuantity uint8, year, month, day, hour, minute uint8) (results []byte, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return c.ReadData(dataMarker, blockQuantity, year, month, day, hour, minute)
+}
+
+func (c plainClient) WriteDataContext(ctx context.Context, dataMarker uint32, passwordPermission uint8, password uint32, operatorCode uint32, data []byte) (results []byte, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return c.WriteData(dataMarker, passwordPermission, password, operatorCode, data)
+}
+
+func (c plainClient) ReadCommunicationAddressContext(ctx context.Context) (results []byte, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return c.ReadCommunicationAddress()
+}
+
+func (c plainClient) WriteCommunicationAddressContext(ctx context.Context, commAddr uint64) (results []byte, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return c.WriteCommunicationAddress(commAddr)
+}
+
+func (c plainClient) BroadcastTimingContext(ctx context.Context, year, month, day, hour, minute, second uint8) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return c.BroadcastTiming(year, month, day, hour, minute, second)
+}
+
+func (c plainClient) FreezeCommandContext(ctx context.Context, month, day, hour, minute uint8) (results []byte, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return c.FreezeCommand(month, day, hour, minute)
+}
+
+func (c plainClient) ChangeCommunicationRateContext(ctx context.Context, word uint8) (results []byte, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return c.ChangeCommunicationRate(word)
+}
+
+func (c plainClient) ChangePasswordContext(ctx context.Context, dataMarker uint32, oldPasswordPermission uint8, oldPassword uint32, newPasswordPermission uint8, newPassword uint32) (results []byte, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return c.ChangePassword(dataMarker, oldPasswordPermission, oldPassword, newPasswordPermission, newPassword)
+}
+
+func (c plainClient) ClearMaximumDemandContext(ctx context.Context, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return c.ClearMaximumDemand(passwordPermission, password, operatorCode)
+}
+
+func (c plainClient) ClearAmmeterContext(ctx context.Context, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return c.ClearAmmeter(passwordPermission, password, operatorCode)
+}
+
+func (c plainClient) ClearEventContext(ctx context.Context, dataMarker uint32, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return c.ClearEvent(dataMarker, passwordPermission, password, operatorCode)
+}
@@ -0,0 +1,72 @@
+package dlt645
+
+import (
+	"fmt"
+	"time"
+)
+
+// DemandRecord is a maximum demand and the time it occurred, the zero time
+// if no demand was recorded yet.
+type DemandRecord struct {
+	Value float64
+	Time  time.Time
+}
+
+// MaximumDemand is the maximum demand of one type, the total and the
+// tariffs 1..N.
+type MaximumDemand struct {
+	Type EnergyType
+	// Period is 0 for the current demand, 1..12 for the last settlement days
+	Period  uint8
+	Unit    string
+	Total   DemandRecord
+	Tariffs []DemandRecord
+}
+
+// ReadMaximumDemand reads the maximum demand block of kind for period, 0 is
+// the current demand, 1..12 the demand frozen at the last settlement days.
+// There is no combined active demand.
+func (d *Device) ReadMaximumDemand(kind EnergyType, period uint8) (demand *MaximumDemand, err error) {
+	if period > maxSettlementPeriod {
+		err = fmt.Errorf("dlt645: settlement period '%v' must be between '0' and '%v'", period, maxSettlementPeriod)
+		return
+	}
+	if demandIdentifier(0x01000000|uint32(kind)<<16) == nil {
+		err = fmt.Errorf("dlt645: unknown demand type '%02x'", byte(kind))
+		return
+	}
+	data, err := d.ReadRaw(0x01000000 | uint32(kind)<<16 | 0xFF00 | uint32(period))
+	if err != nil {
+		return
+	}
+	if demand, err = decodeMaximumDemand(kind, data); err != nil {
+		return
+	}
+	demand.Period = period
+	return
+}
+
+// decodeMaximumDemand decodes the total and tariff records of a maximum
+// demand block.
+func decodeMaximumDemand(kind EnergyType, data []byte) (demand *MaximumDemand, err error) {
+	di := demandIdentifier(0x01000000 | uint32(kind)<<16 | 0xFF00)
+	if di == nil {
+		err = fmt.Errorf("dlt645: unknown demand type '%02x'", byte(kind))
+		return
+	}
+	value, err := di.Decode(data)
+	if err != nil {
+		return
+	}
+
+	demand = &MaximumDemand{Type: kind, Unit: di.Fields[0].Unit}
+	for i := 0; i+1 < len(value.Items); i += 2 {
+		record := DemandRecord{Value: value.Items[i].Number, Time: value.Items[i+1].Time}
+		if i == 0 {
+			demand.Total = record
+		} else {
+			demand.Tariffs = append(demand.Tariffs, record)
+		}
+	}
+	return
+}
@@ -0,0 +1,46 @@
+package dlt645
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadMaximumDemandSimulator(t *testing.T) {
+	store := NewMemoryStore()
+	store.Write(0x0101FF00, blockData("012345", "2405060715", "012345", "2405060715", "000000", "0000000000"))
+	store.Write(0x0103FF01, blockData("800250", "2404301200"))
+	device := newSimulatedDevice(t, store)
+
+	demand, err := device.ReadMaximumDemand(EnergyPositiveActive, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 5, 6, 7, 15, 0, 0, time.Local)
+	want := &MaximumDemand{
+		Type:    EnergyPositiveActive,
+		Unit:    "kW",
+		Total:   DemandRecord{Value: 1.2345, Time: at},
+		Tariffs: []DemandRecord{{Value: 1.2345, Time: at}, {}},
+	}
+	if !reflect.DeepEqual(demand, want) {
+		t.Errorf("demand %+v, want %+v", demand, want)
+	}
+
+	if demand, err = device.ReadMaximumDemand(EnergyCombinedReactive1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if demand.Period != 1 || demand.Unit != "kvar" || demand.Total.Value != -0.025 || !demand.Total.Time.Equal(time.Date(2024, 4, 30, 12, 0, 0, 0, time.Local)) {
+		t.Errorf("combined reactive 1 demand %+v", demand)
+	}
+
+	if _, err = device.ReadMaximumDemand(EnergyCombinedActive, 0); err == nil {
+		t.Error("combined active demand read")
+	}
+	if _, err = device.ReadMaximumDemand(EnergyReverseActive, 0); !isRequestWithoutData(err) {
+		t.Errorf("demand without data: error %v", err)
+	}
+	if _, err = device.ReadMaximumDemand(EnergyPositiveActive, 13); err == nil {
+		t.Error("settlement period 13 read")
+	}
+}
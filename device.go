@@ -0,0 +1,60 @@
+package dlt645
+
+import (
+	"context"
+)
+
+// Device reads and writes typed values of a meter through a Client.
+type Device struct {
+	Client Client
+	// Registry used to decode values, nil means DefaultRegistry
+	Registry *Registry
+
+	ctx context.Context
+}
+
+// NewDevice allocates a Device on top of client.
+func NewDevice(client Client) *Device {
+	return &Device{Client: client}
+}
+
+// WithContext returns a shallow copy of d whose requests abort when ctx is
+// done.
+func (d *Device) WithContext(ctx context.Context) *Device {
+	d2 := *d
+	d2.ctx = ctx
+	return &d2
+}
+
+// Context returns the context of the device requests.
+func (d *Device) Context() context.Context {
+	if d.ctx != nil {
+		return d.ctx
+	}
+	return context.Background()
+}
+
+func (d *Device) registry() *Registry {
+	if d.Registry != nil {
+		return d.Registry
+	}
+	return DefaultRegistry
+}
+
+// ReadRaw reads the data of a data identifier.
+func (d *Device) ReadRaw(marker uint32) (data []byte, err error) {
+	return contextClient(d.Client).ReadDataContext(d.Context(), marker, 0, 0, 0, 0, 0, 0)
+}
+
+// ReadValue reads and decodes a data identifier known to the registry.
+func (d *Device) ReadValue(marker uint32) (value *Value, err error) {
+	di, ok := d.registry().Lookup(marker)
+	if !ok {
+		return d.registry().Decode(marker, nil)
+	}
+	data, err := d.ReadRaw(marker)
+	if err != nil {
+		return
+	}
+	return di.Decode(data)
+}
@@ -0,0 +1,131 @@
+package dlt645
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+
+	"github.com/goburrow/serial"
+	"github.com/xgbt/dlt645-go/utils"
+)
+
+const (
+	// data identifier read to probe a wildcard address
+	scanDataMarker = 0x04000401
+	wildcardByte   = 0xAA
+)
+
+// ScanBus returns the addresses of all meters on the bus of transporter.
+//
+// DL/T 645-2007 lets the high bytes of the address be replaced by the 0xAA
+// wildcard. ScanBus reads the communication address with all bytes
+// wildcarded, a single clean answer ends the search. When several meters
+// answer at once their responses collide and fail to decode, the search then
+// fixes the lowest wildcarded byte to each of 00..99 in turn and repeats
+// below every prefix that got an answer. Silent prefixes are skipped after
+// the transporter timeout, so the scan costs about 100 timeouts for every
+// byte of address two meters share.
+func ScanBus(ctx context.Context, transporter Transporter) (addrs []uint64, err error) {
+	seen := make(map[uint64]bool)
+	err = scanBus(ctx, transporter, nil, func(addr uint64) {
+		if !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	})
+	return
+}
+
+func scanBus(ctx context.Context, transporter Transporter, prefix []byte, found func(addr uint64)) (err error) {
+	addr, ok, collision, err := probeAddress(ctx, transporter, prefix)
+	if err != nil {
+		return
+	}
+	if ok {
+		found(addr)
+	}
+	if !collision {
+		return
+	}
+	if len(prefix) == 6 {
+		// several meters share the same address, the answers can't be told apart
+		found(dataDomainToAddress(prefix))
+		return
+	}
+	for v := uint8(0); v < 100; v++ {
+		next := append(prefix[:len(prefix):len(prefix)], utils.BCDFromUint8(v))
+		if err = scanBus(ctx, transporter, next, found); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// probeAddress reads the communication address with the address bytes after
+// prefix wildcarded. ok reports a clean answer, collision a garbled one.
+func probeAddress(ctx context.Context, transporter Transporter, prefix []byte) (addr uint64, ok, collision bool, err error) {
+	address := make([]byte, 6)
+	copy(address, prefix)
+	for i := len(prefix); i < 6; i++ {
+		address[i] = wildcardByte
+	}
+	request := encodeFrame(address, FunctionCodeReadData, uintArrayToDataDomain(uint32(scanDataMarker)))
+
+	var response []byte
+	if t, isContext := transporter.(ContextTransporter); isContext {
+		response, err = t.SendContext(ctx, request)
+	} else {
+		response, err = transporter.Send(request)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			return
+		}
+		// a garbled answer is a collision even if the read then timed out
+		if isGarbled(err) {
+			err, collision = nil, true
+			return
+		}
+		if isSilence(err) {
+			err = nil
+		}
+		return
+	}
+
+	if len(response) < rtuMinSize+2 || !matchAddress(address, response[1:7]) {
+		collision = true
+		return
+	}
+	// an exception answer still carries the address of a single meter
+	payload, decodeErr := decodeFrame(response)
+	var dltError *DltError
+	if (decodeErr != nil && !errors.As(decodeErr, &dltError)) || payload.FunctionCode != FunctionCodeReadData {
+		collision = true
+		return
+	}
+	addr, ok = dataDomainToAddress(response[1:7]), true
+	return
+}
+
+// dataDomainToAddress converts the 6 address bytes as transmitted to the
+// meter address, see addressToDataDomain.
+func dataDomainToAddress(data []byte) uint64 {
+	addrBCD := append([]byte(nil), data...)
+	Reverse(addrBCD)
+	if _, err := decodeBCD(data); err != nil {
+		return binary.BigEndian.Uint64(append([]byte{0, 0}, addrBCD...))
+	}
+	return utils.BCDToUint64(addrBCD)
+}
+
+// isSilence reports whether nobody answered.
+func isSilence(err error) bool {
+	return errors.Is(err, ErrTimeout) || errors.Is(err, serial.ErrTimeout) || isTimeout(err)
+}
+
+// isGarbled reports whether an answer was received that does not make up a
+// frame, rather than the transport failing.
+func isGarbled(err error) bool {
+	return errors.Is(err, ErrMalformedFrame) || errors.Is(err, ErrChecksum) || errors.Is(err, ErrFrameTooShort)
+}
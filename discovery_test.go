@@ -0,0 +1,151 @@
+package dlt645
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/goburrow/serial"
+)
+
+// chunkReader returns at most one chunk per Read, then err.
+type chunkReader struct {
+	chunks [][]byte
+	err    error
+}
+
+func (r *chunkReader) Read(p []byte) (n int, err error) {
+	if len(r.chunks) == 0 {
+		return 0, r.err
+	}
+	n = copy(p, r.chunks[0])
+	if r.chunks[0] = r.chunks[0][n:]; len(r.chunks[0]) == 0 {
+		r.chunks = r.chunks[1:]
+	}
+	return
+}
+
+// testBus is a Transporter for several simulated meters on one line. The
+// answers of meters responding at once collide, every byte they disagree on
+// is received as 0xFF.
+type testBus struct {
+	servers []*Server
+}
+
+func newTestBus(addrs ...uint64) *testBus {
+	bus := &testBus{}
+	for _, addr := range addrs {
+		bus.servers = append(bus.servers, NewServer(addr, NewMemoryStore()))
+	}
+	return bus
+}
+
+func (b *testBus) Send(request []byte) (response []byte, err error) {
+	var line []byte
+	for _, server := range b.servers {
+		answer := server.handle(&serverSession{}, request)
+		if answer == nil {
+			continue
+		}
+		if line == nil {
+			line = answer
+			continue
+		}
+		for k := range line {
+			if k >= len(answer) || line[k] != answer[k] {
+				line[k] = 0xff
+			}
+		}
+	}
+	return readFrame(&chunkReader{chunks: [][]byte{line}, err: os.ErrDeadlineExceeded})
+}
+
+func (b *testBus) SendNotResponse(request []byte) (err error) {
+	for _, server := range b.servers {
+		server.handle(&serverSession{}, request)
+	}
+	return
+}
+
+func TestScanBus(t *testing.T) {
+	tests := []struct {
+		name  string
+		addrs []uint64
+	}{
+		{"empty", nil},
+		{"one meter", []uint64{304257140001}},
+		{"two meters", []uint64{304257140001, 304257140002}},
+		{"shared low byte", []uint64{304257140001, 304257150001}},
+		{"three meters", []uint64{1, 2, 999999999998}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			addrs, err := ScanBus(context.Background(), newTestBus(test.addrs...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+			if len(addrs) == 0 && len(test.addrs) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(addrs, test.addrs) {
+				t.Fatalf("found %v, want %v", addrs, test.addrs)
+			}
+		})
+	}
+}
+
+// garbledTransporter receives noise until the read times out.
+type garbledTransporter struct{}
+
+func (garbledTransporter) Send(request []byte) (response []byte, err error) {
+	err = fmt.Errorf("%w: no frame in ff ff: %w", ErrMalformedFrame, serial.ErrTimeout)
+	return
+}
+
+func (garbledTransporter) SendNotResponse(request []byte) (err error) {
+	return
+}
+
+func TestProbeAddressCollision(t *testing.T) {
+	_, ok, collision, err := probeAddress(context.Background(), newTestBus(304257140001, 304257140002), nil)
+	if err != nil || ok || !collision {
+		t.Fatalf("probe = ok %v, collision %v, err %v, want a collision", ok, collision, err)
+	}
+	// noise followed by silence is still a collision
+	_, ok, collision, err = probeAddress(context.Background(), garbledTransporter{}, nil)
+	if err != nil || ok || !collision {
+		t.Fatalf("garbled probe = ok %v, collision %v, err %v, want a collision", ok, collision, err)
+	}
+}
+
+func TestAddressDataDomain(t *testing.T) {
+	tests := []struct {
+		addr uint64
+		want []byte
+	}{
+		{304257140001, []byte{0x01, 0x00, 0x14, 0x57, 0x42, 0x30}},
+		{1, []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{999999999999, []byte{0x99, 0x99, 0x99, 0x99, 0x99, 0x99}},
+		{BroadcastAddressDomain, []byte{0x99, 0x99, 0x99, 0x99, 0x99, 0x99}},
+		{WildcardAddressDomain, []byte{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA}},
+		{0xAAAAAAAA0001, []byte{0x01, 0x00, 0xAA, 0xAA, 0xAA, 0xAA}},
+	}
+	for _, test := range tests {
+		data := addressToDataDomain(test.addr)
+		if !bytes.Equal(data, test.want) {
+			t.Errorf("addressToDataDomain(%x) = % x, want % x", test.addr, data, test.want)
+		}
+		// the BCD and the hex image of the broadcast address are the same bytes
+		if test.addr == BroadcastAddressDomain {
+			continue
+		}
+		if addr := dataDomainToAddress(data); addr != test.addr {
+			t.Errorf("dataDomainToAddress(% x) = %x, want %x", data, addr, test.addr)
+		}
+	}
+}
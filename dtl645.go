@@ -3,10 +3,16 @@ Package dlt645 provides a client for dlt645
 */
 package dlt645
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
 
 const (
 	// len limit 5-Bit
+	FunctionCodeSecurityAuthentication    = 0x03 // binary 0000 0011
 	FunctionCodeReadData                  = 0x11 // binary 0001 0001
 	FunctionCodeReadFollowUpData          = 0x12 // binary 0001 0010
 	FunctionCodeWriteData                 = 0x14 // binary 0001 0100
@@ -19,6 +25,50 @@ const (
 	FunctionCodeClearMaximumDemand        = 0x19 // binary 0001 1001
 	FunctionCodeClearAmmeter              = 0x1A // binary 0001 1010
 	FunctionCodeClearEvent                = 0x1B // binary 0001 1011
+	FunctionCodeRelayControl              = 0x1C // binary 0001 1100
+	FunctionCodeMultiFunctionOutput       = 0x1D // binary 0001 1101
+)
+
+// Password permissions of commands protected by a security session, the
+// password is not checked.
+const (
+	PasswordPermissionCipherMAC = 0x98 // 密文+MAC
+	PasswordPermissionPlainMAC  = 0x99 // 明文+MAC
+)
+
+// RelayCommand is the N1 byte of a relay control command.
+type RelayCommand byte
+
+const (
+	RelayTrip         RelayCommand = 0x1A // 跳闸
+	RelayAllowClose   RelayCommand = 0x1B // 合闸允许
+	RelayClose        RelayCommand = 0x1C // 直接合闸
+	RelayAlarm        RelayCommand = 0x2A // 报警
+	RelayAlarmOff     RelayCommand = 0x2B // 报警解除
+	RelayKeepPower    RelayCommand = 0x3A // 保电
+	RelayKeepPowerOff RelayCommand = 0x3B // 保电解除
+)
+
+// TerminalOutput selects the signal of the multi-function terminal.
+type TerminalOutput byte
+
+const (
+	TerminalOutputClockPulse   TerminalOutput = 0x00 // 时钟秒脉冲
+	TerminalOutputDemandPeriod TerminalOutput = 0x01 // 需量周期
+	TerminalOutputTariffSwitch TerminalOutput = 0x02 // 时段投切
+)
+
+// DL/T 645-1997 function codes
+const (
+	FunctionCode1997ReadData                  = 0x01 // binary 0000 0001
+	FunctionCode1997ReadFollowUpData          = 0x02 // binary 0000 0010
+	FunctionCode1997ReReadData                = 0x03 // binary 0000 0011
+	FunctionCode1997WriteData                 = 0x04 // binary 0000 0100
+	FunctionCode1997BroadcastTiming           = 0x08 // binary 0000 1000
+	FunctionCode1997WriteCommunicationAddress = 0x0A // binary 0000 1010
+	FunctionCode1997ChangeCommunicationRate   = 0x0C // binary 0000 1100
+	FunctionCode1997ChangePassword            = 0x0F // binary 0000 1111
+	FunctionCode1997ClearMaximumDemand        = 0x10 // binary 0001 0000
 )
 
 const (
@@ -31,6 +81,16 @@ const (
 	ExceptionCodeOtherError                     = 0x01 // binary 0000 0001 其他错误
 )
 
+// DL/T 645-1997 bits of the error status word
+const (
+	ExceptionCode1997RatesExceedsLimit          = 0x40 // binary 0100 0000 费率数超
+	ExceptionCode1997DayPeriodsExceedsThreshold = 0x20 // binary 0010 0000 日时段数超
+	ExceptionCode1997TimeZonesExceedsThreshold  = 0x10 // binary 0001 0000 年时区数超
+	ExceptionCode1997IllegalPassword            = 0x04 // binary 0000 0100 密码错
+	ExceptionCode1997DataMarkerError            = 0x02 // binary 0000 0010 数据标识错
+	ExceptionCode1997IllegalData                = 0x01 // binary 0000 0001 非法数据
+)
+
 const (
 	FrameHead = 0x68
 	FrameTail = 0x16
@@ -38,36 +98,136 @@ const (
 
 const (
 	BroadcastAddressDomain = 0x999999999999
+	WildcardAddressDomain  = 0xAAAAAAAAAAAA
+
+	// addresses above are the hex image of the address field
+	maxAddress = 999999999999
 )
 
-// DLTError implements error interface
+// ErrNotSupported is returned for commands the protocol version of the
+// client does not define.
+var ErrNotSupported = errors.New("dlt645: command not supported")
+
+// Error classes, test with errors.Is.
+var (
+	// no response within the timeout
+	ErrTimeout = errors.New("dlt645: timeout")
+	// checksum of the response does not match
+	ErrChecksum = errors.New("dlt645: checksum mismatch")
+	// response comes from another meter
+	ErrAddressMismatch = errors.New("dlt645: address mismatch")
+	// bytes received do not make up a frame
+	ErrMalformedFrame = errors.New("dlt645: malformed frame")
+	// response is shorter than the minimal frame
+	ErrFrameTooShort = errors.New("dlt645: frame too short")
+	// response does not answer the function code of the request
+	ErrUnexpectedFunctionCode = errors.New("dlt645: unexpected function code")
+	// meter answered with an exception, see DltError
+	ErrSlaveException = errors.New("dlt645: slave exception")
+)
+
+type exceptionName struct {
+	code byte
+	name string
+}
+
+// exceptionNames names the bits of the error status word.
+var exceptionNames = []exceptionName{
+	{ExceptionCodeOtherError, "Other error"},
+	{ExceptionCodeRequestWithoutData, "Request without data"},
+	{ExceptionCodeIllegalPassword, "Incorrect password or no permission"},
+	{ExceptionCodeCommunicationRateCannotChanged, "The communication rate cannot be changed"},
+	{ExceptionCodeTimeZonesYearExceedsThreshold, "The number of time zones in the year exceeds the threshold"},
+	{ExceptionCodeDayPeriodsExceedsThreshold, "The number of day periods exceeds the threshold"},
+	{ExceptionCodeRatesExceedsLimit, "The number of rates exceeds the limit"},
+}
+
+// exceptionNames1997 names the bits of the DL/T 645-1997 error status word.
+var exceptionNames1997 = []exceptionName{
+	{ExceptionCode1997IllegalData, "Illegal data"},
+	{ExceptionCode1997DataMarkerError, "Data identifier error"},
+	{ExceptionCode1997IllegalPassword, "Incorrect password"},
+	{ExceptionCode1997TimeZonesExceedsThreshold, "The number of time zones exceeds the threshold"},
+	{ExceptionCode1997DayPeriodsExceedsThreshold, "The number of day periods exceeds the threshold"},
+	{ExceptionCode1997RatesExceedsLimit, "The number of rates exceeds the limit"},
+}
+
+// DLTError implements error interface, ExceptionCode is the error status
+// word of the response in which several bits may be set.
 type DltError struct {
 	FunctionCode  byte
 	ExceptionCode byte
+
+	// names of the protocol version answering, exceptionNames if nil
+	names []exceptionName
 }
 
 // Error converts known dlt645 exception code to error message
 func (e *DltError) Error() string {
-	var name string
-	switch e.ExceptionCode {
-	case ExceptionCodeRatesExceedsLimit:
-		name = "The number of rates exceeds the limit"
-	case ExceptionCodeDayPeriodsExceedsThreshold:
-		name = "The number of day periods exceeds the threshold"
-	case ExceptionCodeTimeZonesYearExceedsThreshold:
-		name = "The number of time zones in the year exceeds the threshold"
-	case ExceptionCodeCommunicationRateCannotChanged:
-		name = "The communication rate cannot be changed"
-	case ExceptionCodeIllegalPassword:
-		name = "Incorrect password or no permission"
-	case ExceptionCodeRequestWithoutData:
-		name = "Request without data"
-	case ExceptionCodeOtherError:
-		name = "Other error"
-	default:
-		name = "Unknown"
+	table := e.names
+	if table == nil {
+		table = exceptionNames
 	}
-	return fmt.Sprintf("dlt645: exception '%v' (%s), function '%v'", e.ExceptionCode, name, e.FunctionCode)
+	var names []string
+	var known byte
+	for _, exception := range table {
+		known |= exception.code
+		if e.Has(exception.code) {
+			names = append(names, exception.name)
+		}
+	}
+	if e.ExceptionCode&^known != 0 || len(names) == 0 {
+		names = append(names, "Unknown")
+	}
+	return fmt.Sprintf("dlt645: exception '%v' (%s), function '%v'", e.ExceptionCode, strings.Join(names, ", "), e.FunctionCode)
+}
+
+// Has reports whether all bits of code are set in the error status word.
+func (e *DltError) Has(code byte) bool {
+	return code != 0 && e.ExceptionCode&code == code
+}
+
+// Exceptions returns the bits set in the error status word, one exception
+// code per bit.
+func (e *DltError) Exceptions() (codes []byte) {
+	for bit := byte(1); bit != 0; bit <<= 1 {
+		if e.ExceptionCode&bit != 0 {
+			codes = append(codes, bit)
+		}
+	}
+	return
+}
+
+// Is matches ErrSlaveException, and a *DltError target whose exception bits
+// are all set in e, e.g.
+// errors.Is(err, &DltError{ExceptionCode: ExceptionCodeIllegalPassword}).
+// A zero FunctionCode in target matches any function code.
+func (e *DltError) Is(target error) bool {
+	if target == ErrSlaveException {
+		return true
+	}
+	t, ok := target.(*DltError)
+	if !ok {
+		return false
+	}
+	return (t.FunctionCode == 0 || t.FunctionCode == e.FunctionCode) && e.ExceptionCode&t.ExceptionCode == t.ExceptionCode
+}
+
+// timeoutError wraps the transport error of a timed out exchange.
+type timeoutError struct {
+	err error
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrTimeout, e.err)
+}
+
+func (e *timeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+func (e *timeoutError) Unwrap() error {
+	return e.err
 }
 
 // controlCode
@@ -93,3 +253,12 @@ type Transporter interface {
 	Send(request []byte) (response []byte, err error)
 	SendNotResponse(request []byte) (err error)
 }
+
+// ContextTransporter is a Transporter whose exchanges can be cancelled.
+// Cancelling aborts the wait for a response and leaves the transport ready
+// for the next request.
+type ContextTransporter interface {
+	Transporter
+	SendContext(ctx context.Context, request []byte) (response []byte, err error)
+	SendNotResponseContext(ctx context.Context, request []byte) (err error)
+}
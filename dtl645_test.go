@@ -0,0 +1,215 @@
+package dlt645
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/goburrow/serial"
+)
+
+var errorClasses = []struct {
+	name string
+	err  error
+}{
+	{"ErrTimeout", ErrTimeout},
+	{"ErrChecksum", ErrChecksum},
+	{"ErrAddressMismatch", ErrAddressMismatch},
+	{"ErrMalformedFrame", ErrMalformedFrame},
+	{"ErrFrameTooShort", ErrFrameTooShort},
+	{"ErrUnexpectedFunctionCode", ErrUnexpectedFunctionCode},
+	{"ErrSlaveException", ErrSlaveException},
+}
+
+// scriptedMeter returns the bytes sent back for a request frame, nil for
+// no answer.
+type scriptedMeter func(request []byte) []byte
+
+// answerFrames answers the frames read by scanner until it fails.
+func answerFrames(scanner *frameScanner, w func(b []byte), meter scriptedMeter) {
+	for {
+		request, err := scanner.next()
+		if err != nil {
+			return
+		}
+		if answer := meter(request); answer != nil {
+			w(answer)
+		}
+	}
+}
+
+func serialMeter(t *testing.T, meter scriptedMeter) Transporter {
+	port := &testSerialPort{timeout: 5 * time.Millisecond}
+	port.line = lineFunc(func(b []byte) {
+		answerFrames(newFrameScanner(bytes.NewReader(b)), func(b []byte) { port.inject(b) }, meter)
+	})
+	return newTestSerialHandler(port)
+}
+
+func tcpMeter(t *testing.T, meter scriptedMeter) Transporter {
+	handler := NewClientTCPHandler(listenTCP(t, func(conn net.Conn) {
+		answerFrames(newFrameScanner(conn), func(b []byte) { conn.Write(b) }, meter)
+	}))
+	handler.Timeout = 100 * time.Millisecond
+	t.Cleanup(func() { handler.Close() })
+	return handler
+}
+
+func dtuMeter(t *testing.T, meter scriptedMeter) Transporter {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewDTUServer("")
+	server.Timeout = 100 * time.Millisecond
+	registered := make(chan *DTUHandler, 1)
+	server.OnRegister = func(handler *DTUHandler) { registered <- handler }
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if _, err = conn.Write([]byte("dtu-1")); err != nil {
+		t.Fatal(err)
+	}
+	go answerFrames(newFrameScanner(conn), func(b []byte) { conn.Write(b) }, meter)
+
+	select {
+	case handler := <-registered:
+		return handler
+	case <-time.After(time.Second):
+		t.Fatal("DTU did not register")
+	}
+	return nil
+}
+
+func TestErrorClasses(t *testing.T) {
+	addr := addressToDataDomain(304257140001)
+	answer := func(controlCode byte, data ...byte) scriptedMeter {
+		return func(request []byte) []byte { return encodeFrame(addr, controlCode, data) }
+	}
+	reading := []byte{0x00, 0x00, 0x00, 0x00, 0x12, 0x34, 0x56, 0x00}
+
+	tests := []struct {
+		name  string
+		meter scriptedMeter
+		want  []error
+	}{
+		{"answer", answer(0x91, reading...), nil},
+		{"no answer", func(request []byte) []byte { return nil }, []error{ErrTimeout}},
+		{"checksum", func(request []byte) []byte {
+			frame := encodeFrame(addr, 0x91, reading)
+			frame[len(frame)-2]++
+			return frame
+		}, []error{ErrChecksum}},
+		{"noise", func(request []byte) []byte { return []byte{0x00, 0x68, 0x12, 0x34} }, []error{ErrMalformedFrame}},
+		{"other meter", func(request []byte) []byte {
+			return encodeFrame(addressToDataDomain(304257140002), 0x91, reading)
+		}, []error{ErrAddressMismatch}},
+		{"function code", answer(0x94), []error{ErrUnexpectedFunctionCode}},
+		{"data identifier", answer(0x91, 0x00, 0x00, 0x01, 0x00, 0x12), []error{ErrMalformedFrame}},
+		{"exception", answer(0xD1, ExceptionCodeRequestWithoutData|ExceptionCodeIllegalPassword), []error{
+			ErrSlaveException,
+			&DltError{ExceptionCode: ExceptionCodeIllegalPassword},
+			&DltError{FunctionCode: FunctionCodeReadData, ExceptionCode: ExceptionCodeRequestWithoutData},
+		}},
+	}
+	transports := []struct {
+		name string
+		new  func(t *testing.T, meter scriptedMeter) Transporter
+	}{
+		{"serial", serialMeter},
+		{"tcp", tcpMeter},
+		{"dtu", dtuMeter},
+	}
+	for _, transport := range transports {
+		for _, test := range tests {
+			t.Run(transport.name+"/"+test.name, func(t *testing.T) {
+				client := NewMeterClient(transport.new(t, test.meter), 304257140001)
+				_, err := client.ReadData(0x00000000, 0, 0, 0, 0, 0, 0)
+				if (err == nil) != (test.want == nil) {
+					t.Fatalf("error %v, want %v", err, test.want)
+				}
+				for _, class := range errorClasses {
+					want := false
+					for _, e := range test.want {
+						want = want || e == class.err
+					}
+					if got := errors.Is(err, class.err); got != want {
+						t.Errorf("errors.Is(%v, %s) = %v, want %v", err, class.name, got, want)
+					}
+				}
+				for _, e := range test.want {
+					if !errors.Is(err, e) {
+						t.Errorf("errors.Is(%v, %v) = false", err, e)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestDltErrorIs(t *testing.T) {
+	err := &DltError{FunctionCode: FunctionCodeWriteData, ExceptionCode: ExceptionCodeIllegalPassword | ExceptionCodeRequestWithoutData}
+	tests := []struct {
+		target error
+		want   bool
+	}{
+		{ErrSlaveException, true},
+		{ErrTimeout, false},
+		{&DltError{ExceptionCode: ExceptionCodeIllegalPassword}, true},
+		{&DltError{ExceptionCode: ExceptionCodeRequestWithoutData}, true},
+		{&DltError{ExceptionCode: ExceptionCodeIllegalPassword | ExceptionCodeRequestWithoutData}, true},
+		{&DltError{ExceptionCode: ExceptionCodeIllegalPassword | ExceptionCodeOtherError}, false},
+		{&DltError{ExceptionCode: ExceptionCodeRatesExceedsLimit}, false},
+		{&DltError{FunctionCode: FunctionCodeWriteData, ExceptionCode: ExceptionCodeIllegalPassword}, true},
+		{&DltError{FunctionCode: FunctionCodeReadData, ExceptionCode: ExceptionCodeIllegalPassword}, false},
+		{&DltError{FunctionCode: FunctionCodeWriteData}, true},
+		{&SecurityError{Code: SecurityErrorOther}, false},
+	}
+	for _, test := range tests {
+		if got := errors.Is(err, test.target); got != test.want {
+			t.Errorf("errors.Is(%v, %v) = %v, want %v", err, test.target, got, test.want)
+		}
+	}
+
+	var dltError *DltError
+	if !errors.As(fmt.Errorf("dlt645: read: %w", err), &dltError) || !dltError.Has(ExceptionCodeIllegalPassword) {
+		t.Errorf("errors.As(%v) = %v", err, dltError)
+	}
+	if got, want := dltError.Exceptions(), []byte{ExceptionCodeRequestWithoutData, ExceptionCodeIllegalPassword}; !bytes.Equal(got, want) {
+		t.Errorf("Exceptions() = % x, want % x", got, want)
+	}
+}
+
+func TestSecurityErrorIs(t *testing.T) {
+	err := &SecurityError{Code: SecurityErrorAuthentication | SecurityErrorESAMVerification}
+	tests := []struct {
+		target error
+		want   bool
+	}{
+		{ErrSlaveException, true},
+		{&SecurityError{Code: SecurityErrorAuthentication}, true},
+		{&SecurityError{Code: SecurityErrorAuthentication | SecurityErrorESAMVerification}, true},
+		{&SecurityError{Code: SecurityErrorOther}, false},
+		{&DltError{ExceptionCode: ExceptionCodeOtherError}, false},
+	}
+	for _, test := range tests {
+		if got := errors.Is(err, test.target); got != test.want {
+			t.Errorf("errors.Is(%v, %v) = %v, want %v", err, test.target, got, test.want)
+		}
+	}
+}
+
+func TestTimeoutErrorUnwraps(t *testing.T) {
+	err := fmt.Errorf("dlt645: read: %w", &timeoutError{err: serial.ErrTimeout})
+	if !errors.Is(err, ErrTimeout) || !errors.Is(err, serial.ErrTimeout) || errors.Is(err, ErrMalformedFrame) {
+		t.Errorf("timeout error %v classified wrongly", err)
+	}
+}
@@ -0,0 +1,477 @@
+package dlt645
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	dtuRegisterTimeout = 30 * time.Second
+	dtuTimeout         = 10 * time.Second
+	dtuPacketBuffer    = 16
+	// time to wait for the rest of a heartbeat split across reads
+	dtuHeartbeatTimeout = 100 * time.Millisecond
+)
+
+// DTUServer accepts connections from GPRS/4G DTUs that dial in to the
+// head-end. Each DTU must send a registration packet before any frame is
+// exchanged, the registered connection is then handed back as a DTUHandler.
+type DTUServer struct {
+	// Listen address, e.g. ":9000"
+	Address string
+	// Identify returns the DTU identifier carried in the registration
+	// packet at the start of b and the length n of the packet, n is 0 while
+	// b holds only part of it. Bytes after the packet are passed on to the
+	// handler. By default the packet ends with a line break or NUL byte, or
+	// with the first read, and is trimmed of spaces and NUL bytes.
+	Identify func(b []byte) (id string, n int, err error)
+	// Heartbeat is the heartbeat packet of the DTUs. Heartbeats and
+	// repeated registration packets are removed from the received stream,
+	// also when they arrive together with a frame or split across reads.
+	Heartbeat []byte
+	// OnRegister is called in its own goroutine for every registered DTU.
+	OnRegister func(handler *DTUHandler)
+	// Time allowed between connect and registration packet
+	RegisterTimeout time.Duration
+	// Response timeout of the handlers
+	Timeout time.Duration
+	// Transmission logger
+	Logger *log.Logger
+
+	mu       sync.Mutex
+	listener net.Listener
+	handlers map[string]*DTUHandler
+}
+
+// NewDTUServer allocates a new DTUServer listening on address.
+func NewDTUServer(address string) *DTUServer {
+	return &DTUServer{
+		Address:         address,
+		RegisterTimeout: dtuRegisterTimeout,
+		Timeout:         dtuTimeout,
+	}
+}
+
+// ListenAndServe listens on Address and accepts DTU connections until Close
+// is called.
+func (s *DTUServer) ListenAndServe() error {
+	listener, err := net.Listen("tcp", s.Address)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts DTU connections on listener until Close is called.
+func (s *DTUServer) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	s.listener = listener
+	if s.handlers == nil {
+		s.handlers = make(map[string]*DTUHandler)
+	}
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.listener == nil
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		go s.register(conn)
+	}
+}
+
+// Handler returns the handler of a registered DTU.
+func (s *DTUServer) Handler(id string) (handler *DTUHandler, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	handler, ok = s.handlers[id]
+	return
+}
+
+// Handlers returns the handlers of all registered DTUs.
+func (s *DTUServer) Handlers() (handlers []*DTUHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, handler := range s.handlers {
+		handlers = append(handlers, handler)
+	}
+	return
+}
+
+// Close stops listening and closes all DTU connections.
+func (s *DTUServer) Close() (err error) {
+	s.mu.Lock()
+	listener := s.listener
+	s.listener = nil
+	handlers := s.handlers
+	s.handlers = nil
+	s.mu.Unlock()
+
+	if listener != nil {
+		err = listener.Close()
+	}
+	for _, handler := range handlers {
+		handler.Close()
+	}
+	return
+}
+
+func (s *DTUServer) register(conn net.Conn) {
+	if s.RegisterTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(s.RegisterTimeout))
+	}
+	identify := s.Identify
+	if identify == nil {
+		identify = identifyDTU
+	}
+	var (
+		b   []byte
+		buf [rtuMaxSize]byte
+		id  string
+		n   int
+	)
+	for n == 0 {
+		if len(b) >= rtuMaxSize {
+			s.logf("dlt645: %v sent registration % x longer than '%v' bytes\n", conn.RemoteAddr(), b, rtuMaxSize)
+			conn.Close()
+			return
+		}
+		k, err := conn.Read(buf[:])
+		if err != nil {
+			s.logf("dlt645: %v did not register: %v\n", conn.RemoteAddr(), err)
+			conn.Close()
+			return
+		}
+		b = append(b, buf[:k]...)
+		if id, n, err = identify(b); err != nil {
+			s.logf("dlt645: %v sent invalid registration % x: %v\n", conn.RemoteAddr(), b, err)
+			conn.Close()
+			return
+		}
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	handler := &DTUHandler{}
+	handler.ID = id
+	handler.Timeout = s.Timeout
+	handler.Logger = s.Logger
+	handler.conn = conn
+	handler.heartbeats = [][]byte{b[:n:n]}
+	if len(s.Heartbeat) > 0 {
+		handler.heartbeats = append(handler.heartbeats, s.Heartbeat)
+	}
+	handler.lastActivity = time.Now()
+	handler.packets = make(chan []byte, dtuPacketBuffer)
+	handler.done = make(chan struct{})
+
+	s.mu.Lock()
+	if s.handlers == nil {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	if old, ok := s.handlers[id]; ok {
+		// the DTU reconnected, drop the stale connection
+		old.Close()
+	}
+	s.handlers[id] = handler
+	s.mu.Unlock()
+
+	s.logf("dlt645: DTU '%s' registered from %v\n", id, conn.RemoteAddr())
+	go func() {
+		handler.receive(b[n:])
+		s.mu.Lock()
+		if s.handlers[id] == handler {
+			delete(s.handlers, id)
+		}
+		s.mu.Unlock()
+		s.logf("dlt645: DTU '%s' disconnected\n", id)
+	}()
+	if s.OnRegister != nil {
+		go s.OnRegister(handler)
+	}
+}
+
+func (s *DTUServer) logf(format string, v ...interface{}) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, v...)
+	}
+}
+
+// identifyDTU uses the registration packet itself as identifier. The packet
+// ends with a line break or NUL byte and the padding after it, or with b.
+func identifyDTU(b []byte) (id string, n int, err error) {
+	n = len(b)
+	if k := bytes.IndexAny(b, "\n\x00"); k >= 0 {
+		n = k + 1
+		for n < len(b) && bytes.IndexByte([]byte("\r\n\x00"), b[n]) >= 0 {
+			n++
+		}
+	}
+	id = string(bytes.Trim(b[:n], " \t\r\n\x00"))
+	if id == "" {
+		err = fmt.Errorf("dlt645: empty registration packet")
+	}
+	return
+}
+
+// DTUHandler implements Packager and Transporter interface for a DTU
+// registered on a DTUServer.
+type DTUHandler struct {
+	rtuPackager
+	dtuTransporter
+}
+
+// Meter returns a Client bound to the meter at addr behind the DTU, sharing
+// the connection with every other meter on the bus.
+func (handler *DTUHandler) Meter(addr uint64) Client {
+	return NewMeterClient(handler, addr)
+}
+
+// dtuTransporter implements Transporter interface over an inbound DTU
+// connection.
+type dtuTransporter struct {
+	// Registration identifier of the DTU
+	ID string
+	// Read timeout
+	Timeout time.Duration
+	// Transmission logger
+	Logger *log.Logger
+
+	mu         sync.Mutex
+	conn       net.Conn
+	heartbeats [][]byte
+	packets    chan []byte
+	done       chan struct{}
+	closeOnce  sync.Once
+
+	activityMu   sync.Mutex
+	lastActivity time.Time
+}
+
+// RemoteAddr returns the address the DTU connected from.
+func (dlt *dtuTransporter) RemoteAddr() net.Addr {
+	return dlt.conn.RemoteAddr()
+}
+
+// LastActivity returns when the DTU last sent a packet or heartbeat.
+func (dlt *dtuTransporter) LastActivity() time.Time {
+	dlt.activityMu.Lock()
+	defer dlt.activityMu.Unlock()
+
+	return dlt.lastActivity
+}
+
+// Done returns a channel that is closed when the DTU disconnects.
+func (dlt *dtuTransporter) Done() <-chan struct{} {
+	return dlt.done
+}
+
+// Close closes the DTU connection.
+func (dlt *dtuTransporter) Close() (err error) {
+	dlt.closeOnce.Do(func() {
+		err = dlt.conn.Close()
+	})
+	return
+}
+
+// Send sends data to the DTU and waits for the meter response, heartbeats
+// received meanwhile are discarded.
+func (dlt *dtuTransporter) Send(request []byte) (response []byte, err error) {
+	return dlt.SendContext(context.Background(), request)
+}
+
+// SendContext is like Send but aborts when ctx is done.
+func (dlt *dtuTransporter) SendContext(ctx context.Context, request []byte) (response []byte, err error) {
+	dlt.mu.Lock()
+	defer dlt.mu.Unlock()
+
+	if err = dlt.write(ctx, request); err != nil {
+		return
+	}
+	reader := &packetReader{ctx: ctx, packets: dlt.packets, done: dlt.done}
+	if dlt.Timeout > 0 {
+		reader.timeout = time.After(dlt.Timeout)
+	}
+	if response, err = readFrame(reader); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return
+	}
+
+	dlt.logf("dlt645: received % x\n", response)
+	return
+}
+
+// SendNotResponse sends data to the DTU without waiting for a response.
+func (dlt *dtuTransporter) SendNotResponse(request []byte) (err error) {
+	return dlt.SendNotResponseContext(context.Background(), request)
+}
+
+// SendNotResponseContext is like SendNotResponse but does not write once
+// ctx is done.
+func (dlt *dtuTransporter) SendNotResponseContext(ctx context.Context, request []byte) (err error) {
+	dlt.mu.Lock()
+	defer dlt.mu.Unlock()
+
+	return dlt.write(ctx, request)
+}
+
+func (dlt *dtuTransporter) write(ctx context.Context, request []byte) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	select {
+	case <-dlt.done:
+		err = fmt.Errorf("dlt645: DTU '%s' is disconnected", dlt.ID)
+		return
+	default:
+	}
+	// discard late answers of previous requests
+	for len(dlt.packets) > 0 {
+		dlt.logf("dlt645: discarding % x\n", <-dlt.packets)
+	}
+
+	raw := append([]byte{0xfe, 0xfe, 0xfe, 0xfe}, request...)
+	dlt.logf("dlt645: sending % x\n", raw)
+	if dlt.Timeout > 0 {
+		dlt.conn.SetWriteDeadline(time.Now().Add(dlt.Timeout))
+	}
+	if _, err = dlt.conn.Write(raw); err != nil {
+		dlt.Close()
+	}
+	return
+}
+
+// receive reads from the DTU until the connection is closed, starting with
+// the bytes received after the registration packet. Heartbeats are filtered
+// out before they reach the frame reader.
+func (dlt *dtuTransporter) receive(b []byte) {
+	defer close(dlt.done)
+	defer dlt.Close()
+
+	var buf [rtuMaxSize]byte
+	pending := append([]byte(nil), b...)
+	for {
+		var packet []byte
+		packet, pending = dlt.filter(pending)
+		dlt.queue(packet)
+
+		if len(pending) > 0 {
+			dlt.conn.SetReadDeadline(time.Now().Add(dtuHeartbeatTimeout))
+		}
+		n, err := dlt.conn.Read(buf[:])
+		if len(pending) > 0 {
+			dlt.conn.SetReadDeadline(time.Time{})
+		}
+		if isTimeout(err) {
+			// the rest of the heartbeat never came, so it was none
+			dlt.queue(pending)
+			pending = nil
+			continue
+		}
+		if err != nil {
+			return
+		}
+		pending = append(pending, buf[:n]...)
+
+		dlt.activityMu.Lock()
+		dlt.lastActivity = time.Now()
+		dlt.activityMu.Unlock()
+	}
+}
+
+// filter removes the heartbeats from b. A heartbeat cut off by the end of b
+// is returned in pending until the rest of it arrives.
+func (dlt *dtuTransporter) filter(b []byte) (packet, pending []byte) {
+	for i := 0; i < len(b); {
+		if n := dlt.heartbeat(b[i:]); n > 0 {
+			dlt.logf("dlt645: DTU '%s' heartbeat % x\n", dlt.ID, b[i:i+n])
+			i += n
+			continue
+		}
+		for _, h := range dlt.heartbeats {
+			if bytes.HasPrefix(h, b[i:]) {
+				pending = b[i:]
+				return
+			}
+		}
+		packet = append(packet, b[i])
+		i++
+	}
+	return
+}
+
+// heartbeat returns the length of the heartbeat b starts with, or 0.
+func (dlt *dtuTransporter) heartbeat(b []byte) int {
+	for _, h := range dlt.heartbeats {
+		if bytes.HasPrefix(b, h) {
+			return len(h)
+		}
+	}
+	return 0
+}
+
+// queue passes packet on to the frame reader.
+func (dlt *dtuTransporter) queue(packet []byte) {
+	if len(packet) == 0 {
+		return
+	}
+	select {
+	case dlt.packets <- packet:
+	default:
+		dlt.logf("dlt645: DTU '%s' dropping unsolicited % x\n", dlt.ID, packet)
+	}
+}
+
+func (dlt *dtuTransporter) logf(format string, v ...interface{}) {
+	if dlt.Logger != nil {
+		dlt.Logger.Printf(format, v...)
+	}
+}
+
+// packetReader reads the packets queued by dtuTransporter.receive as a
+// stream.
+type packetReader struct {
+	ctx     context.Context
+	packets <-chan []byte
+	done    <-chan struct{}
+	timeout <-chan time.Time
+	pending []byte
+}
+
+func (r *packetReader) Read(p []byte) (n int, err error) {
+	if len(r.pending) == 0 {
+		select {
+		case r.pending = <-r.packets:
+		case <-r.done:
+			err = io.EOF
+			return
+		case <-r.timeout:
+			err = os.ErrDeadlineExceeded
+			return
+		case <-r.ctx.Done():
+			err = r.ctx.Err()
+			return
+		}
+	}
+	n = copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return
+}
@@ -0,0 +1,278 @@
+package dlt645
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// startDTUServer serves server on a local port until the test ends and
+// returns the address DTUs dial.
+func startDTUServer(t *testing.T, server *DTUServer) (address string, registered chan *DTUHandler) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registered = make(chan *DTUHandler, 4)
+	server.OnRegister = func(handler *DTUHandler) { registered <- handler }
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return listener.Addr().String(), registered
+}
+
+// dialDTU connects to address and sends the registration packet.
+func dialDTU(t *testing.T, address string, registration string) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if _, err = conn.Write([]byte(registration)); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func waitRegistered(t *testing.T, registered chan *DTUHandler) *DTUHandler {
+	t.Helper()
+	select {
+	case handler := <-registered:
+		return handler
+	case <-time.After(time.Second):
+		t.Fatal("DTU not registered")
+		return nil
+	}
+}
+
+func waitDone(t *testing.T, handler *DTUHandler) {
+	t.Helper()
+	select {
+	case <-handler.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("DTU '%s' not disconnected", handler.ID)
+	}
+}
+
+func TestDTUServerHeartbeats(t *testing.T) {
+	tests := []struct {
+		name    string
+		packets [][]byte
+	}{
+		{"separate", [][]byte{[]byte("PING"), []byte("DTU001\r\n"), testReadAnswer}},
+		{"coalesced", [][]byte{append([]byte("PINGDTU001\r\n"), testReadAnswer[:6]...), append(append([]byte(nil), testReadAnswer[6:]...), "PING"...)}},
+		{"split", [][]byte{[]byte("PI"), append([]byte("NGDTU0"), 0x01), []byte("01\r\n"), testReadAnswer}},
+		{"split within a frame", [][]byte{append(append([]byte(nil), testReadAnswer[:10]...), "DT"...), []byte("U001\r\n"), testReadAnswer[10:]}},
+		// a partial heartbeat never completed is passed on
+		{"frame after a partial heartbeat", [][]byte{[]byte("PIN"), testReadAnswer}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := NewDTUServer("")
+			server.Heartbeat = []byte("PING")
+			address, registered := startDTUServer(t, server)
+			conn := dialDTU(t, address, "DTU001\r\n")
+			handler := waitRegistered(t, registered)
+			if handler.ID != "DTU001" {
+				t.Fatalf("id '%s', want DTU001", handler.ID)
+			}
+			if h, ok := server.Handler("DTU001"); !ok || h != handler {
+				t.Fatal("handler not found by id")
+			}
+
+			go func() {
+				if _, err := newFrameScanner(conn).next(); err != nil {
+					return
+				}
+				// heartbeats sent while the meter answers are dropped
+				for _, packet := range test.packets {
+					conn.Write(packet)
+					time.Sleep(20 * time.Millisecond)
+				}
+			}()
+			handler.Timeout = time.Second
+			response, err := handler.Send(testReadRequest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(response, testReadAnswer) {
+				t.Fatalf("response % x, want % x", response, testReadAnswer)
+			}
+			if time.Since(handler.LastActivity()) > time.Second {
+				t.Errorf("last activity %v", handler.LastActivity())
+			}
+		})
+	}
+}
+
+func TestDTUServerHeartbeatsOnly(t *testing.T) {
+	server := NewDTUServer("")
+	server.Heartbeat = []byte("PING")
+	address, registered := startDTUServer(t, server)
+	conn := dialDTU(t, address, "DTU001\r\n")
+	handler := waitRegistered(t, registered)
+
+	conn.Write([]byte("PINGDTU001\r\nPI"))
+	time.Sleep(20 * time.Millisecond)
+	conn.Write([]byte("NG"))
+	time.Sleep(dtuHeartbeatTimeout + 50*time.Millisecond)
+	if len(handler.packets) != 0 {
+		t.Fatalf("heartbeat passed on as % x", <-handler.packets)
+	}
+}
+
+func TestDTUServerRegistration(t *testing.T) {
+	tests := []struct {
+		name         string
+		identify     func(b []byte) (id string, n int, err error)
+		registration []string
+		id           string
+		rest         []byte
+	}{
+		{"line", nil, []string{"DTU001\r\nPING"}, "DTU001", []byte("PING")},
+		{"NUL padded", nil, []string{"DTU001\x00\x00\x00\xfe\xfe"}, "DTU001", []byte{0xfe, 0xfe}},
+		{"fixed length", func(b []byte) (id string, n int, err error) {
+			if len(b) >= 8 {
+				id, n = string(b[:8]), 8
+			}
+			return
+		}, []string{"1234", "5678\xfe\xfe"}, "12345678", []byte{0xfe, 0xfe}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := NewDTUServer("")
+			server.Identify = test.identify
+			address, registered := startDTUServer(t, server)
+			conn := dialDTU(t, address, test.registration[0])
+			for _, packet := range test.registration[1:] {
+				time.Sleep(20 * time.Millisecond)
+				conn.Write([]byte(packet))
+			}
+			handler := waitRegistered(t, registered)
+			if handler.ID != test.id {
+				t.Fatalf("id '%s', want %s", handler.ID, test.id)
+			}
+
+			// bytes after the registration packet reach the handler
+			var rest []byte
+			select {
+			case rest = <-handler.packets:
+			case <-time.After(dtuHeartbeatTimeout + 100*time.Millisecond):
+			}
+			if !bytes.Equal(rest, test.rest) {
+				t.Fatalf("after the registration % x, want % x", rest, test.rest)
+			}
+		})
+	}
+}
+
+func TestDTUServerReconnect(t *testing.T) {
+	server := NewDTUServer("")
+	address, registered := startDTUServer(t, server)
+	dialDTU(t, address, "DTU001")
+	old := waitRegistered(t, registered)
+
+	// the DTU dials in again before the old connection timed out
+	dialDTU(t, address, "DTU001")
+	handler := waitRegistered(t, registered)
+	waitDone(t, old)
+	if h, ok := server.Handler("DTU001"); !ok || h != handler {
+		t.Fatal("reconnected DTU not registered")
+	}
+	if handlers := server.Handlers(); len(handlers) != 1 {
+		t.Fatalf("%d handlers, want 1", len(handlers))
+	}
+}
+
+func TestDTUServerDisconnect(t *testing.T) {
+	server := NewDTUServer("")
+	address, registered := startDTUServer(t, server)
+	conn := dialDTU(t, address, "DTU001")
+	handler := waitRegistered(t, registered)
+
+	conn.Close()
+	waitDone(t, handler)
+	for i := 0; ; i++ {
+		if _, ok := server.Handler("DTU001"); !ok {
+			break
+		}
+		if i == 100 {
+			t.Fatal("disconnected DTU still registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := handler.Send(testReadRequest); err == nil {
+		t.Fatal("request sent to a disconnected DTU")
+	}
+}
+
+func TestDTUServerClose(t *testing.T) {
+	server := NewDTUServer("")
+	address, registered := startDTUServer(t, server)
+	dialDTU(t, address, "DTU001")
+	dialDTU(t, address, "DTU002")
+	handlers := []*DTUHandler{waitRegistered(t, registered), waitRegistered(t, registered)}
+
+	// a request waiting for its answer ends with the connection
+	errs := make(chan error, 1)
+	go func() {
+		_, err := handlers[0].Send(testReadRequest)
+		errs <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	if err := server.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, handler := range handlers {
+		waitDone(t, handler)
+	}
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("request answered after Close")
+		}
+	case <-time.After(time.Second):
+		t.Error("request not ended by Close")
+	}
+	if _, err := net.Dial("tcp", address); err == nil {
+		t.Error("server still listening")
+	}
+}
+
+func TestDTUServerRegisterTimeout(t *testing.T) {
+	server := NewDTUServer("")
+	server.RegisterTimeout = 50 * time.Millisecond
+	address, _ := startDTUServer(t, server)
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the server hangs up on a DTU that never registers
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var b [1]byte
+	if _, err = conn.Read(b[:]); isTimeout(err) {
+		t.Fatal("connection kept open")
+	}
+}
+
+func TestDTUSendContext(t *testing.T) {
+	server := NewDTUServer("")
+	address, registered := startDTUServer(t, server)
+	dialDTU(t, address, "DTU001")
+	handler := waitRegistered(t, registered)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := handler.SendContext(ctx, testReadRequest); err != context.Canceled {
+		t.Fatalf("error %v, want context.Canceled", err)
+	}
+	if err := handler.SendNotResponseContext(ctx, testReadRequest); err != context.Canceled {
+		t.Fatalf("error %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,86 @@
+package dlt645
+
+import "fmt"
+
+// EnergyType is the DI2 byte of energy (DI3 0x00) and maximum demand (DI3
+// 0x01) data identifiers.
+type EnergyType byte
+
+const (
+	EnergyCombinedActive    EnergyType = 0x00 // 组合有功
+	EnergyPositiveActive    EnergyType = 0x01 // 正向有功
+	EnergyReverseActive     EnergyType = 0x02 // 反向有功
+	EnergyCombinedReactive1 EnergyType = 0x03 // 组合无功1
+	EnergyCombinedReactive2 EnergyType = 0x04 // 组合无功2
+	EnergyQuadrant1Reactive EnergyType = 0x05 // 第一象限无功
+	EnergyQuadrant2Reactive EnergyType = 0x06 // 第二象限无功
+	EnergyQuadrant3Reactive EnergyType = 0x07 // 第三象限无功
+	EnergyQuadrant4Reactive EnergyType = 0x08 // 第四象限无功
+	EnergyPositiveApparent  EnergyType = 0x09 // 正向视在
+	EnergyReverseApparent   EnergyType = 0x0A // 反向视在
+)
+
+// maximum settlement period, the last 12 settlement days are kept
+const maxSettlementPeriod = 12
+
+func (t EnergyType) String() string {
+	if kind, ok := energyTypes[byte(t)]; ok {
+		return kind.name
+	}
+	return fmt.Sprintf("energy type %02x", byte(t))
+}
+
+// Energy is the energy of one type, the total and the tariffs 1..N.
+type Energy struct {
+	Type EnergyType
+	// Period is 0 for the current energy, 1..12 for the last settlement days
+	Period  uint8
+	Unit    string
+	Total   float64
+	Tariffs []float64
+}
+
+// ReadEnergy reads the energy block of kind for period, 0 is the current
+// energy, 1..12 the energy frozen at the last settlement days.
+func (d *Device) ReadEnergy(kind EnergyType, period uint8) (energy *Energy, err error) {
+	if period > maxSettlementPeriod {
+		err = fmt.Errorf("dlt645: settlement period '%v' must be between '0' and '%v'", period, maxSettlementPeriod)
+		return
+	}
+	if energyIdentifier(uint32(kind)<<16) == nil {
+		err = fmt.Errorf("dlt645: unknown energy type '%02x'", byte(kind))
+		return
+	}
+	data, err := d.ReadRaw(uint32(kind)<<16 | 0xFF00 | uint32(period))
+	if err != nil {
+		return
+	}
+	if energy, err = decodeEnergy(kind, data); err != nil {
+		return
+	}
+	energy.Period = period
+	return
+}
+
+// decodeEnergy decodes the total and tariff energies of an energy block.
+func decodeEnergy(kind EnergyType, data []byte) (energy *Energy, err error) {
+	di := energyIdentifier(uint32(kind)<<16 | 0xFF00)
+	if di == nil {
+		err = fmt.Errorf("dlt645: unknown energy type '%02x'", byte(kind))
+		return
+	}
+	value, err := di.Decode(data)
+	if err != nil {
+		return
+	}
+
+	energy = &Energy{Type: kind, Unit: di.Fields[0].Unit}
+	for i, item := range value.Items {
+		if i == 0 {
+			energy.Total = item.Number
+		} else {
+			energy.Tariffs = append(energy.Tariffs, item.Number)
+		}
+	}
+	return
+}
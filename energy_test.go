@@ -0,0 +1,65 @@
+package dlt645
+
+import (
+	"reflect"
+	"testing"
+)
+
+// newSimulatedDevice returns a device reading the simulated meter
+// 304257140001 serving store.
+func newSimulatedDevice(t *testing.T, store *MemoryStore) *Device {
+	return NewDevice(newSimulatedSerialHandler(t, NewServer(304257140001, store)).Meter(304257140001))
+}
+
+// blockData concatenates the transmitted digits of the items of a block.
+func blockData(digits ...string) (data []byte) {
+	for _, d := range digits {
+		data = append(data, transmitted(d)...)
+	}
+	return
+}
+
+func TestReadEnergySimulator(t *testing.T) {
+	store := NewMemoryStore()
+	store.Write(0x0001FF00, blockData("00123456", "00010000", "00020000", "00030000", "00003456"))
+	store.Write(0x0001FF01, blockData("00120000", "00120000"))
+	store.Write(0x0000FF00, blockData("80000150", "80000150"))
+	store.Write(0x0002FF00, blockData("001234"))
+	device := newSimulatedDevice(t, store)
+
+	tests := []struct {
+		kind   EnergyType
+		period uint8
+		want   *Energy
+	}{
+		{EnergyPositiveActive, 0, &Energy{Type: EnergyPositiveActive, Unit: "kWh", Total: 1234.56, Tariffs: []float64{100, 200, 300, 34.56}}},
+		{EnergyPositiveActive, 1, &Energy{Type: EnergyPositiveActive, Period: 1, Unit: "kWh", Total: 1200, Tariffs: []float64{1200}}},
+		{EnergyCombinedActive, 0, &Energy{Type: EnergyCombinedActive, Unit: "kWh", Total: -1.5, Tariffs: []float64{-1.5}}},
+	}
+	for _, test := range tests {
+		energy, err := device.ReadEnergy(test.kind, test.period)
+		if err != nil {
+			t.Errorf("%v period %d: %v", test.kind, test.period, err)
+			continue
+		}
+		if !reflect.DeepEqual(energy, test.want) {
+			t.Errorf("%v period %d = %+v, want %+v", test.kind, test.period, energy, test.want)
+		}
+	}
+
+	if _, err := device.ReadEnergy(EnergyReverseActive, 0); err == nil {
+		t.Error("energy block of 3 bytes decoded")
+	}
+	if _, err := device.ReadEnergy(EnergyQuadrant1Reactive, 0); exceptionCode(err) != ExceptionCodeRequestWithoutData {
+		t.Errorf("energy without data: error %v", err)
+	}
+	if _, err := device.ReadEnergy(EnergyPositiveActive, 13); err == nil {
+		t.Error("settlement period 13 read")
+	}
+	if _, err := device.ReadEnergy(0x0B, 0); err == nil {
+		t.Error("unknown energy type read")
+	}
+	if s := EnergyCombinedReactive1.String(); s != "combined reactive 1" {
+		t.Errorf("energy type name %q", s)
+	}
+}
@@ -0,0 +1,324 @@
+package dlt645
+
+import (
+	"fmt"
+	"time"
+)
+
+// maximum number of records kept for an event class
+const eventRecords = 10
+
+// EventClass describes the counter and the records of one kind of event.
+//
+// Record n (1 is the last one) is read with RecordMarker + n - 1. Fields
+// describe the record as far as it is decoded, data beyond them is kept
+// raw. The fields named "start", "end" and "operator" fill the fields of
+// the same name of EventRecord.
+type EventClass struct {
+	Name         string
+	CountMarker  uint32
+	RecordMarker uint32
+	Fields       []Field
+}
+
+// event record field roles
+const (
+	eventStart    = "start"
+	eventEnd      = "end"
+	eventOperator = "operator"
+)
+
+var (
+	eventStartField    = Field{Name: eventStart, Layout: "YYMMDDhhmmss"}
+	eventEndField      = Field{Name: eventEnd, Layout: "YYMMDDhhmmss"}
+	eventOperatorField = Field{Name: eventOperator, Layout: "HEX", Length: 4}
+)
+
+// Standard event classes of the 0x03 identifiers.
+var (
+	EventPowerDown = &EventClass{
+		Name: "power down", CountMarker: 0x03110000, RecordMarker: 0x03110001,
+		Fields: []Field{eventStartField, eventEndField},
+	}
+	EventProgramming = &EventClass{
+		Name: "programming", CountMarker: 0x03300000, RecordMarker: 0x03300001,
+		Fields: []Field{eventStartField, eventOperatorField, {Name: "data identifiers", Layout: "HEX", Length: 40}},
+	}
+	EventMeterClear = &EventClass{
+		Name: "meter clear", CountMarker: 0x03300100, RecordMarker: 0x03300101,
+		Fields: concatFields([]Field{eventStartField, eventOperatorField},
+			energyFields(""), energyFields("A "), energyFields("B "), energyFields("C ")),
+	}
+	EventDemandClear = &EventClass{
+		Name: "demand clear", CountMarker: 0x03300200, RecordMarker: 0x03300201,
+		Fields: concatFields([]Field{eventStartField, eventOperatorField},
+			demandFields(""), demandFields("A "), demandFields("B "), demandFields("C ")),
+	}
+	EventEventClear = &EventClass{
+		Name: "event clear", CountMarker: 0x03300300, RecordMarker: 0x03300301,
+		Fields: []Field{eventStartField, eventOperatorField, {Name: "data identifier", Layout: "HEX", Length: 4}},
+	}
+	// start is the clock before, end the clock after the timing
+	EventTiming = &EventClass{
+		Name: "timing", CountMarker: 0x03300400, RecordMarker: 0x03300401,
+		Fields: []Field{eventOperatorField, eventStartField, eventEndField},
+	}
+	EventMeterCoverOpen = &EventClass{
+		Name: "meter cover open", CountMarker: 0x03300D00, RecordMarker: 0x03300D01,
+		Fields: concatFields([]Field{eventStartField, eventEndField}, energyFields("before "), energyFields("after ")),
+	}
+	EventTerminalCoverOpen = &EventClass{
+		Name: "terminal cover open", CountMarker: 0x03300E00, RecordMarker: 0x03300E01,
+		Fields: concatFields([]Field{eventStartField, eventEndField}, energyFields("before "), energyFields("after ")),
+	}
+)
+
+// Standard event classes of the 0x10..0x1F identifiers, phase events are
+// returned by PhaseEvent.
+var (
+	EventVoltageReverseSequence = newEventClass(0x14, 0, "voltage reverse sequence")
+	EventCurrentReverseSequence = newEventClass(0x15, 0, "current reverse sequence")
+	EventVoltageImbalance       = newEventClass(0x16, 0, "voltage imbalance")
+	EventCurrentImbalance       = newEventClass(0x17, 0, "current imbalance")
+	EventRelayTrip              = &EventClass{
+		Name: "relay trip", CountMarker: 0x1D000001, RecordMarker: 0x1D00FF01,
+		Fields: concatFields([]Field{eventStartField, eventOperatorField}, energyFields("")),
+	}
+	EventRelayClose = &EventClass{
+		Name: "relay close", CountMarker: 0x1E000001, RecordMarker: 0x1E00FF01,
+		Fields: concatFields([]Field{eventStartField, eventOperatorField}, energyFields("")),
+	}
+	EventPowerFactorLow = newEventClass(0x1F, 0, "total power factor below limit")
+)
+
+// phase event kinds, the DI3 byte of their identifiers
+const (
+	PhaseEventLossOfVoltage = 0x10
+	PhaseEventUnderVoltage  = 0x11
+	PhaseEventOverVoltage   = 0x12
+	PhaseEventPhaseFailure  = 0x13
+	PhaseEventLossOfCurrent = 0x18
+	PhaseEventOverCurrent   = 0x19
+	PhaseEventCurrentBreak  = 0x1A
+	PhaseEventPowerReverse  = 0x1B
+	PhaseEventOverload      = 0x1C
+)
+
+var phaseEventNames = map[byte]string{
+	PhaseEventLossOfVoltage: "loss of voltage",
+	PhaseEventUnderVoltage:  "under voltage",
+	PhaseEventOverVoltage:   "over voltage",
+	PhaseEventPhaseFailure:  "phase failure",
+	PhaseEventLossOfCurrent: "loss of current",
+	PhaseEventOverCurrent:   "over current",
+	PhaseEventCurrentBreak:  "current break",
+	PhaseEventPowerReverse:  "power reverse",
+	PhaseEventOverload:      "overload",
+}
+
+// PhaseEvent returns the event class of kind for phase 1..3 (A, B, C).
+func PhaseEvent(kind byte, phase uint8) (class *EventClass, err error) {
+	name, ok := phaseEventNames[kind]
+	if !ok {
+		err = fmt.Errorf("dlt645: unknown phase event '%02x'", kind)
+		return
+	}
+	if phase < 1 || phase > 3 {
+		err = fmt.Errorf("dlt645: phase '%v' must be between '1' and '3'", phase)
+		return
+	}
+	class = newEventClass(kind, phase, fmt.Sprintf("%c phase %s", 'A'+phase-1, name))
+	return
+}
+
+// newEventClass describes the events DI3 = kind, DI2 = phase, counted by
+// DI1 DI0 = 0x0001 and recorded in the blocks DI1 = 0xFF.
+func newEventClass(kind byte, phase uint8, name string) *EventClass {
+	base := uint32(kind)<<24 | uint32(phase)<<16
+	return &EventClass{
+		Name:         name,
+		CountMarker:  base | 0x0001,
+		RecordMarker: base | 0xFF01,
+		Fields:       eventFields(kind),
+	}
+}
+
+// eventFields describes the records of the events DI3 = kind. They keep the
+// energies at the start and at the end, the voltage and current events also
+// the voltages, currents, powers and power factors at the start.
+func eventFields(kind byte) []Field {
+	start := concatFields([]Field{eventStartField}, eventEnergyFields("start "))
+	end := concatFields([]Field{eventEndField}, eventEnergyFields("end "))
+	if kind == 0x1F { // total power factor below limit
+		return concatFields(start, end)
+	}
+	var during []Field
+	quantities := true
+	switch kind {
+	case PhaseEventLossOfVoltage, PhaseEventUnderVoltage, PhaseEventOverVoltage, PhaseEventPhaseFailure:
+		during = []Field{
+			{Name: "ampere-hours", Layout: "XXXXXX.XX", Unit: "Ah"},
+			{Name: "A ampere-hours", Layout: "XXXXXX.XX", Unit: "Ah"},
+			{Name: "B ampere-hours", Layout: "XXXXXX.XX", Unit: "Ah"},
+			{Name: "C ampere-hours", Layout: "XXXXXX.XX", Unit: "Ah"},
+		}
+	case 0x14, 0x15: // reverse sequences
+		quantities = false
+	case 0x16, 0x17: // imbalances
+		quantities = false
+		during = []Field{{Name: "maximum imbalance rate", Layout: "XX.XX", Unit: "%"}}
+	}
+	for _, phase := range []string{"A ", "B ", "C "} {
+		start = concatFields(start, eventEnergyFields("start "+phase))
+		if quantities {
+			start = concatFields(start, phaseQuantityFields("start "+phase))
+		}
+		end = concatFields(end, eventEnergyFields("end "+phase))
+	}
+	return concatFields(start, during, end)
+}
+
+// EventRecord is one decoded event record.
+type EventRecord struct {
+	Class *EventClass
+	// N is the number of the record, 1 is the last one
+	N        int
+	Start    time.Time
+	End      time.Time
+	Operator string
+	Items    []Item
+	// Raw is the record data, including what is not decoded
+	Raw []byte
+}
+
+// Item returns the item of the given name, e.g. "start A voltage".
+func (r *EventRecord) Item(name string) (item Item, ok bool) {
+	for _, item = range r.Items {
+		if item.Name == name {
+			return item, true
+		}
+	}
+	return Item{}, false
+}
+
+// ReadEventCount reads the number of events of class.
+func (d *Device) ReadEventCount(class *EventClass) (count int, err error) {
+	data, err := d.ReadRaw(class.CountMarker)
+	if err != nil {
+		return
+	}
+	if len(data) < 3 {
+		err = fmt.Errorf("dlt645: event count length '%v' does not meet minimum '3'", len(data))
+		return
+	}
+	n, err := decodeBCD(data[:3])
+	count = int(n)
+	return
+}
+
+// ReadEvents reads the last n records of class, the last one first. It
+// stops at the first empty record.
+func (d *Device) ReadEvents(class *EventClass, n int) (records []*EventRecord, err error) {
+	if n < 1 || n > eventRecords {
+		err = fmt.Errorf("dlt645: event record count '%v' must be between '1' and '%v'", n, eventRecords)
+		return
+	}
+	for i := 1; i <= n; i++ {
+		var data []byte
+		if data, err = d.ReadRaw(class.RecordMarker + uint32(i-1)); err != nil {
+			if isRequestWithoutData(err) {
+				err = nil
+			}
+			return
+		}
+		var record *EventRecord
+		if record, err = class.Decode(data); err != nil {
+			return
+		}
+		if record.Start.IsZero() && record.End.IsZero() {
+			return
+		}
+		record.N = i
+		records = append(records, record)
+	}
+	return
+}
+
+// Decode decodes the data of an event record.
+func (class *EventClass) Decode(data []byte) (record *EventRecord, err error) {
+	record = &EventRecord{Class: class, Raw: data}
+	rest := data
+	for _, field := range class.Fields {
+		n := field.length()
+		if len(rest) < n {
+			break
+		}
+		var item Item
+		if item, err = field.decode(rest[:n]); err != nil {
+			err = fmt.Errorf("dlt645: event '%s' field '%s': %w", class.Name, field.Name, err)
+			return
+		}
+		rest = rest[n:]
+		record.Items = append(record.Items, item)
+		switch field.Name {
+		case eventStart:
+			record.Start = item.Time
+		case eventEnd:
+			record.End = item.Time
+		case eventOperator:
+			record.Operator = item.Text
+		}
+	}
+	return
+}
+
+// energyFields describes the total energies kept with events: positive and
+// reverse active, reactive of the quadrants I to IV.
+func energyFields(prefix string) (fields []Field) {
+	for _, kind := range []byte{0x01, 0x02, 0x05, 0x06, 0x07, 0x08} {
+		energy := energyTypes[kind]
+		fields = append(fields, Field{Name: prefix + energy.name + " energy", Layout: "XXXXXX.XX", Unit: energy.unit})
+	}
+	return
+}
+
+// eventEnergyFields describes the energies kept with the 0x10..0x1F events:
+// positive and reverse active, combined reactive 1 and 2.
+func eventEnergyFields(prefix string) (fields []Field) {
+	for _, kind := range []byte{0x01, 0x02, 0x03, 0x04} {
+		energy := energyTypes[kind]
+		fields = append(fields, Field{Name: prefix + energy.name + " energy", Layout: "XXXXXX.XX", Signed: energy.signed, Unit: energy.unit})
+	}
+	return
+}
+
+// phaseQuantityFields describes the voltage, current, powers and power factor
+// of a phase.
+func phaseQuantityFields(prefix string) []Field {
+	return []Field{
+		{Name: prefix + "voltage", Layout: "XXX.X", Unit: "V"},
+		{Name: prefix + "current", Layout: "XXX.XXX", Signed: true, Unit: "A"},
+		{Name: prefix + "active power", Layout: "XX.XXXX", Signed: true, Unit: "kW"},
+		{Name: prefix + "reactive power", Layout: "XX.XXXX", Signed: true, Unit: "kvar"},
+		{Name: prefix + "power factor", Layout: "X.XXX", Signed: true},
+	}
+}
+
+// demandFields is like energyFields for maximum demands and their times.
+func demandFields(prefix string) (fields []Field) {
+	for _, kind := range []byte{0x01, 0x02, 0x05, 0x06, 0x07, 0x08} {
+		energy := energyTypes[kind]
+		fields = append(fields,
+			Field{Name: prefix + energy.name + " maximum demand", Layout: "XX.XXXX", Unit: demandUnits[energy.unit]},
+			Field{Name: prefix + energy.name + " maximum demand time", Layout: "YYMMDDhhmm"},
+		)
+	}
+	return
+}
+
+func concatFields(lists ...[]Field) (fields []Field) {
+	for _, list := range lists {
+		fields = append(fields, list...)
+	}
+	return
+}
@@ -0,0 +1,276 @@
+package dlt645
+
+import (
+	"testing"
+	"time"
+)
+
+// eventRecord builds a record of class from the digits of the named fields,
+// the other fields are zero.
+func eventRecord(t *testing.T, class *EventClass, digits map[string]string) (data []byte) {
+	t.Helper()
+	used := 0
+	for _, field := range class.Fields {
+		d, ok := digits[field.Name]
+		if !ok {
+			data = append(data, make([]byte, field.length())...)
+			continue
+		}
+		if len(d) != 2*field.length() {
+			t.Fatalf("field %q has %d bytes, digits %s", field.Name, field.length(), d)
+		}
+		data = append(data, transmitted(d)...)
+		used++
+	}
+	if used != len(digits) {
+		t.Fatalf("%d of the %d fields given are not in the records of %s", len(digits)-used, len(digits), class.Name)
+	}
+	return
+}
+
+func TestPhaseEvent(t *testing.T) {
+	class, err := PhaseEvent(PhaseEventLossOfVoltage, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if class.Name != "B phase loss of voltage" || class.CountMarker != 0x10020001 || class.RecordMarker != 0x1002FF01 {
+		t.Errorf("class %+v", class)
+	}
+	if _, err = PhaseEvent(PhaseEventOverload, 4); err == nil {
+		t.Error("phase 4 accepted")
+	}
+	if _, err = PhaseEvent(0x14, 1); err == nil {
+		t.Error("reverse sequence taken for a phase event")
+	}
+}
+
+func TestDecodeEventRecord(t *testing.T) {
+	data := eventRecord(t, EventMeterClear, map[string]string{
+		"start":                         "240506070809",
+		"operator":                      "11223344",
+		"positive active energy":        "00123456",
+		"C quadrant IV reactive energy": "00000042",
+	})
+	// data beyond the fields is kept raw
+	data = append(data, 0x01, 0x02)
+	record, err := EventMeterClear.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 5, 6, 7, 8, 9, 0, time.Local); !record.Start.Equal(want) || !record.End.IsZero() {
+		t.Errorf("start %v end %v, want %v and none", record.Start, record.End, want)
+	}
+	if record.Operator != "11223344" {
+		t.Errorf("operator %q, want 11223344", record.Operator)
+	}
+	if len(record.Items) != len(EventMeterClear.Fields) || len(record.Raw) != len(data) {
+		t.Fatalf("%d items, %d raw bytes", len(record.Items), len(record.Raw))
+	}
+	if item := record.Items[2]; item.Name != "positive active energy" || item.Number != 1234.56 || item.Unit != "kWh" {
+		t.Errorf("first energy %+v", item)
+	}
+	if item := record.Items[len(record.Items)-1]; item.Name != "C quadrant IV reactive energy" || item.Number != 0.42 {
+		t.Errorf("last energy %+v", item)
+	}
+
+	// a short record decodes as far as it goes
+	if record, err = EventPowerDown.Decode(transmitted("240506070809")); err != nil || record.Start.IsZero() || len(record.Items) != 1 {
+		t.Errorf("short record %+v, error %v", record, err)
+	}
+	if _, err = EventPowerDown.Decode([]byte{0x09, 0x08, 0x07, 0x6A, 0x05, 0x24}); err == nil {
+		t.Error("invalid start time decoded")
+	}
+}
+
+func TestEventRecordLengths(t *testing.T) {
+	phaseEvent := func(kind byte, phase uint8) *EventClass {
+		class, err := PhaseEvent(kind, phase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return class
+	}
+	tests := []struct {
+		class *EventClass
+		want  int
+	}{
+		{phaseEvent(PhaseEventLossOfVoltage, 1), 195},
+		{phaseEvent(PhaseEventUnderVoltage, 2), 195},
+		{phaseEvent(PhaseEventOverVoltage, 3), 195},
+		{phaseEvent(PhaseEventPhaseFailure, 1), 195},
+		{phaseEvent(PhaseEventLossOfCurrent, 1), 179},
+		{phaseEvent(PhaseEventOverCurrent, 2), 179},
+		{phaseEvent(PhaseEventCurrentBreak, 3), 179},
+		{phaseEvent(PhaseEventPowerReverse, 1), 179},
+		{phaseEvent(PhaseEventOverload, 1), 179},
+		{EventVoltageReverseSequence, 140},
+		{EventCurrentReverseSequence, 140},
+		{EventVoltageImbalance, 142},
+		{EventCurrentImbalance, 142},
+		{EventPowerFactorLow, 44},
+	}
+	for _, test := range tests {
+		di := &DataIdentifier{Fields: test.class.Fields}
+		if got := di.Length(); got != test.want {
+			t.Errorf("%s: record length %d, want %d", test.class.Name, got, test.want)
+		}
+	}
+}
+
+func TestDecodePhaseEventRecord(t *testing.T) {
+	class, err := PhaseEvent(PhaseEventLossOfVoltage, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := eventRecord(t, class, map[string]string{
+		"start":                            "240506070809",
+		"start positive active energy":     "00123456",
+		"start combined reactive 1 energy": "80001234",
+		"start A positive active energy":   "00041152",
+		"start A voltage":                  "0125",
+		"start A current":                  "001234",
+		"start A active power":             "000123",
+		"start A power factor":             "0998",
+		"start B current":                  "801000",
+		"start B reactive power":           "800010",
+		"start C power factor":             "8500",
+		"start C reverse active energy":    "00000101",
+		"A ampere-hours":                   "00000350",
+		"end":                              "240506093000",
+		"end positive active energy":       "00123500",
+		"end A positive active energy":     "00041200",
+		"end C positive active energy":     "00042376",
+		"end C combined reactive 2 energy": "00000042",
+	})
+	if len(data) != 195 {
+		t.Fatalf("record length %d, want 195", len(data))
+	}
+	record, err := class.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(record.Items) != len(class.Fields) {
+		t.Fatalf("%d items decoded, want %d", len(record.Items), len(class.Fields))
+	}
+	if want := time.Date(2024, 5, 6, 7, 8, 9, 0, time.Local); !record.Start.Equal(want) {
+		t.Errorf("start %v, want %v", record.Start, want)
+	}
+	if want := time.Date(2024, 5, 6, 9, 30, 0, 0, time.Local); !record.End.Equal(want) {
+		t.Errorf("end %v, want %v", record.End, want)
+	}
+	items := []struct {
+		name string
+		want float64
+		unit string
+	}{
+		{"start positive active energy", 1234.56, "kWh"},
+		{"start combined reactive 1 energy", -12.34, "kvarh"},
+		{"start A positive active energy", 411.52, "kWh"},
+		{"start A voltage", 12.5, "V"},
+		{"start A current", 1.234, "A"},
+		{"start A active power", 0.0123, "kW"},
+		{"start A power factor", 0.998, ""},
+		{"start B current", -1, "A"},
+		{"start B reactive power", -0.001, "kvar"},
+		{"start C power factor", -0.5, ""},
+		{"start C reverse active energy", 1.01, "kWh"},
+		{"A ampere-hours", 3.5, "Ah"},
+		{"end positive active energy", 1235, "kWh"},
+		{"end A positive active energy", 412, "kWh"},
+		{"end C positive active energy", 423.76, "kWh"},
+		{"end C combined reactive 2 energy", 0.42, "kvarh"},
+	}
+	for _, test := range items {
+		item, ok := record.Item(test.name)
+		if !ok {
+			t.Errorf("item %q missing", test.name)
+			continue
+		}
+		if item.Number != test.want || item.Unit != test.unit {
+			t.Errorf("%s = %v %s, want %v %s", test.name, item.Number, item.Unit, test.want, test.unit)
+		}
+	}
+}
+
+func TestDecodeImbalanceEventRecord(t *testing.T) {
+	data := eventRecord(t, EventCurrentImbalance, map[string]string{
+		"start":                          "240506070809",
+		"start B positive active energy": "00040000",
+		"maximum imbalance rate":         "4567",
+		"end":                            "240506071500",
+		"end C reverse active energy":    "00000102",
+	})
+	record, err := EventCurrentImbalance.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(record.Items) != len(EventCurrentImbalance.Fields) || record.End.IsZero() {
+		t.Fatalf("record %+v not decoded to the end", record)
+	}
+	for name, want := range map[string]float64{
+		"start B positive active energy": 400,
+		"maximum imbalance rate":         45.67,
+		"end C reverse active energy":    1.02,
+	} {
+		if item, ok := record.Item(name); !ok || item.Number != want {
+			t.Errorf("%s = %v, want %v", name, item.Number, want)
+		}
+	}
+	if _, ok := record.Item("start A voltage"); ok {
+		t.Error("imbalance records keep no voltages")
+	}
+}
+
+func TestReadEventsSimulator(t *testing.T) {
+	class, err := PhaseEvent(PhaseEventOverCurrent, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewMemoryStore()
+	store.Write(class.CountMarker, transmitted("000002"))
+	store.Write(class.RecordMarker, eventRecord(t, class, map[string]string{
+		"start":                      "240506070809",
+		"start B current":            "012345",
+		"end":                        "240506071000",
+		"end positive active energy": "00123500",
+	}))
+	store.Write(class.RecordMarker+1, eventRecord(t, class, map[string]string{
+		"start": "240501000000",
+		"end":   "240501001500",
+	}))
+	// record 3 never happened, the meter keeps it zero
+	store.Write(class.RecordMarker+2, eventRecord(t, class, nil))
+	device := NewDevice(newSimulatedSerialHandler(t, NewServer(304257140001, store)).Meter(304257140001))
+
+	count, err := device.ReadEventCount(class)
+	if err != nil || count != 2 {
+		t.Fatalf("count %d, error %v", count, err)
+	}
+	records, err := device.ReadEvents(class, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("%d records, want 2", len(records))
+	}
+	if want := time.Date(2024, 5, 6, 7, 10, 0, 0, time.Local); records[0].N != 1 || !records[0].End.Equal(want) {
+		t.Errorf("record %d ends %v, want 1 ending %v", records[0].N, records[0].End, want)
+	}
+	if item, _ := records[0].Item("start B current"); item.Number != 12.345 {
+		t.Errorf("start B current %v, want 12.345", item.Number)
+	}
+	if item, _ := records[0].Item("end positive active energy"); item.Number != 1235 {
+		t.Errorf("end positive active energy %v, want 1235", item.Number)
+	}
+	if want := time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local); records[1].N != 2 || !records[1].Start.Equal(want) {
+		t.Errorf("record %d starts %v, want 2 starting %v", records[1].N, records[1].Start, want)
+	}
+
+	// a meter keeping fewer records answers without data
+	if records, err = device.ReadEvents(EventTiming, 3); err != nil || len(records) != 0 {
+		t.Errorf("records %v, error %v, want none", records, err)
+	}
+	if _, err = device.ReadEvents(EventPowerDown, 11); err == nil {
+		t.Error("11 records read")
+	}
+}
@@ -0,0 +1,142 @@
+package dlt645
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/xgbt/dlt645-go/utils"
+)
+
+// frameScanner splits a byte stream into frames. Wake-up preambles (0xFE),
+// echoes and line noise in front of a frame are skipped: a candidate starts
+// at a 0x68 followed by six address bytes and a second 0x68, takes L+12
+// bytes and must end with 0x16 and a matching checksum. A candidate failing
+// any check is dropped one byte at a time, so a frame starting inside it is
+// still found.
+type frameScanner struct {
+	r   io.Reader
+	buf []byte
+	// bytes other than the preamble skipped since the last frame
+	noise []byte
+	// complete candidates dropped since the last frame, and how many of
+	// them only failed the checksum
+	candidates   int
+	badChecksums int
+}
+
+func newFrameScanner(r io.Reader) *frameScanner {
+	return &frameScanner{r: r}
+}
+
+// next returns the next valid frame. The read error ending the stream is
+// returned as it is if nothing but the preamble was received. Otherwise it
+// is reported as ErrChecksum if every complete candidate only failed the
+// checksum, as ErrMalformedFrame else, so a garbled answer is never taken
+// for silence.
+func (s *frameScanner) next() (frame []byte, err error) {
+	for {
+		if frame = s.scan(); frame != nil {
+			return
+		}
+		if err = s.fill(); err != nil {
+			// the stream ended inside a candidate, a frame may still start
+			// after its head
+			for len(s.buf) > 0 {
+				s.skip()
+				if frame = s.scan(); frame != nil {
+					err = nil
+					return
+				}
+			}
+			if len(s.noise) > 0 {
+				class := ErrMalformedFrame
+				if s.badChecksums > 0 && s.badChecksums == s.candidates {
+					class = ErrChecksum
+				}
+				err = fmt.Errorf("%w: no frame in % x: %v", class, s.noise, err)
+				s.noise = nil
+				s.candidates, s.badChecksums = 0, 0
+			}
+			return
+		}
+	}
+}
+
+// scan cuts the first valid frame off the buffer, nil if more bytes are
+// needed.
+func (s *frameScanner) scan() (frame []byte) {
+	for len(s.buf) > 0 {
+		if s.buf[0] != FrameHead {
+			s.skip()
+			continue
+		}
+		if len(s.buf) < 8 {
+			return
+		}
+		if s.buf[7] != FrameHead {
+			s.skip()
+			continue
+		}
+		if len(s.buf) < rtuMinSize {
+			return
+		}
+		length := rtuMinSize + int(s.buf[9]) + 2
+		if length > rtuMaxSize {
+			s.skip()
+			continue
+		}
+		if len(s.buf) < length {
+			return
+		}
+		if s.buf[length-1] != FrameTail {
+			s.candidates++
+			s.skip()
+			continue
+		}
+		if utils.GenerateCheckSum(s.buf[:length-2]) != s.buf[length-2] {
+			s.candidates++
+			s.badChecksums++
+			s.skip()
+			continue
+		}
+		frame = append([]byte(nil), s.buf[:length]...)
+		s.buf = s.buf[length:]
+		s.noise = nil
+		s.candidates, s.badChecksums = 0, 0
+		return
+	}
+	return
+}
+
+// skip drops the first buffered byte.
+func (s *frameScanner) skip() {
+	if s.buf[0] != 0xfe && len(s.noise) < rtuMaxSize {
+		s.noise = append(s.noise, s.buf[0])
+	}
+	s.buf = s.buf[1:]
+}
+
+// fill appends the bytes of the next read to the buffer.
+func (s *frameScanner) fill() (err error) {
+	var data [rtuMaxSize]byte
+	n, err := s.r.Read(data[:])
+	s.buf = append(s.buf, data[:n]...)
+	if n > 0 {
+		err = nil
+	}
+	return
+}
+
+// readFrame reads the response frame from r. Frames sent by a master, like
+// the echo of the request on some RS485 adapters, are skipped.
+func readFrame(r io.Reader) (frame []byte, err error) {
+	scanner := newFrameScanner(r)
+	for {
+		if frame, err = scanner.next(); err != nil {
+			return
+		}
+		if frame[8]&0x80 != 0 {
+			return
+		}
+	}
+}
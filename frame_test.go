@@ -0,0 +1,81 @@
+package dlt645
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func testResponse() []byte {
+	return encodeFrame(addressToDataDomain(304257140001), 0x91, []byte{0x00, 0x00, 0x00, 0x00, 0x12, 0x34, 0x56, 0x00})
+}
+
+func TestFrameScannerResynchronises(t *testing.T) {
+	frame := testResponse()
+	echo := encodeFrame(addressToDataDomain(304257140001), FunctionCodeReadData, []byte{0, 0, 0, 0})
+	badChecksum := append([]byte(nil), frame...)
+	badChecksum[len(badChecksum)-2]++
+
+	tests := []struct {
+		name   string
+		chunks [][]byte
+	}{
+		{"plain", [][]byte{frame}},
+		{"preamble", [][]byte{{0xfe, 0xfe, 0xfe, 0xfe}, frame}},
+		{"noise", [][]byte{{0x00, 0x68, 0x12}, frame}},
+		{"split", [][]byte{frame[:3], frame[3:11], frame[11:]}},
+		{"echo", [][]byte{echo, frame}},
+		{"bad checksum", [][]byte{badChecksum, frame}},
+		// the length of the first candidate runs past the end of the stream
+		{"truncated candidate", [][]byte{append([]byte{0x68, 0x01, 0x00, 0x14, 0x57, 0x42, 0x30, 0x68, 0x91, 0x40}, frame...)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := readFrame(&chunkReader{chunks: test.chunks, err: io.EOF})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(response, frame) {
+				t.Fatalf("frame % x, want % x", response, frame)
+			}
+		})
+	}
+}
+
+func TestFrameScannerErrorClass(t *testing.T) {
+	frame := testResponse()
+	badChecksum := append([]byte(nil), frame...)
+	badChecksum[len(badChecksum)-2]++
+	badTail := append([]byte(nil), frame...)
+	badTail[len(badTail)-1] = 0x00
+
+	tests := []struct {
+		name   string
+		chunks [][]byte
+		want   error
+	}{
+		{"silence", nil, os.ErrDeadlineExceeded},
+		{"preamble", [][]byte{{0xfe, 0xfe}}, os.ErrDeadlineExceeded},
+		{"noise", [][]byte{{0x00, 0x12, 0x68, 0x34}}, ErrMalformedFrame},
+		{"partial frame", [][]byte{frame[:8]}, ErrMalformedFrame},
+		{"bad checksum", [][]byte{badChecksum}, ErrChecksum},
+		{"bad tail", [][]byte{badTail}, ErrMalformedFrame},
+		{"bad checksum and tail", [][]byte{badChecksum, badTail}, ErrMalformedFrame},
+	}
+	classes := []error{os.ErrDeadlineExceeded, ErrMalformedFrame, ErrChecksum}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := readFrame(&chunkReader{chunks: test.chunks, err: os.ErrDeadlineExceeded})
+			for _, class := range classes {
+				if got, want := errors.Is(err, class), class == test.want; got != want {
+					t.Errorf("errors.Is(%v, %v) = %v, want %v", err, class, got, want)
+				}
+			}
+			if test.want != os.ErrDeadlineExceeded && isSilence(err) {
+				t.Errorf("isSilence(%v) = true", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package dlt645
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReadFrozenSimulator(t *testing.T) {
+	store := NewMemoryStore()
+	store.Write(0x05060001, blockData("2405060000"))
+	store.Write(0x05060101, blockData("00123456", "00100000", "00023456"))
+	store.Write(0x05060201, blockData("00000100", "00000100", "00000000"))
+	store.Write(0x05060901, blockData("012345", "2405051915", "012345", "2405051915", "000000", "0000000000"))
+	store.Write(0x05060002, blockData("0000000000"))
+	store.Write(0x05040001, blockData("2405060700"))
+	store.Write(0x05040101, blockData("00123456"))
+	store.Write(0x05040201, blockData("00000100"))
+	store.Write(0x05040301, blockData("00009999"))
+	device := newSimulatedDevice(t, store)
+
+	frozen, err := device.ReadFrozen(FreezeDaily, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !frozen.Time.Equal(time.Date(2024, 5, 6, 0, 0, 0, 0, time.Local)) || frozen.N != 1 || frozen.Type != FreezeDaily {
+		t.Errorf("frozen %+v", frozen)
+	}
+	if len(frozen.Energies) != 2 || len(frozen.Demands) != 1 {
+		t.Fatalf("%d energies and %d demands, want 2 and 1", len(frozen.Energies), len(frozen.Demands))
+	}
+	if energy := frozen.Energy(EnergyPositiveActive); energy == nil || energy.Total != 1234.56 || len(energy.Tariffs) != 2 || energy.Tariffs[1] != 234.56 {
+		t.Errorf("positive active energy %+v", energy)
+	}
+	if energy := frozen.Energy(EnergyReverseActive); energy == nil || energy.Total != 1 {
+		t.Errorf("reverse active energy %+v", energy)
+	}
+	if energy := frozen.Energy(EnergyCombinedReactive1); energy != nil {
+		t.Errorf("combined reactive 1 energy %+v not frozen", energy)
+	}
+	if demand := frozen.Demands[0]; demand.Type != EnergyPositiveActive || demand.Total.Value != 1.2345 || !demand.Total.Time.Equal(time.Date(2024, 5, 5, 19, 15, 0, 0, time.Local)) {
+		t.Errorf("positive active demand %+v", demand)
+	}
+
+	// a record never written
+	if frozen, err = device.ReadFrozen(FreezeDaily, 2); err != nil || !frozen.Time.IsZero() || frozen.Energies != nil {
+		t.Errorf("empty record %+v, error %v", frozen, err)
+	}
+
+	// the integer hour freeze keeps the active total energies only
+	if frozen, err = device.ReadFrozen(FreezeHourly, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(frozen.Energies) != 2 || frozen.Energy(EnergyPositiveActive).Total != 1234.56 || frozen.Energy(EnergyReverseActive).Total != 1 {
+		t.Errorf("hourly freeze energies %+v", frozen.Energies)
+	}
+
+	for _, test := range []struct {
+		kind FreezeType
+		n    int
+	}{{FreezeDaily, 0}, {FreezeDaily, 63}, {FreezeHourly, 255}, {FreezeInstantaneous, 4}, {0x05, 1}} {
+		if _, err = device.ReadFrozen(test.kind, test.n); err == nil {
+			t.Errorf("freeze %02x record %d read", byte(test.kind), test.n)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package dlt645
+
+import "fmt"
+
+// energyTypes names the DI2 byte of energy (DI3 0x00) and maximum demand
+// (DI3 0x01) identifiers.
+var energyTypes = map[byte]struct {
+	name   string
+	unit   string
+	signed bool
+}{
+	0x00: {"combined active", "kWh", true},
+	0x01: {"positive active", "kWh", false},
+	0x02: {"reverse active", "kWh", false},
+	0x03: {"combined reactive 1", "kvarh", true},
+	0x04: {"combined reactive 2", "kvarh", true},
+	0x05: {"quadrant I reactive", "kvarh", false},
+	0x06: {"quadrant II reactive", "kvarh", false},
+	0x07: {"quadrant III reactive", "kvarh", false},
+	0x08: {"quadrant IV reactive", "kvarh", false},
+	0x09: {"positive apparent", "kVAh", false},
+	0x0A: {"reverse apparent", "kVAh", false},
+}
+
+// demandUnits maps the energy units to the demand units.
+var demandUnits = map[string]string{
+	"kWh":   "kW",
+	"kvarh": "kvar",
+	"kVAh":  "kVA",
+}
+
+func registerStandardIdentifiers(r *Registry) {
+	r.RegisterFamily(0xFF000000, 0x00000000, energyIdentifier)
+	r.RegisterFamily(0xFF000000, 0x01000000, demandIdentifier)
+	r.RegisterFamily(0xFF000000, 0x05000000, frozenIdentifier)
+
+	// instantaneous quantities
+	phases := []string{"A", "B", "C"}
+	totalPhases := []string{"total", "A", "B", "C"}
+	registerPhases(r, 0x02010000, "voltage", phases, Field{Layout: "XXX.X", Unit: "V"})
+	registerPhases(r, 0x02020000, "current", phases, Field{Layout: "XXX.XXX", Signed: true, Unit: "A"})
+	registerPhases(r, 0x02030000, "active power", totalPhases, Field{Layout: "XX.XXXX", Signed: true, Unit: "kW"})
+	registerPhases(r, 0x02040000, "reactive power", totalPhases, Field{Layout: "XX.XXXX", Signed: true, Unit: "kvar"})
+	registerPhases(r, 0x02050000, "apparent power", totalPhases, Field{Layout: "XX.XXXX", Signed: true, Unit: "kVA"})
+	registerPhases(r, 0x02060000, "power factor", totalPhases, Field{Layout: "X.XXX", Signed: true})
+	registerPhases(r, 0x02070000, "phase angle", phases, Field{Layout: "XXX.X", Unit: "°"})
+	registerPhases(r, 0x02080000, "voltage waveform distortion", phases, Field{Layout: "XX.XX", Unit: "%"})
+	registerPhases(r, 0x02090000, "current waveform distortion", phases, Field{Layout: "XX.XX", Unit: "%"})
+	for _, di := range []*DataIdentifier{
+		single(0x02800001, "neutral current", Field{Layout: "XXX.XXX", Signed: true, Unit: "A"}),
+		single(0x02800002, "grid frequency", Field{Layout: "XX.XX", Unit: "Hz"}),
+		single(0x02800003, "one minute average active power", Field{Layout: "XX.XXXX", Signed: true, Unit: "kW"}),
+		single(0x02800004, "current active demand", Field{Layout: "XX.XXXX", Signed: true, Unit: "kW"}),
+		single(0x02800005, "current reactive demand", Field{Layout: "XX.XXXX", Signed: true, Unit: "kvar"}),
+		single(0x02800006, "current apparent demand", Field{Layout: "XX.XXXX", Signed: true, Unit: "kVA"}),
+		single(0x02800007, "meter temperature", Field{Layout: "XXX.X", Signed: true, Unit: "℃"}),
+		single(0x02800008, "clock battery voltage", Field{Layout: "XX.XX", Unit: "V"}),
+		single(0x02800009, "meter reading battery voltage", Field{Layout: "XX.XX", Unit: "V"}),
+		single(0x0280000A, "internal battery working time", Field{Layout: "XXXXXXXX", Unit: "min"}),
+	} {
+		r.Register(di)
+	}
+
+	// event counters
+	for _, di := range []*DataIdentifier{
+		single(0x03300000, "programming count", Field{Layout: "XXXXXX"}),
+		single(0x03300100, "meter clear count", Field{Layout: "XXXXXX"}),
+		single(0x03300200, "demand clear count", Field{Layout: "XXXXXX"}),
+		single(0x03300300, "event clear count", Field{Layout: "XXXXXX"}),
+		single(0x03300400, "timing count", Field{Layout: "XXXXXX"}),
+		single(0x03300500, "day table programming count", Field{Layout: "XXXXXX"}),
+		single(0x03300600, "time zone table programming count", Field{Layout: "XXXXXX"}),
+		single(0x03300700, "weekend programming count", Field{Layout: "XXXXXX"}),
+		single(0x03300800, "holiday programming count", Field{Layout: "XXXXXX"}),
+		single(0x03300900, "active combination programming count", Field{Layout: "XXXXXX"}),
+		single(0x03300C00, "settlement day programming count", Field{Layout: "XXXXXX"}),
+		single(0x03300D00, "meter cover open count", Field{Layout: "XXXXXX"}),
+		single(0x03300E00, "terminal cover open count", Field{Layout: "XXXXXX"}),
+	} {
+		r.Register(di)
+	}
+
+	// parameters
+	for _, di := range []*DataIdentifier{
+		single(0x04000101, "date and week", Field{Layout: "YYMMDDWW"}),
+		single(0x04000102, "time", Field{Layout: "hhmmss"}),
+		single(0x04000103, "demand period", Field{Layout: "NN", Unit: "min"}),
+		single(0x04000104, "slip time", Field{Layout: "NN", Unit: "min"}),
+		single(0x04000105, "calibration pulse width", Field{Layout: "XXXX", Unit: "ms"}),
+		single(0x04000106, "time zone table switch time", Field{Layout: "YYMMDDhhmm"}),
+		single(0x04000107, "day table switch time", Field{Layout: "YYMMDDhhmm"}),
+		single(0x04000201, "annual time zones", Field{Layout: "NN"}),
+		single(0x04000202, "day tables", Field{Layout: "NN"}),
+		single(0x04000203, "day periods", Field{Layout: "NN"}),
+		single(0x04000204, "rates", Field{Layout: "NN"}),
+		single(0x04000205, "public holidays", Field{Layout: "NNNN"}),
+		single(0x04000206, "harmonic analysis count", Field{Layout: "NN"}),
+		single(0x04000401, "communication address", Field{Layout: "NNNNNNNNNNNN"}),
+		single(0x04000402, "meter number", Field{Layout: "NNNNNNNNNNNN"}),
+		single(0x04000403, "asset code", Field{Layout: "ASCII", Length: 32}),
+		single(0x04000404, "rated voltage", Field{Layout: "ASCII", Length: 6}),
+		single(0x04000405, "rated current", Field{Layout: "ASCII", Length: 6}),
+		single(0x04000406, "maximum current", Field{Layout: "ASCII", Length: 6}),
+		single(0x04000407, "active accuracy class", Field{Layout: "ASCII", Length: 4}),
+		single(0x04000408, "reactive accuracy class", Field{Layout: "ASCII", Length: 4}),
+		single(0x04000409, "active constant", Field{Layout: "XXXXXX", Unit: "imp/kWh"}),
+		single(0x0400040A, "reactive constant", Field{Layout: "XXXXXX", Unit: "imp/kvarh"}),
+		single(0x0400040B, "meter model", Field{Layout: "ASCII", Length: 10}),
+		single(0x0400040C, "production date", Field{Layout: "ASCII", Length: 10}),
+		single(0x0400040D, "protocol version", Field{Layout: "ASCII", Length: 16}),
+		single(0x04000801, "weekend status word", Field{Layout: "HEX", Length: 1}),
+		single(0x04000802, "weekend day table", Field{Layout: "NN"}),
+		single(0x04000B01, "settlement day 1", Field{Layout: "DDhh"}),
+		single(0x04000B02, "settlement day 2", Field{Layout: "DDhh"}),
+		single(0x04000B03, "settlement day 3", Field{Layout: "DDhh"}),
+	} {
+		r.Register(di)
+	}
+	statusWords := &DataIdentifier{Marker: 0x040005FF, Name: "running status words"}
+	for i := uint32(1); i <= 7; i++ {
+		field := Field{Name: fmt.Sprintf("status word %d", i), Layout: "HEX", Length: 2}
+		r.Register(single(0x04000500|i, field.Name, field))
+		statusWords.Fields = append(statusWords.Fields, field)
+	}
+	r.Register(statusWords)
+
+	// freeze times
+	for _, di := range []*DataIdentifier{
+		single(0x04001201, "integer hour freeze start time", Field{Layout: "YYMMDDhhmm"}),
+		single(0x04001202, "integer hour freeze interval", Field{Layout: "NN", Unit: "min"}),
+		single(0x04001203, "daily freeze time", Field{Layout: "hhmm"}),
+		single(0x04001204, "timed freeze time", Field{Layout: "MMDDhhmm"}),
+	} {
+		r.Register(di)
+	}
+}
+
+// single describes a data identifier carrying one field.
+func single(marker uint32, name string, field Field) *DataIdentifier {
+	if field.Name == "" {
+		field.Name = name
+	}
+	return &DataIdentifier{Marker: marker, Name: name, Fields: []Field{field}}
+}
+
+// registerPhases registers the per phase identifiers DI1 = 1..n (0..n with
+// a total) of base and the block identifier DI1 = 0xFF.
+func registerPhases(r *Registry, base uint32, name string, phases []string, field Field) {
+	block := &DataIdentifier{Marker: base | 0xFF00, Name: name + " block"}
+	first := uint32(1)
+	if phases[0] == "total" {
+		first = 0
+	}
+	for i, phase := range phases {
+		f := field
+		f.Name = phase
+		r.Register(single(base|(first+uint32(i))<<8, fmt.Sprintf("%s %s", phase, name), f))
+		block.Fields = append(block.Fields, f)
+	}
+	r.Register(block)
+}
+
+// energyIdentifier resolves 0x00 DI2 DI1 DI0, DI2 energy type, DI1 tariff
+// (0 total, 0xFF block of total and tariffs), DI0 settlement period (0
+// current, 1..12 last settlement days).
+func energyIdentifier(marker uint32) *DataIdentifier {
+	kind, ok := energyTypes[byte(marker>>16)]
+	tariff, period := byte(marker>>8), byte(marker)
+	if !ok || period > 12 || (tariff > 63 && tariff != 0xFF) {
+		return nil
+	}
+	field := Field{Name: "energy", Layout: "XXXXXX.XX", Signed: kind.signed, Unit: kind.unit}
+	di := &DataIdentifier{Marker: marker, Name: kind.name + " energy" + tariffName(tariff) + periodName(period), Fields: []Field{field}}
+	di.Repeat = tariff == 0xFF
+	return di
+}
+
+// demandIdentifier resolves 0x01 DI2 DI1 DI0 like energyIdentifier, each
+// record is the maximum demand followed by its occurrence time.
+func demandIdentifier(marker uint32) *DataIdentifier {
+	kind, ok := energyTypes[byte(marker>>16)]
+	tariff, period := byte(marker>>8), byte(marker)
+	if !ok || byte(marker>>16) == 0 || period > 12 || (tariff > 63 && tariff != 0xFF) {
+		return nil
+	}
+	di := &DataIdentifier{
+		Marker: marker,
+		Name:   kind.name + " maximum demand" + tariffName(tariff) + periodName(period),
+		Fields: []Field{
+			{Name: "demand", Layout: "XX.XXXX", Signed: kind.signed, Unit: demandUnits[kind.unit]},
+			{Name: "time", Layout: "YYMMDDhhmm"},
+		},
+	}
+	di.Repeat = tariff == 0xFF
+	return di
+}
+
+// frozenIdentifier resolves 0x05 DI2 DI1 DI0, DI2 freeze type, DI1 the
+// freeze time, an energy or a maximum demand block, DI0 the record.
+func frozenIdentifier(marker uint32) *DataIdentifier {
+	kind, item, n := FreezeType(marker>>16), byte(marker>>8), int(byte(marker))
+	records, ok := freezeRecords[kind]
+	if !ok || n < 1 || n > records {
+		return nil
+	}
+	var di *DataIdentifier
+	switch {
+	case item == frozenTime:
+		di = single(marker, "freeze time", Field{Layout: "YYMMDDhhmm"})
+	case item <= frozenLastEnergy:
+		di = energyIdentifier(uint32(item)<<16 | 0xFF00)
+	case item == frozenPositiveDemand || item == frozenReverseDemand:
+		di = demandIdentifier(0x01000000 | uint32(item-frozenLastEnergy)<<16 | 0xFF00)
+	}
+	if di == nil {
+		return nil
+	}
+	di.Marker = marker
+	di.Name = fmt.Sprintf("%s, freeze %02x record %d", di.Name, byte(kind), n)
+	return di
+}
+
+func tariffName(tariff byte) string {
+	switch tariff {
+	case 0:
+		return " total"
+	case 0xFF:
+		return " block"
+	}
+	return fmt.Sprintf(" tariff %d", tariff)
+}
+
+func periodName(period byte) string {
+	if period == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", last %d settlement", period)
+}
@@ -0,0 +1,98 @@
+package dlt645
+
+import (
+	"errors"
+	"time"
+)
+
+// Instantaneous is a snapshot of the instantaneous quantities. Per phase
+// arrays are indexed A, B, C, those with a total start with it.
+type Instantaneous struct {
+	Time          time.Time
+	Voltage       [3]float64 // V
+	Current       [3]float64 // A
+	ActivePower   [4]float64 // kW
+	ReactivePower [4]float64 // kvar
+	ApparentPower [4]float64 // kVA
+	PowerFactor   [4]float64
+	PhaseAngle    [3]float64 // °
+	Frequency     float64    // Hz
+}
+
+// ReadInstantaneous reads the instantaneous quantities with the block data
+// identifiers 0x02xxFF00. Meters rejecting a block with
+// ExceptionCodeRequestWithoutData are read item by item, items they have
+// no data for, like the phases B and C of a single phase meter, are left 0.
+func (d *Device) ReadInstantaneous() (snapshot *Instantaneous, err error) {
+	snapshot = &Instantaneous{Time: time.Now()}
+	for _, phases := range []struct {
+		base   uint32
+		values []float64
+	}{
+		{0x02010000, snapshot.Voltage[:]},
+		{0x02020000, snapshot.Current[:]},
+		{0x02030000, snapshot.ActivePower[:]},
+		{0x02040000, snapshot.ReactivePower[:]},
+		{0x02050000, snapshot.ApparentPower[:]},
+		{0x02060000, snapshot.PowerFactor[:]},
+		{0x02070000, snapshot.PhaseAngle[:]},
+	} {
+		if err = d.readPhases(phases.base, phases.values); err != nil {
+			snapshot = nil
+			return
+		}
+	}
+	if snapshot.Frequency, err = d.readNumber(0x02800002); err != nil {
+		snapshot = nil
+	}
+	return
+}
+
+// readPhases reads the block of base into values, three phases or the
+// total and three phases.
+func (d *Device) readPhases(base uint32, values []float64) (err error) {
+	block := base | 0xFF00
+	data, err := d.ReadRaw(block)
+	switch {
+	case err == nil:
+		value, decodeErr := d.registry().Decode(block, data)
+		if decodeErr == nil && len(value.Items) == len(values) {
+			for i, item := range value.Items {
+				values[i] = item.Number
+			}
+			return
+		}
+		// the block does not hold every phase, read them one by one
+	case !isRequestWithoutData(err):
+		return
+	}
+
+	first := uint32(1)
+	if len(values) == 4 {
+		first = 0
+	}
+	for i := range values {
+		if values[i], err = d.readNumber(base | (first+uint32(i))<<8); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// readNumber reads the number of a single item identifier, 0 if the meter
+// has no data for it.
+func (d *Device) readNumber(marker uint32) (number float64, err error) {
+	value, err := d.ReadValue(marker)
+	if isRequestWithoutData(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return
+	}
+	number = value.Number()
+	return
+}
+
+func isRequestWithoutData(err error) bool {
+	return errors.Is(err, &DltError{ExceptionCode: ExceptionCodeRequestWithoutData})
+}
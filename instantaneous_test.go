@@ -0,0 +1,50 @@
+package dlt645
+
+import "testing"
+
+func TestReadInstantaneousSimulator(t *testing.T) {
+	store := NewMemoryStore()
+	store.Write(0x0201FF00, blockData("2205", "2198", "2210"))
+	store.Write(0x0202FF00, blockData("001500", "801500", "000250"))
+	store.Write(0x0203FF00, blockData("032100", "011000", "811000", "000100"))
+	store.Write(0x0204FF00, blockData("000000", "000000", "000000", "000000"))
+	store.Write(0x0205FF00, blockData("032100", "011000", "011000", "000100"))
+	store.Write(0x0206FF00, blockData("0999", "1000", "8500", "0980"))
+	store.Write(0x0207FF00, blockData("0000", "1200", "2400"))
+	store.Write(0x02800002, blockData("5001"))
+	snapshot, err := newSimulatedDevice(t, store).ReadInstantaneous()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Voltage != [3]float64{220.5, 219.8, 221} || snapshot.Current != [3]float64{1.5, -1.5, 0.25} {
+		t.Errorf("voltages %v, currents %v", snapshot.Voltage, snapshot.Current)
+	}
+	if snapshot.ActivePower != [4]float64{3.21, 1.1, -1.1, 0.01} || snapshot.PowerFactor != [4]float64{0.999, 1, -0.5, 0.98} {
+		t.Errorf("active powers %v, power factors %v", snapshot.ActivePower, snapshot.PowerFactor)
+	}
+	if snapshot.PhaseAngle != [3]float64{0, 120, 240} || snapshot.Frequency != 50.01 || snapshot.Time.IsZero() {
+		t.Errorf("phase angles %v, frequency %v, time %v", snapshot.PhaseAngle, snapshot.Frequency, snapshot.Time)
+	}
+}
+
+// Single phase meters reject the blocks or return only phase A, the items
+// are read one by one.
+func TestReadInstantaneousSinglePhase(t *testing.T) {
+	store := NewMemoryStore()
+	store.Write(0x0201FF00, blockData("2205"))
+	store.Write(0x02010100, blockData("2205"))
+	store.Write(0x02020100, blockData("001500"))
+	store.Write(0x02030000, blockData("003300"))
+	store.Write(0x02030100, blockData("003300"))
+	store.Write(0x02060000, blockData("1000"))
+	snapshot, err := newSimulatedDevice(t, store).ReadInstantaneous()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Voltage != [3]float64{220.5, 0, 0} || snapshot.Current != [3]float64{1.5, 0, 0} {
+		t.Errorf("voltages %v, currents %v", snapshot.Voltage, snapshot.Current)
+	}
+	if snapshot.ActivePower != [4]float64{0.33, 0.33, 0, 0} || snapshot.PowerFactor != [4]float64{1, 0, 0, 0} || snapshot.Frequency != 0 {
+		t.Errorf("active powers %v, power factors %v, frequency %v", snapshot.ActivePower, snapshot.PowerFactor, snapshot.Frequency)
+	}
+}
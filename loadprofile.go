@@ -0,0 +1,232 @@
+package dlt645
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// LoadProfileClass is the DI2 byte of load profile identifiers (DI3 0x06).
+type LoadProfileClass byte
+
+const (
+	LoadProfileAll            LoadProfileClass = 0x00 // 所有类
+	LoadProfileVoltageCurrent LoadProfileClass = 0x01 // 电压、电流、频率
+	LoadProfilePower          LoadProfileClass = 0x02 // 有功、无功功率
+	LoadProfilePowerFactor    LoadProfileClass = 0x03 // 功率因数
+	LoadProfileEnergy         LoadProfileClass = 0x04 // 有功、无功总电能
+	LoadProfileQuadrantEnergy LoadProfileClass = 0x05 // 四象限无功总电能
+	LoadProfileDemand         LoadProfileClass = 0x06 // 当前需量
+)
+
+const (
+	// DI0 of the load profile identifiers
+	loadProfileEarliest  = 0x00
+	loadProfileGivenTime = 0x01
+	loadProfileLatest    = 0x02
+
+	// records requested per read
+	loadProfileBlocks = 16
+
+	loadProfileSeparator = 0xAA
+)
+
+var (
+	loadProfileStart = []byte{0xA0, 0xA0}
+	loadProfileEnd   = []byte{0xE5, 0xE5}
+)
+
+// loadProfileFields describes the data of each class in a record.
+var loadProfileFields = map[LoadProfileClass][]Field{
+	LoadProfileVoltageCurrent: {
+		{Name: "A voltage", Layout: "XXX.X", Unit: "V"},
+		{Name: "B voltage", Layout: "XXX.X", Unit: "V"},
+		{Name: "C voltage", Layout: "XXX.X", Unit: "V"},
+		{Name: "A current", Layout: "XXX.XXX", Signed: true, Unit: "A"},
+		{Name: "B current", Layout: "XXX.XXX", Signed: true, Unit: "A"},
+		{Name: "C current", Layout: "XXX.XXX", Signed: true, Unit: "A"},
+		{Name: "grid frequency", Layout: "XX.XX", Unit: "Hz"},
+	},
+	LoadProfilePower: {
+		{Name: "total active power", Layout: "XX.XXXX", Signed: true, Unit: "kW"},
+		{Name: "A active power", Layout: "XX.XXXX", Signed: true, Unit: "kW"},
+		{Name: "B active power", Layout: "XX.XXXX", Signed: true, Unit: "kW"},
+		{Name: "C active power", Layout: "XX.XXXX", Signed: true, Unit: "kW"},
+		{Name: "total reactive power", Layout: "XX.XXXX", Signed: true, Unit: "kvar"},
+		{Name: "A reactive power", Layout: "XX.XXXX", Signed: true, Unit: "kvar"},
+		{Name: "B reactive power", Layout: "XX.XXXX", Signed: true, Unit: "kvar"},
+		{Name: "C reactive power", Layout: "XX.XXXX", Signed: true, Unit: "kvar"},
+	},
+	LoadProfilePowerFactor: {
+		{Name: "total power factor", Layout: "X.XXX", Signed: true},
+		{Name: "A power factor", Layout: "X.XXX", Signed: true},
+		{Name: "B power factor", Layout: "X.XXX", Signed: true},
+		{Name: "C power factor", Layout: "X.XXX", Signed: true},
+	},
+	LoadProfileEnergy: {
+		{Name: "positive active energy", Layout: "XXXXXX.XX", Unit: "kWh"},
+		{Name: "reverse active energy", Layout: "XXXXXX.XX", Unit: "kWh"},
+		{Name: "combined reactive 1 energy", Layout: "XXXXXX.XX", Signed: true, Unit: "kvarh"},
+		{Name: "combined reactive 2 energy", Layout: "XXXXXX.XX", Signed: true, Unit: "kvarh"},
+	},
+	LoadProfileQuadrantEnergy: {
+		{Name: "quadrant I reactive energy", Layout: "XXXXXX.XX", Unit: "kvarh"},
+		{Name: "quadrant II reactive energy", Layout: "XXXXXX.XX", Unit: "kvarh"},
+		{Name: "quadrant III reactive energy", Layout: "XXXXXX.XX", Unit: "kvarh"},
+		{Name: "quadrant IV reactive energy", Layout: "XXXXXX.XX", Unit: "kvarh"},
+	},
+	LoadProfileDemand: {
+		{Name: "current active demand", Layout: "XX.XXXX", Signed: true, Unit: "kW"},
+		{Name: "current reactive demand", Layout: "XX.XXXX", Signed: true, Unit: "kvar"},
+	},
+}
+
+// LoadRecord is one record of the load profile, it holds the items of the
+// classes the meter records.
+type LoadRecord struct {
+	Time  time.Time
+	Items []Item
+}
+
+// Item returns the item of the given name, e.g. "A voltage".
+func (r *LoadRecord) Item(name string) (item Item, ok bool) {
+	for _, item = range r.Items {
+		if item.Name == name {
+			return item, true
+		}
+	}
+	return Item{}, false
+}
+
+// ReadLoadProfile reads the records of class recorded from from to to,
+// both included, oldest first. It reads blocks of records from the given
+// time on, each possibly spanning several follow-up frames.
+func (d *Device) ReadLoadProfile(class LoadProfileClass, from, to time.Time) (records []*LoadRecord, err error) {
+	if class != LoadProfileAll && loadProfileFields[class] == nil {
+		err = fmt.Errorf("dlt645: unknown load profile class '%02x'", byte(class))
+		return
+	}
+	marker := 0x06000000 | uint32(class)<<16 | loadProfileGivenTime
+	from, to = from.Local(), to.Local()
+	for cursor := from; !cursor.After(to); {
+		var data []byte
+		data, err = contextClient(d.Client).ReadDataContext(d.Context(), marker, loadProfileBlocks,
+			uint8(cursor.Year()%100), uint8(cursor.Month()), uint8(cursor.Day()), uint8(cursor.Hour()), uint8(cursor.Minute()))
+		if isRequestWithoutData(err) {
+			err = nil
+			return
+		}
+		if err != nil {
+			return
+		}
+		var block []*LoadRecord
+		if block, err = decodeLoadProfile(class, data); err != nil {
+			return
+		}
+		next := cursor
+		for _, record := range block {
+			if !record.Time.Before(cursor) && !record.Time.After(to) {
+				records = append(records, record)
+			}
+			if !record.Time.Before(next) {
+				next = record.Time.Add(time.Minute)
+			}
+		}
+		// a short block is the end of the profile
+		if len(block) < loadProfileBlocks || !next.After(cursor) {
+			return
+		}
+		cursor = next
+	}
+	return
+}
+
+// ReadLatestLoadRecord reads the last record of class.
+func (d *Device) ReadLatestLoadRecord(class LoadProfileClass) (record *LoadRecord, err error) {
+	if class != LoadProfileAll && loadProfileFields[class] == nil {
+		err = fmt.Errorf("dlt645: unknown load profile class '%02x'", byte(class))
+		return
+	}
+	data, err := contextClient(d.Client).ReadDataContext(d.Context(), 0x06000000|uint32(class)<<16|loadProfileLatest, 1, 0, 0, 0, 0, 0)
+	if err != nil {
+		return
+	}
+	records, err := decodeLoadProfile(class, data)
+	if err != nil {
+		return
+	}
+	if len(records) == 0 {
+		err = fmt.Errorf("dlt645: no load profile record")
+		return
+	}
+	record = records[0]
+	return
+}
+
+// decodeLoadProfile decodes load profile records, each is
+//
+//	A0 A0 L YYMMDDhhmm class 1 AA class 2 AA ... class 6 AA CS E5 E5
+//
+// where L counts the bytes from the time to the last separator, classes
+// the meter does not record are empty. Records of a single class carry
+// only its data. The checksum is not checked, meters differ in the bytes
+// it covers.
+func decodeLoadProfile(class LoadProfileClass, data []byte) (records []*LoadRecord, err error) {
+	for len(data) > 0 {
+		if len(data) < 3 || !bytes.Equal(data[:2], loadProfileStart) {
+			err = fmt.Errorf("%w: load profile record does not start with a0 a0: % x", ErrMalformedFrame, data)
+			return
+		}
+		length := int(data[2])
+		if len(data) < length+6 || !bytes.Equal(data[length+4:length+6], loadProfileEnd) || length < 5 {
+			err = fmt.Errorf("%w: load profile record length '%v' does not match: % x", ErrMalformedFrame, length, data)
+			return
+		}
+		body := data[3 : 3+length]
+		data = data[length+6:]
+
+		record := &LoadRecord{}
+		if record.Time, err = decodeBCDTime("YYMMDDhhmm", body[:5]); err != nil {
+			return
+		}
+		sections := bytes.Split(bytes.TrimSuffix(body[5:], []byte{loadProfileSeparator}), []byte{loadProfileSeparator})
+		classes := []LoadProfileClass{class}
+		if class == LoadProfileAll {
+			classes = []LoadProfileClass{LoadProfileVoltageCurrent, LoadProfilePower, LoadProfilePowerFactor, LoadProfileEnergy, LoadProfileQuadrantEnergy, LoadProfileDemand}
+		}
+		for i, section := range sections {
+			if i >= len(classes) || len(section) == 0 {
+				continue
+			}
+			var items []Item
+			if items, err = decodeFields(loadProfileFields[classes[i]], section); err != nil {
+				return
+			}
+			record.Items = append(record.Items, items...)
+		}
+		records = append(records, record)
+	}
+	return
+}
+
+// decodeFields decodes data laid out as fields.
+func decodeFields(fields []Field, data []byte) (items []Item, err error) {
+	length := 0
+	for _, field := range fields {
+		length += field.length()
+	}
+	if len(data) != length {
+		err = fmt.Errorf("dlt645: data length '%v' does not match expected '%v'", len(data), length)
+		return
+	}
+	for _, field := range fields {
+		n := field.length()
+		var item Item
+		if item, err = field.decode(data[:n]); err != nil {
+			return
+		}
+		items = append(items, item)
+		data = data[n:]
+	}
+	return
+}
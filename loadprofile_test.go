@@ -0,0 +1,171 @@
+package dlt645
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// loadRecord builds a load profile record at t carrying sections, each
+// followed by the separator.
+func loadRecord(t time.Time, sections ...[]byte) []byte {
+	body := bcdArrayToDataDomain(uint8(t.Minute()), uint8(t.Hour()), uint8(t.Day()), uint8(t.Month()), uint8(t.Year()%100))
+	for _, section := range sections {
+		body = append(append(body, section...), loadProfileSeparator)
+	}
+	var cs byte
+	for _, b := range body {
+		cs += b
+	}
+	record := append(append([]byte{0xA0, 0xA0, byte(len(body))}, body...), cs)
+	return append(record, loadProfileEnd...)
+}
+
+var (
+	voltageCurrentSection = blockData("2205", "2198", "2210", "001500", "801500", "000250", "5001")
+	powerSection          = blockData("032100", "011000", "811000", "000100", "000000", "000000", "000000", "000000")
+	demandSection         = blockData("012345", "000000")
+)
+
+func TestDecodeLoadProfile(t *testing.T) {
+	at := time.Date(2024, 5, 6, 7, 15, 0, 0, time.Local)
+	records, err := decodeLoadProfile(LoadProfileAll, append(
+		loadRecord(at, voltageCurrentSection, powerSection, nil, nil, nil, demandSection),
+		loadRecord(at.Add(15*time.Minute), nil, powerSection)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || !records[0].Time.Equal(at) || len(records[0].Items) != 7+8+2 || len(records[1].Items) != 8 {
+		t.Fatalf("records %+v", records)
+	}
+	for name, want := range map[string]float64{
+		"A voltage":             220.5,
+		"B current":             -1.5,
+		"grid frequency":        50.01,
+		"B active power":        -1.1,
+		"current active demand": 1.2345,
+	} {
+		if item, ok := records[0].Item(name); !ok || item.Number != want {
+			t.Errorf("%s = %v, want %v", name, item.Number, want)
+		}
+	}
+	if _, ok := records[1].Item("A voltage"); ok {
+		t.Error("voltage decoded from an empty section")
+	}
+
+	// a single class carries only its data
+	if records, err = decodeLoadProfile(LoadProfileDemand, loadRecord(at, demandSection)); err != nil || len(records) != 1 || len(records[0].Items) != 2 {
+		t.Errorf("demand records %+v, error %v", records, err)
+	}
+
+	for name, data := range map[string][]byte{
+		"start":          append([]byte{0xA1}, loadRecord(at, demandSection)[1:]...),
+		"end":            loadRecord(at, demandSection)[:17],
+		"section length": loadRecord(at, demandSection[1:]),
+	} {
+		if _, err = decodeLoadProfile(LoadProfileDemand, data); err == nil {
+			t.Errorf("%s: malformed record decoded", name)
+		}
+	}
+	if _, err = decodeLoadProfile(LoadProfileDemand, loadRecord(at, demandSection)[:17]); !errors.Is(err, ErrMalformedFrame) {
+		t.Errorf("truncated record: error %v, want ErrMalformedFrame", err)
+	}
+}
+
+func TestReadLoadProfileSimulator(t *testing.T) {
+	at := time.Date(2024, 5, 6, 7, 0, 0, 0, time.Local)
+	var profile []byte
+	for i := 0; i < 4; i++ {
+		profile = append(profile, loadRecord(at.Add(time.Duration(i)*15*time.Minute), voltageCurrentSection, powerSection, nil, nil, nil, demandSection)...)
+	}
+	store := NewMemoryStore()
+	store.Write(0x06000001, profile)
+	store.Write(0x06000002, loadRecord(at.Add(45*time.Minute), voltageCurrentSection, powerSection, nil, nil, nil, demandSection))
+	device := newSimulatedDevice(t, store)
+
+	// the answer spans follow-up frames, the meter answers from the time
+	// given on, records outside the range are dropped
+	records, err := device.ReadLoadProfile(LoadProfileAll, at.Add(15*time.Minute), at.Add(30*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || !records[0].Time.Equal(at.Add(15*time.Minute)) || !records[1].Time.Equal(at.Add(30*time.Minute)) {
+		t.Fatalf("records %+v", records)
+	}
+	if item, _ := records[1].Item("A voltage"); item.Number != 220.5 {
+		t.Errorf("A voltage %v, want 220.5", item.Number)
+	}
+
+	record, err := device.ReadLatestLoadRecord(LoadProfileAll)
+	if err != nil || !record.Time.Equal(at.Add(45*time.Minute)) {
+		t.Errorf("latest record %+v, error %v", record, err)
+	}
+
+	if records, err = device.ReadLoadProfile(LoadProfilePower, at, at.Add(time.Hour)); err != nil || records != nil {
+		t.Errorf("profile without data %+v, error %v", records, err)
+	}
+	if _, err = device.ReadLoadProfile(0x07, at, at.Add(time.Hour)); err == nil {
+		t.Error("unknown load profile class read")
+	}
+}
+
+// loadProfileMeter answers load profile block reads from records, one
+// every interval, starting at the time requested.
+type loadProfileMeter struct {
+	ContextClient
+	first, last time.Time
+	interval    time.Duration
+	reads       []time.Time
+}
+
+func (m *loadProfileMeter) ReadDataContext(ctx context.Context, dataMarker uint32, blockQuantity uint8, year, month, day, hour, minute uint8) (results []byte, err error) {
+	from := time.Date(2000+int(year), time.Month(month), int(day), int(hour), int(minute), 0, 0, time.Local)
+	m.reads = append(m.reads, from)
+	at := m.first
+	for at.Before(from) {
+		at = at.Add(m.interval)
+	}
+	for n := 0; n < int(blockQuantity) && !at.After(m.last); n++ {
+		results = append(results, loadRecord(at, demandSection)...)
+		at = at.Add(m.interval)
+	}
+	if results == nil {
+		err = &DltError{FunctionCode: FunctionCodeReadData, ExceptionCode: ExceptionCodeRequestWithoutData}
+	}
+	return
+}
+
+func TestReadLoadProfileBlocks(t *testing.T) {
+	first := time.Date(2024, 5, 6, 0, 0, 0, 0, time.Local)
+	meter := &loadProfileMeter{first: first, last: first.Add(24 * time.Hour), interval: 15 * time.Minute}
+	records, err := NewDevice(meter).ReadLoadProfile(LoadProfileDemand, first.Add(time.Hour), first.Add(10*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 10 hours of 15 minute records, both ends included
+	if len(records) != 37 || !records[0].Time.Equal(first.Add(time.Hour)) || !records[36].Time.Equal(first.Add(10*time.Hour)) {
+		t.Fatalf("%d records from %v to %v", len(records), records[0].Time, records[len(records)-1].Time)
+	}
+	for i := 1; i < len(records); i++ {
+		if records[i].Time.Sub(records[i-1].Time) != 15*time.Minute {
+			t.Fatalf("record %d at %v after %v", i, records[i].Time, records[i-1].Time)
+		}
+	}
+	// every block goes on a minute after the last record of the previous one
+	want := []time.Time{first.Add(time.Hour), first.Add(4*time.Hour + 46*time.Minute), first.Add(8*time.Hour + 46*time.Minute)}
+	if len(meter.reads) != len(want) {
+		t.Fatalf("reads from %v, want %v", meter.reads, want)
+	}
+	for i := range want {
+		if !meter.reads[i].Equal(want[i]) {
+			t.Errorf("read %d from %v, want %v", i, meter.reads[i], want[i])
+		}
+	}
+
+	// the profile ends before the range
+	meter = &loadProfileMeter{first: first, last: first.Add(2 * time.Hour), interval: 15 * time.Minute}
+	if records, err = NewDevice(meter).ReadLoadProfile(LoadProfileDemand, first.Add(time.Hour), first.Add(10*time.Hour)); err != nil || len(records) != 5 || len(meter.reads) != 1 {
+		t.Errorf("%d records in %d reads, error %v", len(records), len(meter.reads), err)
+	}
+}
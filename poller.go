@@ -0,0 +1,254 @@
+package dlt645
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	pollLateAfter   = time.Second
+	pollResultQueue = 64
+)
+
+// ErrPollerRun is returned by Run when the poller has been run before.
+var ErrPollerRun = errors.New("dlt645: poller has already been run")
+
+// PollTask reads DataMarkers of the meter at Address every Interval. Polls
+// are aligned to the local wall clock, an Interval of 15 minutes polls at
+// :00, :15, :30 and :45, Offset shifts them, e.g. 30 seconds past.
+type PollTask struct {
+	Address     uint64
+	DataMarkers []uint32
+	Interval    time.Duration
+	Offset      time.Duration
+}
+
+// PollResult is the outcome of reading one data identifier.
+type PollResult struct {
+	Bus        string
+	Address    uint64
+	DataMarker uint32
+	// Scheduled is the time the poll was due, Time the time it was read
+	Scheduled time.Time
+	Time      time.Time
+	Data      []byte
+	Err       error
+	// Missed is the number of polls of the task skipped before this one
+	// because the bus was still busy
+	Missed int
+}
+
+// PollStats counts the polls of a bus, every data identifier read is a poll.
+type PollStats struct {
+	Polls  int
+	Errors int
+	// Late polls were read more than LateAfter after they were due
+	Late   int
+	Missed int
+}
+
+// Poller reads data identifiers from many meters periodically. The tasks
+// of a bus are polled one at a time, buses are polled in parallel.
+type Poller struct {
+	// OnResult is called for every result from the goroutine of the bus.
+	// If nil, results are sent to C.
+	OnResult func(result *PollResult)
+	C        chan *PollResult
+	// LateAfter is the delay after which a poll counts as late
+	LateAfter time.Duration
+	Logger    *log.Logger
+
+	mu    sync.Mutex
+	buses []*pollBus
+	run   bool
+}
+
+type pollBus struct {
+	name  string
+	tasks []*pollTask
+	stats PollStats
+}
+
+type pollTask struct {
+	PollTask
+	client Client
+	next   time.Time
+	missed int
+}
+
+// NewPoller allocates a poller with a buffered result channel.
+func NewPoller() *Poller {
+	return &Poller{
+		C:         make(chan *PollResult, pollResultQueue),
+		LateAfter: pollLateAfter,
+	}
+}
+
+// AddBus adds the tasks of one bus, meter returns the client for an
+// address, e.g. the Meter method of a handler. Buses must be added before
+// Run.
+func (p *Poller) AddBus(name string, meter func(addr uint64) Client, tasks ...PollTask) {
+	bus := &pollBus{name: name}
+	clients := make(map[uint64]Client)
+	for _, task := range tasks {
+		if task.Interval <= 0 {
+			continue
+		}
+		client, ok := clients[task.Address]
+		if !ok {
+			client = meter(task.Address)
+			clients[task.Address] = client
+		}
+		bus.tasks = append(bus.tasks, &pollTask{PollTask: task, client: client})
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buses = append(p.buses, bus)
+}
+
+// Stats returns the counters of a bus.
+func (p *Poller) Stats(name string) (stats PollStats, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, bus := range p.buses {
+		if bus.name == name {
+			return bus.stats, true
+		}
+	}
+	return
+}
+
+// Run polls until ctx is done and returns ctx.Err(). C is closed on return,
+// so a poller runs once, later calls return ErrPollerRun.
+func (p *Poller) Run(ctx context.Context) error {
+	p.mu.Lock()
+	if p.run {
+		p.mu.Unlock()
+		return ErrPollerRun
+	}
+	p.run = true
+	buses := p.buses
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, bus := range buses {
+		wg.Add(1)
+		go func(bus *pollBus) {
+			defer wg.Done()
+			p.runBus(ctx, bus)
+		}(bus)
+	}
+	wg.Wait()
+	if p.C != nil {
+		close(p.C)
+	}
+	return ctx.Err()
+}
+
+func (p *Poller) runBus(ctx context.Context, bus *pollBus) {
+	if len(bus.tasks) == 0 {
+		return
+	}
+	now := time.Now()
+	for _, task := range bus.tasks {
+		task.next = nextPoll(now, task.Interval, task.Offset)
+	}
+	for {
+		// poll the tasks due in the order they were due
+		sort.SliceStable(bus.tasks, func(i, j int) bool {
+			return bus.tasks[i].next.Before(bus.tasks[j].next)
+		})
+		timer := time.NewTimer(time.Until(bus.tasks[0].next))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+		for _, task := range bus.tasks {
+			if time.Now().Before(task.next) {
+				break
+			}
+			if !p.poll(ctx, bus, task) {
+				return
+			}
+		}
+	}
+}
+
+// poll reads the data identifiers of a task and schedules the next poll,
+// false means ctx is done.
+func (p *Poller) poll(ctx context.Context, bus *pollBus, task *pollTask) bool {
+	scheduled, missed := task.next, task.missed
+	for _, marker := range task.DataMarkers {
+		result := &PollResult{
+			Bus:        bus.name,
+			Address:    task.Address,
+			DataMarker: marker,
+			Scheduled:  scheduled,
+			Time:       time.Now(),
+			Missed:     missed,
+		}
+		result.Data, result.Err = contextClient(task.client).ReadDataContext(ctx, marker, 0, 0, 0, 0, 0, 0)
+		if ctx.Err() != nil {
+			return false
+		}
+
+		p.mu.Lock()
+		bus.stats.Polls++
+		if result.Err != nil {
+			bus.stats.Errors++
+		}
+		if result.Time.Sub(scheduled) > p.LateAfter {
+			bus.stats.Late++
+		}
+		p.mu.Unlock()
+
+		if !p.emit(ctx, result) {
+			return false
+		}
+	}
+
+	task.next = nextPoll(time.Now(), task.Interval, task.Offset)
+	task.missed = int(task.next.Sub(scheduled)/task.Interval) - 1
+	if task.missed > 0 {
+		p.logf("dlt645: bus %s meter %d missed %d polls after %v", bus.name, task.Address, task.missed, scheduled)
+		p.mu.Lock()
+		bus.stats.Missed += task.missed
+		p.mu.Unlock()
+	}
+	return true
+}
+
+func (p *Poller) emit(ctx context.Context, result *PollResult) bool {
+	if p.OnResult != nil {
+		p.OnResult(result)
+		return true
+	}
+	select {
+	case p.C <- result:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (p *Poller) logf(format string, v ...interface{}) {
+	if p.Logger != nil {
+		p.Logger.Printf(format, v...)
+	}
+}
+
+// nextPoll returns the first time after now that is a multiple of interval
+// on the local wall clock, shifted by offset.
+func nextPoll(now time.Time, interval, offset time.Duration) time.Time {
+	_, zone := now.Zone()
+	shift := time.Duration(zone)*time.Second - offset
+	return now.Add(shift).Truncate(interval).Add(interval - shift)
+}
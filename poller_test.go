@@ -0,0 +1,79 @@
+package dlt645
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPollerSimulator(t *testing.T) {
+	store := NewMemoryStore()
+	store.Write(0x00010000, transmitted("00123456"))
+	handler := newSimulatedSerialHandler(t, NewServer(304257140001, store))
+	poller := NewPoller()
+	poller.AddBus("bus1", handler.Meter, PollTask{Address: 304257140001, DataMarkers: []uint32{0x00010000, 0x00020000}, Interval: 100 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 2)
+	go func() { done <- poller.Run(ctx) }()
+	go func() { done <- poller.Run(ctx) }()
+	select {
+	case err := <-done:
+		if err != ErrPollerRun {
+			t.Errorf("concurrent run: error %v, want ErrPollerRun", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("concurrent run did not return")
+	}
+
+	result := <-poller.C
+	if result.Bus != "bus1" || result.Address != 304257140001 || result.DataMarker != 0x00010000 || result.Err != nil || !bytes.Equal(result.Data, transmitted("00123456")) {
+		t.Errorf("result %+v", result)
+	}
+	result = <-poller.C
+	if result.DataMarker != 0x00020000 || !errors.Is(result.Err, &DltError{ExceptionCode: ExceptionCodeRequestWithoutData}) {
+		t.Errorf("unknown register result %+v", result)
+	}
+	if stats, ok := poller.Stats("bus1"); !ok || stats.Polls < 2 || stats.Errors < 1 {
+		t.Errorf("stats %+v", stats)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("run: error %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("run did not return")
+	}
+	for range poller.C {
+	}
+
+	// a second run must neither poll nor close C again
+	if err := poller.Run(context.Background()); err != ErrPollerRun {
+		t.Errorf("second run: error %v, want ErrPollerRun", err)
+	}
+}
+
+func TestNextPoll(t *testing.T) {
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.Local)
+	tests := []struct {
+		interval, offset time.Duration
+		want             time.Time
+	}{
+		{15 * time.Minute, 0, time.Date(2024, 5, 6, 7, 15, 0, 0, time.Local)},
+		{15 * time.Minute, 30 * time.Second, time.Date(2024, 5, 6, 7, 15, 30, 0, time.Local)},
+		{time.Hour, 0, time.Date(2024, 5, 6, 8, 0, 0, 0, time.Local)},
+		{24 * time.Hour, 0, time.Date(2024, 5, 7, 0, 0, 0, 0, time.Local)},
+		{time.Minute, 9 * time.Second, time.Date(2024, 5, 6, 7, 9, 9, 0, time.Local)},
+	}
+	for _, test := range tests {
+		if got := nextPoll(now, test.interval, test.offset); !got.Equal(test.want) {
+			t.Errorf("nextPoll(%v, %v, %v) = %v, want %v", now, test.interval, test.offset, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package dlt645
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Field describes one data item of a data identifier using the notation of
+// DL/T 645-2007 Appendix A, e.g. "XXXXXX.XX", "NNNN", "YYMMDDhhmm".
+// Layout "ASCII" and "HEX" need an explicit Length.
+type Field struct {
+	Name   string
+	Layout string
+	Length int
+	// Signed means the highest bit of the most significant byte is the sign
+	Signed bool
+	Unit   string
+}
+
+// DataIdentifier describes the data returned for a data identifier.
+type DataIdentifier struct {
+	Marker uint32
+	Name   string
+	Fields []Field
+	// Repeat means Fields repeat until the data is consumed, as in block
+	// identifiers carrying the total and a meter dependent number of tariffs.
+	Repeat bool
+}
+
+// Length returns the data length of one repetition of Fields.
+func (di *DataIdentifier) Length() (n int) {
+	for _, field := range di.Fields {
+		n += field.length()
+	}
+	return
+}
+
+// Item is one decoded data item, depending on the layout either Number,
+// Time or Text is set.
+type Item struct {
+	Name   string
+	Layout string
+	Unit   string
+	Number float64
+	Time   time.Time
+	Text   string
+	Raw    []byte
+}
+
+// String formats the item with its unit.
+func (item Item) String() string {
+	var s string
+	switch {
+	case item.Text != "":
+		s = item.Text
+	case !item.Time.IsZero():
+		s = item.Time.Format(timeFormat(item.Layout))
+	default:
+		s = strconv.FormatFloat(item.Number, 'f', -1, 64)
+	}
+	if item.Unit != "" {
+		s += " " + item.Unit
+	}
+	return s
+}
+
+// Value is the decoded data of a data identifier.
+type Value struct {
+	DataIdentifier *DataIdentifier
+	Items          []Item
+	Raw            []byte
+}
+
+// Number returns the number of the first item.
+func (v *Value) Number() float64 {
+	if len(v.Items) == 0 {
+		return 0
+	}
+	return v.Items[0].Number
+}
+
+// Registry resolves data identifiers to their description. Identifiers are
+// looked up exactly first, then by the families registered for a mask.
+type Registry struct {
+	mu          sync.RWMutex
+	identifiers map[uint32]*DataIdentifier
+	families    []family
+}
+
+type family struct {
+	mask    uint32
+	marker  uint32
+	resolve func(marker uint32) *DataIdentifier
+}
+
+// DefaultRegistry holds the standard DL/T 645-2007 data identifiers.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry allocates a registry holding the standard data identifiers.
+func NewRegistry() *Registry {
+	r := &Registry{identifiers: make(map[uint32]*DataIdentifier)}
+	registerStandardIdentifiers(r)
+	return r
+}
+
+// Register adds or replaces a data identifier, e.g. a vendor-specific one.
+func (r *Registry) Register(di *DataIdentifier) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.identifiers[di.Marker] = di
+}
+
+// RegisterFamily resolves every identifier with marker&mask == marker through
+// resolve, later families take precedence.
+func (r *Registry) RegisterFamily(mask, marker uint32, resolve func(marker uint32) *DataIdentifier) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.families = append(r.families, family{mask: mask, marker: marker & mask, resolve: resolve})
+}
+
+// Lookup returns the description of a data identifier.
+func (r *Registry) Lookup(marker uint32) (di *DataIdentifier, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if di, ok = r.identifiers[marker]; ok {
+		return
+	}
+	for i := len(r.families) - 1; i >= 0; i-- {
+		f := r.families[i]
+		if marker&f.mask == f.marker {
+			if di = f.resolve(marker); di != nil {
+				ok = true
+				return
+			}
+		}
+	}
+	return
+}
+
+// Decode decodes data as returned by ReadData for marker.
+func (r *Registry) Decode(marker uint32, data []byte) (value *Value, err error) {
+	di, ok := r.Lookup(marker)
+	if !ok {
+		err = fmt.Errorf("dlt645: unknown data identifier '%08x'", marker)
+		return
+	}
+	return di.Decode(data)
+}
+
+// Register adds a data identifier to DefaultRegistry.
+func Register(di *DataIdentifier) {
+	DefaultRegistry.Register(di)
+}
+
+// Decode decodes data as returned by ReadData.
+func (di *DataIdentifier) Decode(data []byte) (value *Value, err error) {
+	value = &Value{DataIdentifier: di, Raw: data}
+	length := di.Length()
+	if length == 0 {
+		return
+	}
+	if len(data) < length || (!di.Repeat && len(data) != length) || (di.Repeat && len(data)%length != 0) {
+		err = fmt.Errorf("dlt645: data length '%v' of '%08x' does not match expected '%v'", len(data), di.Marker, length)
+		return
+	}
+	for rep := 0; len(data) > 0; rep++ {
+		for _, field := range di.Fields {
+			n := field.length()
+			var item Item
+			if item, err = field.decode(data[:n]); err != nil {
+				err = fmt.Errorf("dlt645: data identifier '%08x' field '%s': %w", di.Marker, field.Name, err)
+				return
+			}
+			if di.Repeat {
+				item.Name = fmt.Sprintf("%s[%d]", field.Name, rep)
+			}
+			value.Items = append(value.Items, item)
+			data = data[n:]
+		}
+	}
+	return
+}
+
+func (field *Field) length() int {
+	if field.Length > 0 {
+		return field.Length
+	}
+	return len(strings.Replace(field.Layout, ".", "", 1)) / 2
+}
+
+func (field *Field) decode(data []byte) (item Item, err error) {
+	item = Item{Name: field.Name, Layout: field.Layout, Unit: field.Unit, Raw: data}
+	switch {
+	case field.Layout == "ASCII":
+		text := append([]byte(nil), data...)
+		Reverse(text)
+		item.Text = string(bytes.Trim(text, " \x00\xff"))
+	case field.Layout == "HEX":
+		text := append([]byte(nil), data...)
+		Reverse(text)
+		item.Text = fmt.Sprintf("%X", text)
+	case isTimeLayout(field.Layout):
+		item.Time, err = decodeBCDTime(field.Layout, data)
+	default:
+		item.Number, err = decodeBCDNumber(field.Layout, field.Signed, data)
+	}
+	return
+}
+
+func isTimeLayout(layout string) bool {
+	return strings.ContainsAny(layout, "YMDWhms")
+}
+
+// timeFormat converts a layout like "YYMMDDhhmm" to a time format.
+func timeFormat(layout string) string {
+	var date, clock []string
+	for i := 0; i+2 <= len(layout); i += 2 {
+		switch layout[i : i+2] {
+		case "YY":
+			date = append(date, "2006")
+		case "MM":
+			date = append(date, "01")
+		case "DD":
+			date = append(date, "02")
+		case "hh":
+			clock = append(clock, "15")
+		case "mm":
+			clock = append(clock, "04")
+		case "ss":
+			clock = append(clock, "05")
+		}
+	}
+	return strings.TrimSpace(strings.Join(date, "-") + " " + strings.Join(clock, ":"))
+}
+
+// decodeBCDNumber decodes low byte first BCD digits, decimals are given by
+// the position of the point in layout.
+func decodeBCDNumber(layout string, signed bool, data []byte) (number float64, err error) {
+	digits := append([]byte(nil), data...)
+	negative := false
+	if signed && len(digits) > 0 && digits[len(digits)-1]&0x80 != 0 {
+		negative = true
+		digits[len(digits)-1] &= 0x7F
+	}
+	var n int64
+	if n, err = decodeBCD(digits); err != nil {
+		return
+	}
+	decimals := 0
+	if i := strings.IndexByte(layout, '.'); i >= 0 {
+		decimals = len(layout) - i - 1
+	}
+	number, _ = strconv.ParseFloat(strconv.FormatInt(n, 10)+"e-"+strconv.Itoa(decimals), 64)
+	if negative {
+		number = -number
+	}
+	return
+}
+
+// decodeBCD decodes low byte first BCD digits.
+func decodeBCD(data []byte) (n int64, err error) {
+	for i := len(data) - 1; i >= 0; i-- {
+		hi, lo := data[i]>>4, data[i]&0x0F
+		if hi > 9 || lo > 9 {
+			err = fmt.Errorf("dlt645: invalid BCD byte '%02x'", data[i])
+			return
+		}
+		n = n*100 + int64(hi*10+lo)
+	}
+	return
+}
+
+// decodeBCDTime decodes a low byte first BCD time in the layout, e.g.
+// "YYMMDDhhmm". All zero data decodes to the zero time.
+func decodeBCDTime(layout string, data []byte) (t time.Time, err error) {
+	if len(layout) != 2*len(data) {
+		err = fmt.Errorf("dlt645: data length '%v' does not match layout '%s'", len(data), layout)
+		return
+	}
+	if bytes.Count(data, []byte{0}) == len(data) {
+		return
+	}
+	year, month, day := 0, 1, 1
+	hour, minute, second := 0, 0, 0
+	for i := 0; i < len(data); i++ {
+		b := data[len(data)-1-i]
+		hi, lo := b>>4, b&0x0F
+		if hi > 9 || lo > 9 {
+			err = fmt.Errorf("dlt645: invalid BCD byte '%02x'", b)
+			return
+		}
+		v := int(hi*10 + lo)
+		switch layout[2*i : 2*i+2] {
+		case "YY":
+			year = 2000 + v
+		case "MM":
+			month = v
+		case "DD":
+			day = v
+		case "hh":
+			hour = v
+		case "mm":
+			minute = v
+		case "ss":
+			second = v
+		}
+	}
+	t = time.Date(year, time.Month(month), day, hour, minute, second, 0, time.Local)
+	return
+}
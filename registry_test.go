@@ -0,0 +1,191 @@
+package dlt645
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+// transmitted returns BCD digits written high digit first in the low byte
+// first order of the wire.
+func transmitted(digits string) []byte {
+	data, err := hex.DecodeString(digits)
+	if err != nil {
+		panic(err)
+	}
+	Reverse(data)
+	return data
+}
+
+func TestDecodeBCDNumber(t *testing.T) {
+	tests := []struct {
+		layout string
+		signed bool
+		digits string
+		want   float64
+	}{
+		{"XXXXXX.XX", false, "00123456", 1234.56},
+		{"XXXXXX.XX", true, "80123456", -1234.56},
+		{"XXXXXX.XX", false, "80123456", 801234.56},
+		{"XXX.X", false, "2205", 220.5},
+		{"XXX.XXX", true, "800500", -0.5},
+		{"X.XXX", true, "1000", 1},
+		{"XX.XXXX", false, "000001", 0.0001},
+		{"XXXXXX", false, "000002", 2},
+		{"NN", false, "15", 15},
+	}
+	for _, test := range tests {
+		got, err := decodeBCDNumber(test.layout, test.signed, transmitted(test.digits))
+		if err != nil || got != test.want {
+			t.Errorf("%s %s signed %v = %v, %v, want %v", test.layout, test.digits, test.signed, got, err, test.want)
+		}
+	}
+	if _, err := decodeBCDNumber("XXX.X", false, []byte{0x5A, 0x22}); err == nil {
+		t.Error("invalid BCD digits decoded")
+	}
+}
+
+func TestDecodeBCDTime(t *testing.T) {
+	tests := []struct {
+		layout string
+		digits string
+		want   time.Time
+	}{
+		{"YYMMDDhhmmss", "240506070809", time.Date(2024, 5, 6, 7, 8, 9, 0, time.Local)},
+		{"YYMMDDhhmm", "2405060708", time.Date(2024, 5, 6, 7, 8, 0, 0, time.Local)},
+		{"MMDDhhmm", "05060708", time.Date(0, 5, 6, 7, 8, 0, 0, time.Local)},
+		{"hhmmss", "070809", time.Date(0, 1, 1, 7, 8, 9, 0, time.Local)},
+		{"DDhh", "0100", time.Date(0, 1, 1, 0, 0, 0, 0, time.Local)},
+		{"YYMMDDhhmm", "0000000000", time.Time{}},
+	}
+	for _, test := range tests {
+		got, err := decodeBCDTime(test.layout, transmitted(test.digits))
+		if err != nil || !got.Equal(test.want) {
+			t.Errorf("%s %s = %v, %v, want %v", test.layout, test.digits, got, err, test.want)
+		}
+	}
+	if _, err := decodeBCDTime("YYMMDDhhmm", transmitted("24050607")); err == nil {
+		t.Error("short time decoded")
+	}
+	if _, err := decodeBCDTime("hhmmss", []byte{0x09, 0x6A, 0x07}); err == nil {
+		t.Error("invalid BCD time decoded")
+	}
+}
+
+func TestFieldDecodeText(t *testing.T) {
+	ascii := Field{Name: "rated voltage", Layout: "ASCII", Length: 6}
+	// sent low byte first, padded
+	item, err := ascii.decode([]byte{0x00, 0x00, 'V', '0', '2', '2'})
+	if err != nil || item.Text != "220V" {
+		t.Errorf("ASCII %q, %v, want 220V", item.Text, err)
+	}
+	hexField := Field{Name: "operator", Layout: "HEX", Length: 4}
+	if item, err = hexField.decode([]byte{0x44, 0x33, 0x22, 0x11}); err != nil || item.Text != "11223344" {
+		t.Errorf("HEX %q, %v, want 11223344", item.Text, err)
+	}
+	if s := (Item{Number: 220.5, Unit: "V"}).String(); s != "220.5 V" {
+		t.Errorf("item string %q", s)
+	}
+	if s := (Item{Layout: "YYMMDDhhmm", Time: time.Date(2024, 5, 6, 7, 8, 0, 0, time.Local)}).String(); s != "2024-05-06 07:08" {
+		t.Errorf("time item string %q", s)
+	}
+}
+
+func TestRegistryLookup(t *testing.T) {
+	r := NewRegistry()
+	tests := []struct {
+		marker uint32
+		name   string
+		repeat bool
+	}{
+		{0x02010100, "A voltage", false},
+		{0x0201FF00, "voltage block", false},
+		{0x00010000, "positive active energy", false},
+		{0x0001FF01, "positive active energy", true},
+		{0x01010000, "positive active maximum demand", false},
+		{0x04000403, "asset code", false},
+	}
+	for _, test := range tests {
+		di, ok := r.Lookup(test.marker)
+		if !ok {
+			t.Errorf("%08x not found", test.marker)
+			continue
+		}
+		if !strings.HasPrefix(di.Name, test.name) || di.Repeat != test.repeat {
+			t.Errorf("%08x is %q repeat %v, want %q repeat %v", test.marker, di.Name, di.Repeat, test.name, test.repeat)
+		}
+	}
+	for _, marker := range []uint32{0x000B0000, 0x00010040, 0x0001000D, 0x01000000, 0x04A00001} {
+		if di, ok := r.Lookup(marker); ok {
+			t.Errorf("%08x resolved to %q", marker, di.Name)
+		}
+	}
+
+	r.Register(&DataIdentifier{Marker: 0x04A00001, Name: "vendor counter", Fields: []Field{{Name: "count", Layout: "XXXXXX"}}})
+	r.RegisterFamily(0xFFFF0000, 0x00010000, func(marker uint32) *DataIdentifier {
+		return &DataIdentifier{Marker: marker, Name: "vendor energy"}
+	})
+	if di, ok := r.Lookup(0x04A00001); !ok || di.Name != "vendor counter" {
+		t.Errorf("registered identifier %v", di)
+	}
+	if di, ok := r.Lookup(0x00010000); !ok || di.Name != "vendor energy" {
+		t.Errorf("later family %v, want vendor energy", di)
+	}
+	if _, ok := NewRegistry().Lookup(0x04A00001); ok {
+		t.Error("registration leaked into a new registry")
+	}
+}
+
+func TestDataIdentifierDecode(t *testing.T) {
+	block, _ := NewRegistry().Lookup(0x0001FF00)
+	value, err := block.Decode(append(transmitted("00123456"), transmitted("00010000")...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(value.Items) != 2 || value.Items[0].Name != "energy[0]" || value.Items[1].Number != 100 || value.Number() != 1234.56 {
+		t.Errorf("items %+v", value.Items)
+	}
+	if _, err = block.Decode(transmitted("123456")); err == nil {
+		t.Error("energy block of 3 bytes decoded")
+	}
+	voltage, _ := NewRegistry().Lookup(0x02010100)
+	if _, err = voltage.Decode(transmitted("002205")); err == nil {
+		t.Error("voltage of 3 bytes decoded")
+	}
+}
+
+func TestReadValueSimulator(t *testing.T) {
+	store := NewMemoryStore()
+	store.Write(0x02010100, transmitted("2205"))
+	store.Write(0x0201FF00, append(append(transmitted("2205"), transmitted("2198")...), transmitted("2210")...))
+	store.Write(0x02020100, transmitted("800512"))
+	store.Write(0x04000403, []byte("0000000000000000000000000001-OMA"))
+	store.Write(0x04A00001, transmitted("000042"))
+	handler := newSimulatedSerialHandler(t, NewServer(304257140001, store))
+	handler.SlaveAddr = 304257140001
+	device := NewDevice(NewClient(handler))
+
+	value, err := device.ReadValue(0x02010100)
+	if err != nil || value.Number() != 220.5 || value.Items[0].Unit != "V" {
+		t.Errorf("A voltage %v, error %v", value, err)
+	}
+	if value, err = device.ReadValue(0x0201FF00); err != nil || len(value.Items) != 3 || value.Items[2].Name != "C" || value.Items[2].Number != 221 {
+		t.Errorf("voltage block %v, error %v", value, err)
+	}
+	if value, err = device.ReadValue(0x02020100); err != nil || value.Number() != -0.512 {
+		t.Errorf("A current %v, error %v", value, err)
+	}
+	if value, err = device.ReadValue(0x04000403); err != nil || value.Items[0].Text != "AMO-1000000000000000000000000000" {
+		t.Errorf("asset code %v, error %v", value, err)
+	}
+
+	if _, err = device.ReadValue(0x04A00001); err == nil || !strings.Contains(err.Error(), "unknown data identifier") {
+		t.Errorf("unregistered identifier: error %v", err)
+	}
+	device.Registry = NewRegistry()
+	device.Registry.Register(&DataIdentifier{Marker: 0x04A00001, Name: "vendor counter", Fields: []Field{{Name: "count", Layout: "XXXXXX"}}})
+	if value, err = device.ReadValue(0x04A00001); err != nil || value.Number() != 42 {
+		t.Errorf("vendor counter %v, error %v", value, err)
+	}
+}
@@ -0,0 +1,58 @@
+package dlt645
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrRelayNotSwitched is returned by ControlRelay when status word 3 does
+// not show the state commanded.
+var ErrRelayNotSwitched = errors.New("dlt645: relay state did not change")
+
+// ControlRelay sends a relay command valid until validUntil and reads status
+// word 3 to confirm it. A trip is confirmed by the relay command state, the
+// relay itself may open after the trip delay of the meter. A close is
+// confirmed by the relay state, allowing the close only by the command
+// state, the customer closes the relay on the meter. Alarms are not
+// reflected in the status and are not confirmed.
+func (d *Device) ControlRelay(command RelayCommand, validUntil time.Time, passwordPermission uint8, password uint32, operatorCode uint32) (status StatusWord3, err error) {
+	client, err := relayClient(d.Client)
+	if err != nil {
+		return
+	}
+	if _, err = client.RelayControlContext(d.Context(), command, validUntil, passwordPermission, password, operatorCode); err != nil {
+		return
+	}
+	if status, err = d.ReadStatusWord3(); err != nil {
+		return
+	}
+
+	switched := true
+	switch command {
+	case RelayTrip:
+		switched = status.RelayCommandOpen
+	case RelayAllowClose:
+		switched = !status.RelayCommandOpen
+	case RelayClose:
+		switched = !status.RelayCommandOpen && !status.RelayOpen
+	case RelayKeepPower:
+		switched = status.KeepPower
+	case RelayKeepPowerOff:
+		switched = !status.KeepPower
+	}
+	if !switched {
+		err = fmt.Errorf("%w: command '%02x', relay open '%v', command open '%v', keep power '%v'",
+			ErrRelayNotSwitched, byte(command), status.RelayOpen, status.RelayCommandOpen, status.KeepPower)
+	}
+	return
+}
+
+// relayClient returns client as a RelayClient.
+func relayClient(client Client) (relay RelayClient, err error) {
+	relay, ok := client.(RelayClient)
+	if !ok {
+		err = fmt.Errorf("dlt645: relay control: %w", ErrNotSupported)
+	}
+	return
+}
@@ -0,0 +1,88 @@
+package dlt645
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// relayMeter simulates the relay of a meter in status word 3, a stuck
+// relay ignores the commands.
+type relayMeter struct {
+	store                             *MemoryStore
+	stuck                             bool
+	relayOpen, commandOpen, keepPower bool
+	commands                          []RelayCommand
+}
+
+func (m *relayMeter) control(command RelayCommand, validUntil time.Time) (err error) {
+	m.commands = append(m.commands, command)
+	if !m.stuck {
+		switch command {
+		case RelayTrip:
+			m.commandOpen, m.relayOpen = true, true
+		case RelayAllowClose:
+			m.commandOpen = false
+		case RelayClose:
+			m.commandOpen, m.relayOpen = false, false
+		case RelayKeepPower:
+			m.keepPower = true
+		case RelayKeepPowerOff:
+			m.keepPower = false
+		}
+	}
+	return m.writeStatus()
+}
+
+func (m *relayMeter) writeStatus() error {
+	var word uint16
+	for bit, set := range map[uint]bool{4: m.relayOpen, 6: m.commandOpen, 12: m.keepPower} {
+		if set {
+			word |= 1 << bit
+		}
+	}
+	return m.store.Write(statusWordMarker|3, []byte{byte(word), byte(word >> 8)})
+}
+
+func TestControlRelaySimulator(t *testing.T) {
+	store := NewMemoryStore()
+	meter := &relayMeter{store: store}
+	meter.writeStatus()
+	server := NewServer(304257140001, store)
+	server.Passwords = map[uint8]uint32{2: 0x123456}
+	server.OnRelayControl = meter.control
+	device := NewDevice(newSimulatedSerialHandler(t, server).Meter(304257140001))
+	validUntil := time.Now().Add(10 * time.Minute)
+
+	status, err := device.ControlRelay(RelayTrip, validUntil, 2, 0x123456, 0)
+	if err != nil || !status.RelayCommandOpen || !status.RelayOpen {
+		t.Errorf("trip: status %+v, error %v", status, err)
+	}
+	if status, err = device.ControlRelay(RelayAllowClose, validUntil, 2, 0x123456, 0); err != nil || status.RelayCommandOpen || !status.RelayOpen {
+		t.Errorf("allow close: status %+v, error %v", status, err)
+	}
+	if status, err = device.ControlRelay(RelayKeepPower, validUntil, 2, 0x123456, 0); err != nil || !status.KeepPower {
+		t.Errorf("keep power: status %+v, error %v", status, err)
+	}
+	if _, err = device.ControlRelay(RelayAlarm, validUntil, 2, 0x123456, 0); err != nil {
+		t.Errorf("alarm: %v", err)
+	}
+
+	meter.stuck = true
+	if status, err = device.ControlRelay(RelayClose, validUntil, 2, 0x123456, 0); !errors.Is(err, ErrRelayNotSwitched) || !status.RelayOpen {
+		t.Errorf("stuck relay close: status %+v, error %v", status, err)
+	}
+	if _, err = device.ControlRelay(RelayTrip, validUntil, 2, 0x654321, 0); !errors.Is(err, &DltError{FunctionCode: FunctionCodeRelayControl, ExceptionCode: ExceptionCodeIllegalPassword}) {
+		t.Errorf("wrong password: error %v", err)
+	}
+
+	want := []RelayCommand{RelayTrip, RelayAllowClose, RelayKeepPower, RelayAlarm, RelayClose}
+	if len(meter.commands) != len(want) {
+		t.Fatalf("commands %x, want %x", meter.commands, want)
+	}
+	for i := range want {
+		if meter.commands[i] != want[i] {
+			t.Errorf("command %d '%02x', want '%02x'", i, byte(meter.commands[i]), byte(want[i]))
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package dlt645
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	retryMaxAttempts = 3
+	retryBackoff     = 100 * time.Millisecond
+	retryMaxBackoff  = 2 * time.Second
+)
+
+// RetryPolicy decides which commands of a retry client are repeated.
+//
+// Only reads are retried unless RetryWrites or RetryClears is set. A write
+// that timed out may still have been executed by the meter, repeating it is
+// harmless for most parameters but ClearAmmeter, ClearMaximumDemand and
+// ClearEvent must not run twice unnoticed, neither must RelayControl.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one
+	MaxAttempts int
+	// Backoff is the wait before the second attempt, it doubles for every
+	// further attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retryable reports whether an attempt failing with err is repeated,
+	// nil means IsRetryable
+	Retryable func(err error) bool
+	// RetryWrites retries WriteData, WriteCommunicationAddress,
+	// BroadcastTiming, FreezeCommand, ChangeCommunicationRate and
+	// ChangePassword
+	RetryWrites bool
+	// RetryClears retries ClearMaximumDemand, ClearAmmeter and ClearEvent
+	RetryClears bool
+	// RetryControls retries RelayControl, SecureRelayControl,
+	// MultiFunctionOutput and SecurityAuthentication
+	RetryControls bool
+}
+
+// DefaultRetryPolicy retries reads 3 times on transmission errors.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: retryMaxAttempts,
+		Backoff:     retryBackoff,
+		MaxBackoff:  retryMaxBackoff,
+	}
+}
+
+// IsRetryable reports whether err is a transmission error a new attempt may
+// cure: timeouts, checksum errors, garbled or foreign frames. Exception
+// answers of the meter and cancellation are not.
+func IsRetryable(err error) bool {
+	for _, target := range []error{ErrTimeout, ErrChecksum, ErrMalformedFrame, ErrFrameTooShort, ErrAddressMismatch, ErrUnexpectedFunctionCode} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryError is returned by a retry client for a failed command, Err is the
+// error of the last attempt.
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	if e.Attempts == 1 {
+		return fmt.Sprintf("%v (1 attempt)", e.Err)
+	}
+	return fmt.Sprintf("%v (%d attempts)", e.Err, e.Attempts)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// command classes of a retry client
+const (
+	commandRead = iota
+	commandWrite
+	commandClear
+	commandControl
+)
+
+type retryClient struct {
+	client ContextClient
+	policy RetryPolicy
+}
+
+// NewRetryClient returns a Client repeating the commands of client as
+// allowed by policy.
+func NewRetryClient(client Client, policy RetryPolicy) Client {
+	return &retryClient{client: contextClient(client), policy: policy}
+}
+
+func (dtl *retryClient) ReadData(dataMarker uint32, blockQuantity uint8, year, month, day, hour, minute uint8) (results []byte, err error) {
+	return dtl.ReadDataContext(context.Background(), dataMarker, blockQuantity, year, month, day, hour, minute)
+}
+
+func (dtl *retryClient) ReadDataContext(ctx context.Context, dataMarker uint32, blockQuantity uint8, year, month, day, hour, minute uint8) (results []byte, err error) {
+	err = dtl.do(ctx, commandRead, func() (err error) {
+		results, err = dtl.client.ReadDataContext(ctx, dataMarker, blockQuantity, year, month, day, hour, minute)
+		return
+	})
+	return
+}
+
+func (dtl *retryClient) WriteData(dataMarker uint32, passwordPermission uint8, password uint32, operatorCode uint32, data []byte) (results []byte, err error) {
+	return dtl.WriteDataContext(context.Background(), dataMarker, passwordPermission, password, operatorCode, data)
+}
+
+func (dtl *retryClient) WriteDataContext(ctx context.Context, dataMarker uint32, passwordPermission uint8, password uint32, operatorCode uint32, data []byte) (results []byte, err error) {
+	err = dtl.do(ctx, commandWrite, func() (err error) {
+		results, err = dtl.client.WriteDataContext(ctx, dataMarker, passwordPermission, password, operatorCode, data)
+		return
+	})
+	return
+}
+
+func (dtl *retryClient) ReadCommunicationAddress() (results []byte, err error) {
+	return dtl.ReadCommunicationAddressContext(context.Background())
+}
+
+func (dtl *retryClient) ReadCommunicationAddressContext(ctx context.Context) (results []byte, err error) {
+	err = dtl.do(ctx, commandRead, func() (err error) {
+		results, err = dtl.client.ReadCommunicationAddressContext(ctx)
+		return
+	})
+	return
+}
+
+func (dtl *retryClient) WriteCommunicationAddress(commAddr uint64) (results []byte, err error) {
+	return dtl.WriteCommunicationAddressContext(context.Background(), commAddr)
+}
+
+func (dtl *retryClient) WriteCommunicationAddressContext(ctx context.Context, commAddr uint64) (results []byte, err error) {
+	err = dtl.do(ctx, commandWrite, func() (err error) {
+		results, err = dtl.client.WriteCommunicationAddressContext(ctx, commAddr)
+		return
+	})
+	return
+}
+
+func (dtl *retryClient) BroadcastTiming(year, month, day, hour, minute, second uint8) (err error) {
+	return dtl.BroadcastTimingContext(context.Background(), year, month, day, hour, minute, second)
+}
+
+func (dtl *retryClient) BroadcastTimingContext(ctx context.Context, year, month, day, hour, minute, second uint8) (err error) {
+	return dtl.do(ctx, commandWrite, func() error {
+		return dtl.client.BroadcastTimingContext(ctx, year, month, day, hour, minute, second)
+	})
+}
+
+func (dtl *retryClient) FreezeCommand(month, day, hour, minute uint8) (results []byte, err error) {
+	return dtl.FreezeCommandContext(context.Background(), month, day, hour, minute)
+}
+
+func (dtl *retryClient) FreezeCommandContext(ctx context.Context, month, day, hour, minute uint8) (results []byte, err error) {
+	err = dtl.do(ctx, commandWrite, func() (err error) {
+		results, err = dtl.client.FreezeCommandContext(ctx, month, day, hour, minute)
+		return
+	})
+	return
+}
+
+func (dtl *retryClient) ChangeCommunicationRate(word uint8) (results []byte, err error) {
+	return dtl.ChangeCommunicationRateContext(context.Background(), word)
+}
+
+func (dtl *retryClient) ChangeCommunicationRateContext(ctx context.Context, word uint8) (results []byte, err error) {
+	err = dtl.do(ctx, commandWrite, func() (err error) {
+		results, err = dtl.client.ChangeCommunicationRateContext(ctx, word)
+		return
+	})
+	return
+}
+
+func (dtl *retryClient) ChangePassword(dataMarker uint32, oldPasswordPermission uint8, oldPassword uint32, newPasswordPermission uint8, newPassword uint32) (results []byte, err error) {
+	return dtl.ChangePasswordContext(context.Background(), dataMarker, oldPasswordPermission, oldPassword, newPasswordPermission, newPassword)
+}
+
+func (dtl *retryClient) ChangePasswordContext(ctx context.Context, dataMarker uint32, oldPasswordPermission uint8, oldPassword uint32, newPasswordPermission uint8, newPassword uint32) (results []byte, err error) {
+	err = dtl.do(ctx, commandWrite, func() (err error) {
+		results, err = dtl.client.ChangePasswordContext(ctx, dataMarker, oldPasswordPermission, oldPassword, newPasswordPermission, newPassword)
+		return
+	})
+	return
+}
+
+func (dtl *retryClient) ClearMaximumDemand(passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	return dtl.ClearMaximumDemandContext(context.Background(), passwordPermission, password, operatorCode)
+}
+
+func (dtl *retryClient) ClearMaximumDemandContext(ctx context.Context, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	err = dtl.do(ctx, commandClear, func() (err error) {
+		results, err = dtl.client.ClearMaximumDemandContext(ctx, passwordPermission, password, operatorCode)
+		return
+	})
+	return
+}
+
+func (dtl *retryClient) ClearAmmeter(passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	return dtl.ClearAmmeterContext(context.Background(), passwordPermission, password, operatorCode)
+}
+
+func (dtl *retryClient) ClearAmmeterContext(ctx context.Context, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	err = dtl.do(ctx, commandClear, func() (err error) {
+		results, err = dtl.client.ClearAmmeterContext(ctx, passwordPermission, password, operatorCode)
+		return
+	})
+	return
+}
+
+func (dtl *retryClient) ClearEvent(dataMarker uint32, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	return dtl.ClearEventContext(context.Background(), dataMarker, passwordPermission, password, operatorCode)
+}
+
+func (dtl *retryClient) ClearEventContext(ctx context.Context, dataMarker uint32, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	err = dtl.do(ctx, commandClear, func() (err error) {
+		results, err = dtl.client.ClearEventContext(ctx, dataMarker, passwordPermission, password, operatorCode)
+		return
+	})
+	return
+}
+
+func (dtl *retryClient) RelayControl(command RelayCommand, validUntil time.Time, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	return dtl.RelayControlContext(context.Background(), command, validUntil, passwordPermission, password, operatorCode)
+}
+
+func (dtl *retryClient) RelayControlContext(ctx context.Context, command RelayCommand, validUntil time.Time, passwordPermission uint8, password uint32, operatorCode uint32) (results []byte, err error) {
+	client, err := relayClient(dtl.client)
+	if err != nil {
+		return
+	}
+	err = dtl.do(ctx, commandControl, func() (err error) {
+		results, err = client.RelayControlContext(ctx, command, validUntil, passwordPermission, password, operatorCode)
+		return
+	})
+	return
+}
+
+func (dtl *retryClient) MultiFunctionOutput(output TerminalOutput) (results []byte, err error) {
+	return dtl.MultiFunctionOutputContext(context.Background(), output)
+}
+
+func (dtl *retryClient) MultiFunctionOutputContext(ctx context.Context, output TerminalOutput) (results []byte, err error) {
+	client, err := relayClient(dtl.client)
+	if err != nil {
+		return
+	}
+	err = dtl.do(ctx, commandControl, func() (err error) {
+		results, err = client.MultiFunctionOutputContext(ctx, output)
+		return
+	})
+	return
+}
+
+func (dtl *retryClient) SecurityAuthentication(dataMarker uint32, operatorCode uint32, data []byte) (results []byte, err error) {
+	return dtl.SecurityAuthenticationContext(context.Background(), dataMarker, operatorCode, data)
+}
+
+func (dtl *retryClient) SecurityAuthenticationContext(ctx context.Context, dataMarker uint32, operatorCode uint32, data []byte) (results []byte, err error) {
+	client, err := securityClient(dtl.client)
+	if err != nil {
+		return
+	}
+	err = dtl.do(ctx, commandControl, func() (err error) {
+		results, err = client.SecurityAuthenticationContext(ctx, dataMarker, operatorCode, data)
+		return
+	})
+	return
+}
+
+func (dtl *retryClient) SecureRelayControl(operatorCode uint32, ciphertext []byte) (results []byte, err error) {
+	return dtl.SecureRelayControlContext(context.Background(), operatorCode, ciphertext)
+}
+
+func (dtl *retryClient) SecureRelayControlContext(ctx context.Context, operatorCode uint32, ciphertext []byte) (results []byte, err error) {
+	client, err := securityClient(dtl.client)
+	if err != nil {
+		return
+	}
+	err = dtl.do(ctx, commandControl, func() (err error) {
+		results, err = client.SecureRelayControlContext(ctx, operatorCode, ciphertext)
+		return
+	})
+	return
+}
+
+// do runs attempt until it succeeds or the policy gives up, errors are
+// returned as *RetryError.
+func (dtl *retryClient) do(ctx context.Context, class int, attempt func() error) (err error) {
+	maxAttempts := dtl.policy.MaxAttempts
+	if (class == commandWrite && !dtl.policy.RetryWrites) || (class == commandClear && !dtl.policy.RetryClears) ||
+		(class == commandControl && !dtl.policy.RetryControls) || maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	retryable := dtl.policy.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+
+	backoff := dtl.policy.Backoff
+	for attempts := 1; ; attempts++ {
+		if err = attempt(); err == nil {
+			return
+		}
+		if attempts >= maxAttempts || ctx.Err() != nil || !retryable(err) {
+			err = &RetryError{Attempts: attempts, Err: err}
+			return
+		}
+		if backoff > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				err = &RetryError{Attempts: attempts, Err: err}
+				return
+			}
+			if backoff *= 2; dtl.policy.MaxBackoff > 0 && backoff > dtl.policy.MaxBackoff {
+				backoff = dtl.policy.MaxBackoff
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package dlt645
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingMeter answers after failing the first failures requests with no
+// answer, it counts the requests.
+func failingMeter(failures int32, controlCode byte, data ...byte) (meter scriptedMeter, requests *int32) {
+	requests = new(int32)
+	addr := addressToDataDomain(304257140001)
+	meter = func(request []byte) []byte {
+		if atomic.AddInt32(requests, 1) <= failures {
+			return nil
+		}
+		return encodeFrame(addr, controlCode, data)
+	}
+	return
+}
+
+func TestRetryClient(t *testing.T) {
+	reading := []byte{0x00, 0x00, 0x00, 0x00, 0x12, 0x34, 0x56, 0x00}
+	policy := RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+	read := func(c Client) (err error) {
+		_, err = c.ReadData(0x00000000, 0, 0, 0, 0, 0, 0)
+		return
+	}
+	write := func(c Client) (err error) {
+		_, err = c.WriteData(0x04000103, 2, 0, 0, []byte{0x15})
+		return
+	}
+	clear := func(c Client) (err error) {
+		_, err = c.ClearEvent(0xFFFFFFFF, 2, 0, 0)
+		return
+	}
+	relay := func(c Client) (err error) {
+		_, err = c.(RelayClient).RelayControl(RelayTrip, time.Now(), 2, 0, 0)
+		return
+	}
+	tests := []struct {
+		name        string
+		policy      func(p *RetryPolicy)
+		failures    int32
+		controlCode byte
+		data        []byte
+		send        func(c Client) error
+		requests    int32
+		wantErr     error
+	}{
+		{"read recovers", nil, 2, 0x91, reading, read, 3, nil},
+		{"read gives up", nil, 3, 0x91, reading, read, 3, ErrTimeout},
+		{"exception answer", nil, 0, 0xD1, []byte{ExceptionCodeRequestWithoutData}, read, 1, ErrSlaveException},
+		{"not retryable", func(p *RetryPolicy) { p.Retryable = func(err error) bool { return false } }, 1, 0x91, reading, read, 1, ErrTimeout},
+		{"write", nil, 1, 0x94, nil, write, 1, ErrTimeout},
+		{"write retried", func(p *RetryPolicy) { p.RetryWrites = true }, 1, 0x94, nil, write, 2, nil},
+		{"clear", func(p *RetryPolicy) { p.RetryWrites = true }, 1, 0x9B, nil, clear, 1, ErrTimeout},
+		{"clear retried", func(p *RetryPolicy) { p.RetryClears = true }, 1, 0x9B, nil, clear, 2, nil},
+		{"relay control", func(p *RetryPolicy) { p.RetryWrites, p.RetryClears = true, true }, 1, 0x9C, nil, relay, 1, ErrTimeout},
+		{"relay control retried", func(p *RetryPolicy) { p.RetryControls = true }, 1, 0x9C, nil, relay, 2, nil},
+		{"single attempt", func(p *RetryPolicy) { p.MaxAttempts = 0 }, 1, 0x91, reading, read, 1, ErrTimeout},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			meter, requests := failingMeter(test.failures, test.controlCode, test.data...)
+			p := policy
+			if test.policy != nil {
+				test.policy(&p)
+			}
+			client := NewRetryClient(NewMeterClient(serialMeter(t, meter), 304257140001), p)
+			err := test.send(client)
+			if n := atomic.LoadInt32(requests); n != test.requests {
+				t.Errorf("%d requests, want %d", n, test.requests)
+			}
+			if test.wantErr == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var retryError *RetryError
+			if !errors.Is(err, test.wantErr) || !errors.As(err, &retryError) || retryError.Attempts != int(test.requests) {
+				t.Fatalf("error %v, want %v after %d attempts", err, test.wantErr, test.requests)
+			}
+		})
+	}
+}
+
+func TestRetryClientCancel(t *testing.T) {
+	meter, requests := failingMeter(100, 0x91)
+	client := NewRetryClient(NewMeterClient(serialMeter(t, meter), 304257140001), RetryPolicy{MaxAttempts: 10, Backoff: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.(ContextClient).ReadDataContext(ctx, 0x00000000, 0, 0, 0, 0, 0, 0)
+	var retryError *RetryError
+	if !errors.As(err, &retryError) || retryError.Attempts != 1 || time.Since(start) > time.Second {
+		t.Errorf("error %v after %v", err, time.Since(start))
+	}
+	if n := atomic.LoadInt32(requests); n != 1 {
+		t.Errorf("%d requests, want 1", n)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{ErrTimeout, true},
+		{fmt.Errorf("dlt645: read: %w", ErrChecksum), true},
+		{ErrMalformedFrame, true},
+		{ErrFrameTooShort, true},
+		{ErrAddressMismatch, true},
+		{ErrUnexpectedFunctionCode, true},
+		{&DltError{ExceptionCode: ExceptionCodeOtherError}, false},
+		{context.Canceled, false},
+		{ErrNotSupported, false},
+	}
+	for _, test := range tests {
+		if got := IsRetryable(test.err); got != test.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
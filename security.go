@@ -0,0 +1,312 @@
+package dlt645
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// security authentication data identifiers
+const (
+	securityAuthenticateMarker = 0x070000FF // 身份认证
+	securityValidityMarker     = 0x070001FF // 身份认证时效设置
+	securityInvalidateMarker   = 0x070002FF // 身份认证失效
+
+	// default validity of a session
+	securityValidity = 5 * time.Minute
+)
+
+// Bits of the security error word SERR.
+const (
+	SecurityErrorOther                  = 0x0001 // 其它错误
+	SecurityErrorRepeatedRecharge       = 0x0002 // 重复充值
+	SecurityErrorESAMVerification       = 0x0004 // ESAM验证失败
+	SecurityErrorAuthentication         = 0x0008 // 身份认证失败
+	SecurityErrorCustomerNumberMismatch = 0x0010 // 客户编号不匹配
+	SecurityErrorRechargeCount          = 0x0020 // 充值次数错误
+	SecurityErrorPurchaseExceedsLimit   = 0x0040 // 购电超囤积
+)
+
+var securityErrorNames = []struct {
+	code uint16
+	name string
+}{
+	{SecurityErrorOther, "Other error"},
+	{SecurityErrorRepeatedRecharge, "Repeated recharge"},
+	{SecurityErrorESAMVerification, "ESAM verification failed"},
+	{SecurityErrorAuthentication, "Authentication failed"},
+	{SecurityErrorCustomerNumberMismatch, "Customer number mismatch"},
+	{SecurityErrorRechargeCount, "Recharge count error"},
+	{SecurityErrorPurchaseExceedsLimit, "Purchase exceeds the hoarding limit"},
+}
+
+// ErrNoSecuritySession is returned for protected commands sent without a
+// valid security session.
+var ErrNoSecuritySession = errors.New("dlt645: no valid security session")
+
+// SecurityError is the exception answer to a security authentication, Code
+// is the security error word SERR.
+type SecurityError struct {
+	Code uint16
+}
+
+func (e *SecurityError) Error() string {
+	var names []string
+	for _, serr := range securityErrorNames {
+		if e.Code&serr.code != 0 {
+			names = append(names, serr.name)
+		}
+	}
+	if len(names) == 0 {
+		names = append(names, "Unknown")
+	}
+	return fmt.Sprintf("dlt645: security error '%04x' (%s)", e.Code, strings.Join(names, ", "))
+}
+
+// Is matches ErrSlaveException and a *SecurityError whose bits are all set
+// in e.
+func (e *SecurityError) Is(target error) bool {
+	if target == ErrSlaveException {
+		return true
+	}
+	t, ok := target.(*SecurityError)
+	return ok && e.Code&t.Code == t.Code
+}
+
+// CryptoProvider performs the crypto operations of a security session, e.g.
+// through an ESAM, an encryption machine or a software implementation in
+// tests. All data are in transmission order.
+type CryptoProvider interface {
+	// Authenticate returns random 1 and ciphertext 1, 8 bytes each, to
+	// authenticate to the meter of the diversification factor
+	Authenticate(ctx context.Context, factor []byte) (random1, ciphertext1 []byte, err error)
+	// MAC returns the 4 byte MAC of the data domain preceding it
+	MAC(ctx context.Context, session SessionInfo, data []byte) (mac []byte, err error)
+	// Encrypt returns the ciphertext of data as the meter expects it,
+	// including its MAC where the command carries no separate one
+	Encrypt(ctx context.Context, session SessionInfo, data []byte) (ciphertext []byte, err error)
+}
+
+// SessionInfo is the state of an established security session the session
+// keys derive from.
+type SessionInfo struct {
+	Factor     []byte
+	Random1    []byte
+	Random2    []byte
+	ESAMSerial []byte
+	Expires    time.Time
+}
+
+// SecuritySession authenticates to a meter with an ESAM and protects the
+// commands sent until the session expires. It is safe for concurrent use.
+type SecuritySession struct {
+	Client   Client
+	Provider CryptoProvider
+	// Factor is the diversification factor, nil means the communication
+	// address followed by 00 00
+	Factor       []byte
+	Address      uint64
+	OperatorCode uint32
+	// Validity is the session time the meter is configured for, 5 minutes
+	// if zero
+	Validity time.Duration
+
+	mu   sync.Mutex
+	info SessionInfo
+}
+
+// NewSecuritySession allocates a session to the meter of address.
+func NewSecuritySession(client Client, provider CryptoProvider, address uint64) *SecuritySession {
+	return &SecuritySession{Client: client, Provider: provider, Address: address}
+}
+
+// Info returns the state of the session, the zero SessionInfo if there is
+// none.
+func (s *SecuritySession) Info() SessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.info
+}
+
+// Valid reports whether the session is established and not expired.
+func (s *SecuritySession) Valid() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.valid()
+}
+
+func (s *SecuritySession) valid() bool {
+	return s.info.Random2 != nil && time.Now().Before(s.info.Expires)
+}
+
+// Authenticate establishes the session, sending ciphertext 1, random 1 and
+// the diversification factor, the meter answers with random 2 and its ESAM
+// serial number.
+func (s *SecuritySession) Authenticate(ctx context.Context) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, err := securityClient(s.Client)
+	if err != nil {
+		return
+	}
+	factor := s.Factor
+	if factor == nil {
+		factor = append(addressToDataDomain(s.Address), 0x00, 0x00)
+	}
+	if len(factor) != 8 {
+		err = fmt.Errorf("dlt645: diversification factor length '%v' does not match expected '8'", len(factor))
+		return
+	}
+	random1, ciphertext1, err := s.Provider.Authenticate(ctx, factor)
+	if err != nil {
+		return
+	}
+	if len(random1) != 8 || len(ciphertext1) != 8 {
+		err = fmt.Errorf("dlt645: random 1 and ciphertext 1 length '%v'&'%v' must be '8'", len(random1), len(ciphertext1))
+		return
+	}
+
+	s.info = SessionInfo{}
+	start := time.Now()
+	results, err := client.SecurityAuthenticationContext(ctx, securityAuthenticateMarker, s.OperatorCode,
+		uintArrayToDataDomain(ciphertext1, random1, factor))
+	if err != nil {
+		return
+	}
+	// R2 (4 bytes) ESAM serial number (8 bytes)
+	if len(results) != 12 {
+		err = fmt.Errorf("%w: authentication answer length '%v' does not match expected '12'", ErrMalformedFrame, len(results))
+		return
+	}
+	s.info = SessionInfo{
+		Factor:     factor,
+		Random1:    random1,
+		Random2:    results[:4],
+		ESAMSerial: results[4:],
+		Expires:    start.Add(s.validity()),
+	}
+	return
+}
+
+// SetValidity changes the session time of the meter, in whole minutes.
+func (s *SecuritySession) SetValidity(ctx context.Context, validity time.Duration) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, err := securityClient(s.Client)
+	if err != nil {
+		return
+	}
+	if !s.valid() {
+		err = ErrNoSecuritySession
+		return
+	}
+	minutes := int(validity / time.Minute)
+	if minutes < 1 || minutes > 9999 {
+		err = fmt.Errorf("dlt645: validity '%v' must be between '1m' and '9999m'", validity)
+		return
+	}
+	data := bcdArrayToDataDomain(uint8(minutes%100), uint8(minutes/100))
+	if data, err = s.appendMAC(ctx, uintArrayToDataDomain(uint32(securityValidityMarker), s.OperatorCode), data); err != nil {
+		return
+	}
+	if _, err = client.SecurityAuthenticationContext(ctx, securityValidityMarker, s.OperatorCode, data); err != nil {
+		return
+	}
+	s.Validity = time.Duration(minutes) * time.Minute
+	return
+}
+
+// Invalidate ends the session on the meter.
+func (s *SecuritySession) Invalidate(ctx context.Context) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, err := securityClient(s.Client)
+	if err != nil {
+		return
+	}
+	_, err = client.SecurityAuthenticationContext(ctx, securityInvalidateMarker, s.OperatorCode, nil)
+	s.info = SessionInfo{}
+	return
+}
+
+// WriteData writes data protected by a MAC, encrypted with password
+// permission 98 or in plain text with 99 as the meter requires for the
+// data identifier.
+func (s *SecuritySession) WriteData(ctx context.Context, dataMarker uint32, data []byte, encrypt bool) (results []byte, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.valid() {
+		err = ErrNoSecuritySession
+		return
+	}
+	passwordPermission := uint8(PasswordPermissionPlainMAC)
+	if encrypt {
+		passwordPermission = PasswordPermissionCipherMAC
+		if data, err = s.Provider.Encrypt(ctx, s.info, data); err != nil {
+			return
+		}
+	}
+	// DI0..DI3 PA 00 00 00 C0..C3 data MAC
+	header := uintArrayToDataDomain(dataMarker, passwordField(passwordPermission, 0), s.OperatorCode)
+	if data, err = s.appendMAC(ctx, header, data); err != nil {
+		return
+	}
+	return contextClient(s.Client).WriteDataContext(ctx, dataMarker, passwordPermission, 0, s.OperatorCode, data)
+}
+
+// RelayControl sends a relay command encrypted with password permission 98.
+func (s *SecuritySession) RelayControl(ctx context.Context, command RelayCommand, validUntil time.Time) (results []byte, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, err := securityClient(s.Client)
+	if err != nil {
+		return
+	}
+	if !s.valid() {
+		err = ErrNoSecuritySession
+		return
+	}
+	ciphertext, err := s.Provider.Encrypt(ctx, s.info, relayControlData(command, validUntil))
+	if err != nil {
+		return
+	}
+	return client.SecureRelayControlContext(ctx, s.OperatorCode, ciphertext)
+}
+
+// appendMAC appends the MAC of header and data to data.
+func (s *SecuritySession) appendMAC(ctx context.Context, header, data []byte) (protected []byte, err error) {
+	mac, err := s.Provider.MAC(ctx, s.info, append(append([]byte(nil), header...), data...))
+	if err != nil {
+		return
+	}
+	if len(mac) != 4 {
+		err = fmt.Errorf("dlt645: MAC length '%v' does not match expected '4'", len(mac))
+		return
+	}
+	protected = append(append([]byte(nil), data...), mac...)
+	return
+}
+
+func (s *SecuritySession) validity() time.Duration {
+	if s.Validity > 0 {
+		return s.Validity
+	}
+	return securityValidity
+}
+
+// securityClient returns client as a SecurityClient.
+func securityClient(client Client) (security SecurityClient, err error) {
+	security, ok := client.(SecurityClient)
+	if !ok {
+		err = fmt.Errorf("dlt645: security authentication: %w", ErrNotSupported)
+	}
+	return
+}
@@ -0,0 +1,182 @@
+package dlt645
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+	"time"
+)
+
+// testCrypto is a CryptoProvider with toy algorithms: ciphertext 1 is the
+// inverted factor, the MAC a CRC-32 and encryption XOR 0x5A.
+type testCrypto struct{}
+
+func (testCrypto) Authenticate(ctx context.Context, factor []byte) (random1, ciphertext1 []byte, err error) {
+	random1 = []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	for _, b := range factor {
+		ciphertext1 = append(ciphertext1, ^b)
+	}
+	return
+}
+
+func (testCrypto) MAC(ctx context.Context, session SessionInfo, data []byte) (mac []byte, err error) {
+	mac = make([]byte, 4)
+	binary.LittleEndian.PutUint32(mac, crc32.ChecksumIEEE(data))
+	return
+}
+
+func (testCrypto) Encrypt(ctx context.Context, session SessionInfo, data []byte) (ciphertext []byte, err error) {
+	for _, b := range data {
+		ciphertext = append(ciphertext, b^0x5A)
+	}
+	return
+}
+
+// checkMAC splits protected into data and MAC and checks the MAC of header
+// and data.
+func checkMAC(header, protected []byte) (data []byte, ok bool) {
+	if len(protected) < 4 {
+		return
+	}
+	data = protected[:len(protected)-4]
+	mac, _ := testCrypto{}.MAC(context.Background(), SessionInfo{}, append(append([]byte(nil), header...), data...))
+	return data, bytes.Equal(mac, protected[len(protected)-4:])
+}
+
+// esamMeter answers the security authentications of a simulated meter.
+type esamMeter struct {
+	validity []byte
+	invalid  bool
+}
+
+func (m *esamMeter) security(dataMarker uint32, operatorCode uint32, data []byte) (answer []byte, err error) {
+	switch dataMarker {
+	case securityAuthenticateMarker:
+		// ciphertext 1, random 1, factor
+		if len(data) != 24 {
+			return nil, &SecurityError{Code: SecurityErrorOther}
+		}
+		for i := 0; i < 8; i++ {
+			if data[i] != ^data[16+i] {
+				return nil, &SecurityError{Code: SecurityErrorAuthentication}
+			}
+		}
+		m.invalid = false
+		return []byte{0x21, 0x22, 0x23, 0x24, 0x81, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88}, nil
+	case securityValidityMarker:
+		validity, ok := checkMAC(uintArrayToDataDomain(dataMarker, operatorCode), data)
+		if !ok {
+			return nil, &SecurityError{Code: SecurityErrorESAMVerification}
+		}
+		m.validity = validity
+	case securityInvalidateMarker:
+		m.invalid = true
+	}
+	return
+}
+
+func TestSecuritySessionSimulator(t *testing.T) {
+	store := NewMemoryStore()
+	esam := &esamMeter{}
+	server := NewServer(304257140001, store)
+	server.OnSecurity = esam.security
+	ctx := context.Background()
+	session := NewSecuritySession(newSimulatedSerialHandler(t, server).Meter(304257140001), testCrypto{}, 304257140001)
+	session.OperatorCode = 0x11223344
+
+	if _, err := session.WriteData(ctx, 0x04000108, []byte{0x01}, false); err != ErrNoSecuritySession {
+		t.Errorf("write without session: error %v, want ErrNoSecuritySession", err)
+	}
+
+	start := time.Now()
+	if err := session.Authenticate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	info := session.Info()
+	if !session.Valid() || !bytes.Equal(info.Random2, []byte{0x21, 0x22, 0x23, 0x24}) || !bytes.Equal(info.ESAMSerial, []byte{0x81, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88}) {
+		t.Errorf("session %+v", info)
+	}
+	// the factor defaults to the address followed by 00 00
+	if want := append(addressToDataDomain(304257140001), 0x00, 0x00); !bytes.Equal(info.Factor, want) {
+		t.Errorf("factor % x, want % x", info.Factor, want)
+	}
+	if info.Expires.Before(start.Add(securityValidity)) || info.Expires.After(time.Now().Add(securityValidity)) {
+		t.Errorf("session expires %v", info.Expires)
+	}
+
+	// DI0..DI3 PA 00 00 00 C0..C3 data MAC, the meter keeps data MAC
+	header := uintArrayToDataDomain(uint32(0x04000108), passwordField(PasswordPermissionPlainMAC, 0), session.OperatorCode)
+	if _, err := session.WriteData(ctx, 0x04000108, []byte{0x01, 0x02}, false); err != nil {
+		t.Fatal(err)
+	}
+	written, _ := store.Read(0x04000108)
+	if data, ok := checkMAC(header, written); !ok || !bytes.Equal(data, []byte{0x01, 0x02}) {
+		t.Errorf("plain text write % x, MAC ok %v", written, ok)
+	}
+	header = uintArrayToDataDomain(uint32(0x04000108), passwordField(PasswordPermissionCipherMAC, 0), session.OperatorCode)
+	if _, err := session.WriteData(ctx, 0x04000108, []byte{0x01, 0x02}, true); err != nil {
+		t.Fatal(err)
+	}
+	written, _ = store.Read(0x04000108)
+	if data, ok := checkMAC(header, written); !ok || !bytes.Equal(data, []byte{0x5B, 0x58}) {
+		t.Errorf("encrypted write % x, MAC ok %v", written, ok)
+	}
+
+	if err := session.SetValidity(ctx, 30*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(esam.validity, []byte{0x30, 0x00}) || session.Validity != 30*time.Minute {
+		t.Errorf("validity % x, session %v", esam.validity, session.Validity)
+	}
+	if err := session.SetValidity(ctx, 30*time.Second); err == nil {
+		t.Error("validity below a minute set")
+	}
+
+	if err := session.Invalidate(ctx); err != nil || session.Valid() || !esam.invalid {
+		t.Errorf("invalidate: valid %v, meter invalid %v, error %v", session.Valid(), esam.invalid, err)
+	}
+
+	session.Factor = []byte{1, 2, 3, 4, 5, 6, 7}
+	if err := session.Authenticate(ctx); err == nil {
+		t.Error("7 byte factor used")
+	}
+}
+
+func TestSecuritySessionErrors(t *testing.T) {
+	server := NewServer(304257140001, NewMemoryStore())
+	server.OnSecurity = func(dataMarker uint32, operatorCode uint32, data []byte) (answer []byte, err error) {
+		return nil, &SecurityError{Code: SecurityErrorAuthentication | SecurityErrorESAMVerification}
+	}
+	session := NewSecuritySession(newSimulatedSerialHandler(t, server).Meter(304257140001), testCrypto{}, 304257140001)
+	err := session.Authenticate(context.Background())
+	if !errors.Is(err, &SecurityError{Code: SecurityErrorAuthentication}) || !errors.Is(err, ErrSlaveException) || session.Valid() {
+		t.Errorf("failed authentication: error %v, valid %v", err, session.Valid())
+	}
+
+	server.OnSecurity = func(dataMarker uint32, operatorCode uint32, data []byte) (answer []byte, err error) {
+		return []byte{0x21, 0x22, 0x23, 0x24}, nil
+	}
+	if err = session.Authenticate(context.Background()); !errors.Is(err, ErrMalformedFrame) || session.Valid() {
+		t.Errorf("short answer: error %v, valid %v", err, session.Valid())
+	}
+}
+
+func TestSecureRelayControlFrame(t *testing.T) {
+	transporter := &recordingTransporter{}
+	session := NewSecuritySession(NewMeterClient(transporter, 304257140001), testCrypto{}, 304257140001)
+	session.OperatorCode = 0x11223344
+	session.info = SessionInfo{Random2: []byte{0x21, 0x22, 0x23, 0x24}, Expires: time.Now().Add(time.Minute)}
+
+	validUntil := time.Date(2024, 5, 6, 7, 8, 9, 0, time.Local)
+	if _, err := session.RelayControl(context.Background(), RelayTrip, validUntil); err != errRecorded {
+		t.Fatal(err)
+	}
+	// PA 00 00 00 C0..C3, then N1 N2 ss mm hh DD MM YY encrypted
+	want := "68 01 00 14 57 42 30 68 1c 10 cb 33 33 33 77 66 55 44 73 8d 86 85 90 8f 92 b1 21 16"
+	if got := transporter.request(t); got != unspaced(want) {
+		t.Errorf("request %s, want %s", got, unspaced(want))
+	}
+}
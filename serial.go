@@ -1,6 +1,7 @@
 package dlt645
 
 import (
+	"context"
 	"io"
 	"log"
 	"sync"
@@ -12,19 +13,28 @@ import (
 const (
 	serialTimeout     = 5 * time.Second
 	serialIdleTimeout = 60 * time.Second
+
+	// USB adapters deliver received bytes in chunks of their latency timer
+	serialMinInterCharacterTimeout = 50 * time.Millisecond
 )
 
-// serialPort has configuration and I/O controller.
+// serialPort has configuration and I/O controller. Timeout is the time the
+// first byte of a response may take.
 type serialPort struct {
 	serial.Config
 
 	Logger      *log.Logger
 	IdleTimeout time.Duration
+	// InterCharacterTimeout is the silence ending a response, zero derives
+	// it from BaudRate
+	InterCharacterTimeout time.Duration
 
 	mu           sync.Mutex
 	port         io.ReadWriteCloser
 	lastActivity time.Time
 	closeTimer   *time.Timer
+	// input may hold stale bytes, see drain
+	dirty bool
 }
 
 func (dlt *serialPort) Connect() (err error) {
@@ -36,11 +46,16 @@ func (dlt *serialPort) Connect() (err error) {
 
 func (dlt *serialPort) connect() error {
 	if dlt.port == nil {
-		port, err := serial.Open(&dlt.Config)
+		// reads poll, the response timeouts and cancellation are handled by
+		// serialReader
+		config := dlt.Config
+		config.Timeout = dlt.interCharacterTimeout()
+		port, err := serial.Open(&config)
 		if err != nil {
 			return err
 		}
 		dlt.port = port
+		dlt.dirty = true
 	}
 	return nil
 }
@@ -90,3 +105,117 @@ func (dlt *serialPort) closeIdle() {
 		dlt.close()
 	}
 }
+
+// write writes all of data, the port may time out writing part of it.
+func (dlt *serialPort) write(ctx context.Context, data []byte) (err error) {
+	for len(data) > 0 {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		var n int
+		n, err = dlt.port.Write(data)
+		data = data[n:]
+		if err != nil && err != serial.ErrTimeout {
+			return
+		}
+	}
+	return nil
+}
+
+// drain discards the input left since the last complete response, e.g. the
+// late answer to a timed out request, so that it is not taken for the
+// response to the next one. Every read waits for the port timeout if the
+// line is quiet, the input is only drained when it may hold stale bytes: on
+// a newly opened port, after an exchange that failed and after a request
+// sent without waiting for the response.
+func (dlt *serialPort) drain(ctx context.Context) (err error) {
+	if !dlt.dirty {
+		return
+	}
+	var deadline time.Time
+	if dlt.Timeout > 0 {
+		deadline = time.Now().Add(dlt.Timeout)
+	}
+	var b [rtuMaxSize]byte
+	for deadline.IsZero() || time.Now().Before(deadline) {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		var n int
+		n, err = dlt.port.Read(b[:])
+		if n > 0 {
+			dlt.logf("dlt645: discarding % x\n", b[:n])
+			continue
+		}
+		if err != nil && err != serial.ErrTimeout {
+			return
+		}
+		break
+	}
+	dlt.dirty = false
+	return nil
+}
+
+// reader returns a reader for the response to the request just written.
+func (dlt *serialPort) reader(ctx context.Context) io.Reader {
+	r := &serialReader{ctx: ctx, port: dlt.port, interCharacter: dlt.interCharacterTimeout()}
+	if dlt.Timeout > 0 {
+		r.deadline = time.Now().Add(dlt.Timeout)
+	}
+	return r
+}
+
+func (dlt *serialPort) interCharacterTimeout() time.Duration {
+	if dlt.InterCharacterTimeout > 0 {
+		return dlt.InterCharacterTimeout
+	}
+	// ten characters of silence
+	timeout := dlt.calculateDelay(10)
+	if timeout < serialMinInterCharacterTimeout {
+		timeout = serialMinInterCharacterTimeout
+	}
+	return timeout
+}
+
+func (dlt *serialPort) calculateDelay(chars int) time.Duration {
+	var characterDelay, frameDelay int // us
+
+	if dlt.BaudRate <= 0 || dlt.BaudRate > 19200 {
+		characterDelay = 750
+		frameDelay = 1750
+	} else {
+		characterDelay = 15000000 / dlt.BaudRate
+		frameDelay = 35000000 / dlt.BaudRate
+	}
+	return time.Duration(characterDelay*chars+frameDelay) * time.Microsecond
+}
+
+// serialReader reads from a polling port until ctx is done or the deadline
+// passes with no data, serial.ErrTimeout is returned then. Every byte
+// received moves the deadline to interCharacter from now.
+type serialReader struct {
+	ctx            context.Context
+	port           io.Reader
+	deadline       time.Time
+	interCharacter time.Duration
+}
+
+func (r *serialReader) Read(p []byte) (n int, err error) {
+	for {
+		if err = r.ctx.Err(); err != nil {
+			return
+		}
+		n, err = r.port.Read(p)
+		if n > 0 {
+			r.deadline = time.Now().Add(r.interCharacter)
+			return n, nil
+		}
+		if err != nil && err != serial.ErrTimeout {
+			return
+		}
+		if !r.deadline.IsZero() && !time.Now().Before(r.deadline) {
+			err = serial.ErrTimeout
+			return
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package dlt645
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goburrow/serial"
+)
+
+// testSerialPort is a polling serial port on a simulated line. Bytes written
+// go to line, bytes the line sends back are queued by inject.
+type testSerialPort struct {
+	mu      sync.Mutex
+	input   []byte
+	timeout time.Duration
+	line    io.WriteCloser
+}
+
+func (p *testSerialPort) Read(b []byte) (n int, err error) {
+	deadline := time.Now().Add(p.timeout)
+	for {
+		p.mu.Lock()
+		n = copy(b, p.input)
+		p.input = p.input[n:]
+		p.mu.Unlock()
+		if n > 0 {
+			return
+		}
+		if !time.Now().Before(deadline) {
+			err = serial.ErrTimeout
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (p *testSerialPort) Write(b []byte) (n int, err error) {
+	return p.line.Write(b)
+}
+
+func (p *testSerialPort) Close() (err error) {
+	return p.line.Close()
+}
+
+// inject queues bytes received from the line.
+func (p *testSerialPort) inject(b []byte) (n int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.input = append(p.input, b...)
+	return len(b), nil
+}
+
+// lineFunc is a line whose devices are scripted.
+type lineFunc func(b []byte)
+
+func (f lineFunc) Write(b []byte) (n int, err error) {
+	f(b)
+	return len(b), nil
+}
+
+func (f lineFunc) Close() (err error) {
+	return
+}
+
+type writerFunc func(b []byte) (n int, err error)
+
+func (f writerFunc) Write(b []byte) (n int, err error) {
+	return f(b)
+}
+
+// newTestSerialHandler returns a handler on port with short timeouts.
+func newTestSerialHandler(port *testSerialPort) *Client2007Handler {
+	handler := NewClient2007Handler("")
+	handler.port = port
+	handler.Timeout = 100 * time.Millisecond
+	handler.InterCharacterTimeout = 10 * time.Millisecond
+	handler.IdleTimeout = 0
+	return handler
+}
+
+// newSimulatedSerialHandler returns a handler on a line the servers answer
+// on, they are served until the handler is closed.
+func newSimulatedSerialHandler(t *testing.T, servers ...*Server) *Client2007Handler {
+	t.Helper()
+	port := &testSerialPort{timeout: 5 * time.Millisecond}
+	var lines []io.Writer
+	var closers []io.Closer
+	for _, server := range servers {
+		r, w := io.Pipe()
+		lines = append(lines, w)
+		closers = append(closers, w)
+		go server.Serve(struct {
+			io.Reader
+			io.Writer
+		}{r, writerFunc(port.inject)})
+	}
+	writer := io.MultiWriter(lines...)
+	port.line = struct {
+		io.Writer
+		io.Closer
+	}{writer, closerFunc(func() error {
+		for _, c := range closers {
+			c.Close()
+		}
+		return nil
+	})}
+	handler := newTestSerialHandler(port)
+	t.Cleanup(func() { handler.Close() })
+	return handler
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+func TestSerialTransporterDrainsLateAnswer(t *testing.T) {
+	addr := addressToDataDomain(304257140001)
+	late := encodeFrame(addr, 0x91, []byte{0x00, 0x00, 0x00, 0x00, 0x11, 0x11, 0x11, 0x00})
+	answer := encodeFrame(addr, 0x91, []byte{0x00, 0x00, 0x01, 0x00, 0x22, 0x22, 0x22, 0x00})
+
+	port := &testSerialPort{timeout: 5 * time.Millisecond}
+	requests := 0
+	port.line = lineFunc(func(b []byte) {
+		requests++
+		if requests == 1 {
+			// answer the first request after the client gave up
+			time.AfterFunc(150*time.Millisecond, func() { port.inject(late) })
+			return
+		}
+		port.inject(answer)
+	})
+	handler := newTestSerialHandler(port)
+
+	request := encodeFrame(addr, FunctionCodeReadData, []byte{0x00, 0x00, 0x00, 0x00})
+	if _, err := handler.Send(request); !errors.Is(err, serial.ErrTimeout) {
+		t.Fatalf("first request error %v, want a timeout", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	response, err := handler.Send(encodeFrame(addr, FunctionCodeReadData, []byte{0x00, 0x00, 0x01, 0x00}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(response, answer) {
+		t.Fatalf("response % x, want % x", response, answer)
+	}
+}
+
+func TestSerialTransporterSimulator(t *testing.T) {
+	store := NewMemoryStore()
+	store.Write(0x00000000, []byte{0x12, 0x34, 0x56, 0x00})
+	handler := newSimulatedSerialHandler(t, NewServer(304257140001, store))
+	handler.SlaveAddr = 304257140001
+
+	client := NewClient(handler)
+	for i := 0; i < 3; i++ {
+		results, err := client.ReadData(0x00000000, 0, 0, 0, 0, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []byte{0x12, 0x34, 0x56, 0x00}; !bytes.Equal(results, want) {
+			t.Fatalf("results % x, want % x", results, want)
+		}
+	}
+	handler.SlaveAddr = 304257140002
+	if _, err := client.ReadData(0x00000000, 0, 0, 0, 0, 0, 0); err == nil {
+		t.Fatal("absent meter answered")
+	}
+}
+
+func TestSerialTransporterSendContext(t *testing.T) {
+	// a line nobody answers on
+	port := &testSerialPort{timeout: 5 * time.Millisecond, line: lineFunc(func(b []byte) {})}
+	handler := newTestSerialHandler(port)
+	handler.Timeout = 10 * time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := handler.SendContext(ctx, testReadRequest); err != context.DeadlineExceeded {
+		t.Fatalf("error %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("cancelled after %v", elapsed)
+	}
+}
+
+// scriptedLine answers every request with the chunks, each sent after its
+// delay.
+func scriptedLine(port *testSerialPort, delays []time.Duration, chunks [][]byte) lineFunc {
+	return func(b []byte) {
+		go func() {
+			for k, chunk := range chunks {
+				time.Sleep(delays[k])
+				port.inject(chunk)
+			}
+		}()
+	}
+}
+
+func TestSerialTransporterTiming(t *testing.T) {
+	answer := testReadAnswer
+	tests := []struct {
+		name   string
+		delays []time.Duration
+		chunks [][]byte
+		// the response must be complete, or fail within
+		ok      bool
+		elapsed time.Duration
+	}{
+		// a complete frame ends the response without waiting for silence
+		{"short reply", []time.Duration{20 * time.Millisecond}, [][]byte{answer}, true, 500 * time.Millisecond},
+		{"pause within a frame", []time.Duration{0, 50 * time.Millisecond}, [][]byte{answer[:5], answer[5:]}, true, 500 * time.Millisecond},
+		// silence after the first byte ends the response early
+		{"inter-character timeout", []time.Duration{0}, [][]byte{answer[:5]}, false, 500 * time.Millisecond},
+		{"no reply", nil, nil, false, 2 * time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			port := &testSerialPort{timeout: 5 * time.Millisecond}
+			port.line = scriptedLine(port, test.delays, test.chunks)
+			handler := newTestSerialHandler(port)
+			handler.Timeout = time.Second
+			handler.InterCharacterTimeout = 100 * time.Millisecond
+
+			start := time.Now()
+			response, err := handler.Send(testReadRequest)
+			elapsed := time.Since(start)
+			if test.ok && (err != nil || !bytes.Equal(response, answer)) {
+				t.Fatalf("response % x, error %v, want % x", response, err, answer)
+			}
+			if !test.ok && err == nil {
+				t.Fatalf("response % x, want an error", response)
+			}
+			if elapsed > test.elapsed {
+				t.Fatalf("response took %v, want at most %v", elapsed, test.elapsed)
+			}
+			// only silence before the first byte is a timeout
+			if isSilence(err) != (test.chunks == nil) {
+				t.Fatalf("error %v", err)
+			}
+			if test.chunks == nil && elapsed < handler.Timeout {
+				t.Fatalf("timed out after %v, want %v", elapsed, handler.Timeout)
+			}
+		})
+	}
+}
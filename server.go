@@ -0,0 +1,415 @@
+package dlt645
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/xgbt/dlt645-go/utils"
+)
+
+// ErrRegisterNotFound is returned by a RegisterStore for unknown data
+// identifiers, the Server answers with ExceptionCodeRequestWithoutData.
+var ErrRegisterNotFound = errors.New("dlt645: register not found")
+
+// RegisterStore keeps the register values a Server answers with. Values are
+// in transmission order, exactly as ReadData returns them.
+type RegisterStore interface {
+	Read(dataMarker uint32) (data []byte, err error)
+	Write(dataMarker uint32, data []byte) (err error)
+}
+
+// MemoryStore is a RegisterStore kept in memory.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	registers map[uint32][]byte
+}
+
+// NewMemoryStore allocates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{registers: make(map[uint32][]byte)}
+}
+
+// Read returns a copy of the register value.
+func (s *MemoryStore) Read(dataMarker uint32) (data []byte, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, ok := s.registers[dataMarker]
+	if !ok {
+		err = ErrRegisterNotFound
+		return
+	}
+	data = append([]byte(nil), value...)
+	return
+}
+
+// Write stores a copy of the register value.
+func (s *MemoryStore) Write(dataMarker uint32, data []byte) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.registers[dataMarker] = append([]byte(nil), data...)
+	return
+}
+
+// Server simulates a DL/T 645-2007 meter. It answers request frames read
+// from any io.ReadWriter, e.g. a pty, a TCP connection or a net.Pipe.
+type Server struct {
+	// Communication address of the simulated meter
+	Address uint64
+	// Register values served by read and write data
+	Store RegisterStore
+	// Passwords by permission level, nil accepts any password
+	Passwords map[uint8]uint32
+	// Number of 0xFE bytes sent in front of every response
+	Preamble int
+	// Transmission logger
+	Logger *log.Logger
+
+	// Hooks for the commands that have no register semantics
+	OnBroadcastTiming func(t time.Time)
+	OnFreeze          func(month, day, hour, minute uint8)
+	OnChangeRate      func(word uint8) (err error)
+	OnClear           func(functionCode byte, dataMarker uint32) (err error)
+	OnRelayControl    func(command RelayCommand, validUntil time.Time) (err error)
+	OnOutput          func(output TerminalOutput) (err error)
+	// OnSecurity answers a security authentication, a *SecurityError is
+	// sent as the security error word
+	OnSecurity func(dataMarker uint32, operatorCode uint32, data []byte) (answer []byte, err error)
+
+	mu sync.Mutex
+}
+
+// NewServer allocates a new Server answering as address from store.
+func NewServer(address uint64, store RegisterStore) *Server {
+	return &Server{Address: address, Store: store}
+}
+
+// serverSession keeps the follow-up state of one Serve call.
+type serverSession struct {
+	dataMarker uint32
+	remaining  []byte
+}
+
+// Serve answers requests read from rw until reading fails, io.EOF is
+// reported as a nil error.
+func (s *Server) Serve(rw io.ReadWriter) (err error) {
+	scanner := newFrameScanner(rw)
+	session := &serverSession{}
+	for {
+		var raw []byte
+		if raw, err = scanner.next(); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return
+		}
+		s.logf("dlt645: server received % x\n", raw)
+
+		response := s.handle(session, raw)
+		if response == nil {
+			continue
+		}
+		if s.Preamble > 0 {
+			response = append(bytes.Repeat([]byte{0xfe}, s.Preamble), response...)
+		}
+		s.logf("dlt645: server sending % x\n", response)
+		if _, err = rw.Write(response); err != nil {
+			return
+		}
+	}
+}
+
+// handle returns the response frame for a request, nil if the request is
+// not for this meter or requires no response.
+func (s *Server) handle(session *serverSession, raw []byte) (response []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	address := addressToDataDomain(s.Address)
+	requestAddress := raw[1:7]
+	broadcast := bytes.Equal(requestAddress, addressToDataDomain(BroadcastAddressDomain))
+	wildcard := bytes.Equal(requestAddress, bytes.Repeat([]byte{0xAA}, 6))
+	if !broadcast && !matchAddress(requestAddress, address) {
+		return
+	}
+	request, err := decodeFrame(raw)
+	if err != nil || raw[8]&0x80 != 0 {
+		return
+	}
+
+	var data []byte
+	var followUp bool
+	functionCode := request.FunctionCode
+	switch functionCode {
+	case FunctionCodeBroadcastTiming:
+		if len(request.Data) == 6 && s.OnBroadcastTiming != nil {
+			s.OnBroadcastTiming(bcdToTime(request.Data))
+		}
+		return
+	case FunctionCodeReadData:
+		data, followUp, err = s.readData(session, request.Data)
+	case FunctionCodeReadFollowUpData:
+		data, followUp, err = s.readFollowUpData(session, request.Data)
+	case FunctionCodeWriteData:
+		err = s.writeData(request.Data)
+	case FunctionCodeReadCommunicationAddress:
+		data = address
+	case FunctionCodeWriteCommunicationAddress:
+		if !wildcard {
+			return
+		}
+		if len(request.Data) != 6 {
+			err = &DltError{FunctionCode: functionCode, ExceptionCode: ExceptionCodeOtherError}
+			break
+		}
+		s.Address = dataDomainToAddress(request.Data)
+		address = addressToDataDomain(s.Address)
+	case FunctionCodeFreezeCommand:
+		if len(request.Data) != 4 {
+			err = &DltError{FunctionCode: functionCode, ExceptionCode: ExceptionCodeOtherError}
+			break
+		}
+		if s.OnFreeze != nil {
+			d := request.Data
+			s.OnFreeze(utils.BCDToUint8(d[3]), utils.BCDToUint8(d[2]), utils.BCDToUint8(d[1]), utils.BCDToUint8(d[0]))
+		}
+	case FunctionCodeChangeCommunicationRate:
+		data, err = s.changeCommunicationRate(request.Data)
+	case FunctionCodeChangePassword:
+		data, err = s.changePassword(request.Data)
+	case FunctionCodeClearMaximumDemand, FunctionCodeClearAmmeter, FunctionCodeClearEvent:
+		err = s.clear(functionCode, request.Data)
+	case FunctionCodeRelayControl:
+		err = s.relayControl(request.Data)
+	case FunctionCodeSecurityAuthentication:
+		data, err = s.securityAuthentication(request.Data)
+	case FunctionCodeMultiFunctionOutput:
+		if len(request.Data) != 1 || request.Data[0] > byte(TerminalOutputTariffSwitch) {
+			err = &DltError{FunctionCode: functionCode, ExceptionCode: ExceptionCodeOtherError}
+			break
+		}
+		if s.OnOutput != nil {
+			err = s.OnOutput(TerminalOutput(request.Data[0]))
+		}
+		data = request.Data
+	default:
+		err = &DltError{FunctionCode: functionCode, ExceptionCode: ExceptionCodeOtherError}
+	}
+	if broadcast {
+		// broadcast commands are never answered
+		return
+	}
+
+	controlCode := 0x80 | functionCode
+	if err != nil {
+		exceptionCode := byte(ExceptionCodeOtherError)
+		var dltError *DltError
+		if errors.As(err, &dltError) {
+			exceptionCode = dltError.ExceptionCode
+		} else if errors.Is(err, ErrRegisterNotFound) {
+			exceptionCode = ExceptionCodeRequestWithoutData
+		}
+		s.logf("dlt645: server answering function '%v' with exception: %v\n", functionCode, err)
+		controlCode |= 0x40
+		data = []byte{exceptionCode}
+		var securityError *SecurityError
+		if errors.As(err, &securityError) {
+			data = []byte{byte(securityError.Code), byte(securityError.Code >> 8)}
+		}
+	} else if followUp {
+		controlCode |= 0x20
+	}
+	response = encodeFrame(address, controlCode, data)
+	return
+}
+
+// readData answers DI0..DI3 [N [mm hh DD MM YY]], block reads return the
+// whole register value.
+func (s *Server) readData(session *serverSession, request []byte) (data []byte, followUp bool, err error) {
+	if len(request) < 4 {
+		err = &DltError{FunctionCode: FunctionCodeReadData, ExceptionCode: ExceptionCodeOtherError}
+		return
+	}
+	dataMarker := binary.LittleEndian.Uint32(request)
+	value, err := s.Store.Read(dataMarker)
+	if err != nil {
+		return
+	}
+	session.dataMarker = dataMarker
+	session.remaining = nil
+
+	max := ReadDataDomainMaxSize - 4
+	if len(value) > max {
+		session.remaining = value[max:]
+		value = value[:max]
+		followUp = true
+	}
+	data = append(request[:4:4], value...)
+	return
+}
+
+// readFollowUpData answers DI0..DI3 SEQ with the next part of the register
+// value followed by SEQ.
+func (s *Server) readFollowUpData(session *serverSession, request []byte) (data []byte, followUp bool, err error) {
+	if len(request) < 5 || binary.LittleEndian.Uint32(request) != session.dataMarker || session.remaining == nil {
+		err = &DltError{FunctionCode: FunctionCodeReadFollowUpData, ExceptionCode: ExceptionCodeRequestWithoutData}
+		return
+	}
+	seq := request[4]
+	value := session.remaining
+	max := ReadDataDomainMaxSize - 5
+	if len(value) > max {
+		value = value[:max]
+		followUp = true
+	}
+	session.remaining = session.remaining[len(value):]
+	if !followUp {
+		session.remaining = nil
+	}
+	data = append(append(request[:4:4], value...), seq)
+	return
+}
+
+// writeData handles DI0..DI3 PA P0 P1 P2 C0..C3 data.
+func (s *Server) writeData(request []byte) (err error) {
+	if len(request) < 12 {
+		err = &DltError{FunctionCode: FunctionCodeWriteData, ExceptionCode: ExceptionCodeOtherError}
+		return
+	}
+	if err = s.checkPassword(FunctionCodeWriteData, request[4:8]); err != nil {
+		return
+	}
+	err = s.Store.Write(binary.LittleEndian.Uint32(request), request[12:])
+	return
+}
+
+func (s *Server) changeCommunicationRate(request []byte) (data []byte, err error) {
+	if len(request) != 1 {
+		err = &DltError{FunctionCode: FunctionCodeChangeCommunicationRate, ExceptionCode: ExceptionCodeOtherError}
+		return
+	}
+	switch request[0] {
+	case CommunicationRate600, CommunicationRate1200, CommunicationRate2400, CommunicationRate4800, CommunicationRate9600, CommunicationRate19200:
+	default:
+		err = &DltError{FunctionCode: FunctionCodeChangeCommunicationRate, ExceptionCode: ExceptionCodeCommunicationRateCannotChanged}
+		return
+	}
+	if s.OnChangeRate != nil {
+		if err = s.OnChangeRate(request[0]); err != nil {
+			return
+		}
+	}
+	data = request
+	return
+}
+
+// changePassword handles DI0..DI3 PAO P0O P1O P2O PAN P0N P1N P2N and
+// answers with the new password.
+func (s *Server) changePassword(request []byte) (data []byte, err error) {
+	if len(request) != 12 {
+		err = &DltError{FunctionCode: FunctionCodeChangePassword, ExceptionCode: ExceptionCodeOtherError}
+		return
+	}
+	if err = s.checkPassword(FunctionCodeChangePassword, request[4:8]); err != nil {
+		return
+	}
+	if s.Passwords == nil {
+		s.Passwords = make(map[uint8]uint32)
+	}
+	s.Passwords[request[8]] = binary.LittleEndian.Uint32(request[8:]) >> 8
+	data = request[8:12]
+	return
+}
+
+// clear handles PA P0 P1 P2 C0..C3 [DI0..DI3].
+func (s *Server) clear(functionCode byte, request []byte) (err error) {
+	if len(request) < 8 || (functionCode == FunctionCodeClearEvent && len(request) < 12) {
+		err = &DltError{FunctionCode: functionCode, ExceptionCode: ExceptionCodeOtherError}
+		return
+	}
+	if err = s.checkPassword(functionCode, request[:4]); err != nil {
+		return
+	}
+	var dataMarker uint32
+	if functionCode == FunctionCodeClearEvent {
+		dataMarker = binary.LittleEndian.Uint32(request[8:])
+	}
+	if s.OnClear != nil {
+		err = s.OnClear(functionCode, dataMarker)
+	}
+	return
+}
+
+// relayControl handles PA P0 P1 P2 C0..C3 N1 N2 ss mm hh DD MM YY.
+func (s *Server) relayControl(request []byte) (err error) {
+	if len(request) != 16 {
+		err = &DltError{FunctionCode: FunctionCodeRelayControl, ExceptionCode: ExceptionCodeOtherError}
+		return
+	}
+	if err = s.checkPassword(FunctionCodeRelayControl, request[:4]); err != nil {
+		return
+	}
+	if s.OnRelayControl != nil {
+		err = s.OnRelayControl(RelayCommand(request[8]), bcdToTime(request[10:]))
+	}
+	return
+}
+
+// securityAuthentication handles DI0..DI3 C0..C3 data and answers with the
+// data identifier followed by the answer of OnSecurity.
+func (s *Server) securityAuthentication(request []byte) (data []byte, err error) {
+	if len(request) < 8 || s.OnSecurity == nil {
+		err = &SecurityError{Code: SecurityErrorOther}
+		return
+	}
+	answer, err := s.OnSecurity(binary.LittleEndian.Uint32(request), binary.LittleEndian.Uint32(request[4:]), request[8:])
+	if err != nil {
+		return
+	}
+	data = append(request[:4:4], answer...)
+	return
+}
+
+// checkPassword checks the PA P0 P1 P2 field.
+func (s *Server) checkPassword(functionCode byte, field []byte) (err error) {
+	if s.Passwords == nil {
+		return
+	}
+	password, ok := s.Passwords[field[0]]
+	if !ok || password != binary.LittleEndian.Uint32(field)>>8 {
+		err = &DltError{FunctionCode: functionCode, ExceptionCode: ExceptionCodeIllegalPassword}
+	}
+	return
+}
+
+func (s *Server) logf(format string, v ...interface{}) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, v...)
+	}
+}
+
+// matchAddress reports whether a request address selects address, 0xAA
+// request bytes match any value.
+func matchAddress(request, address []byte) bool {
+	for k, v := range request {
+		if v != 0xAA && v != address[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// bcdToTime converts ss mm hh DD MM YY to a local time.
+func bcdToTime(data []byte) time.Time {
+	v := make([]int, len(data))
+	for k, b := range data {
+		v[k] = int(utils.BCDToUint8(b))
+	}
+	return time.Date(2000+v[5], time.Month(v[4]), v[3], v[2], v[1], v[0], 0, time.Local)
+}
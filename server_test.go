@@ -0,0 +1,163 @@
+package dlt645
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// exceptionCode returns the exception code of a meter error answer.
+func exceptionCode(err error) byte {
+	var dltError *DltError
+	if errors.As(err, &dltError) {
+		return dltError.ExceptionCode
+	}
+	return 0
+}
+
+func TestServerReadWriteData(t *testing.T) {
+	server := NewServer(304257140001, NewMemoryStore())
+	server.Passwords = map[uint8]uint32{2: 0x123456}
+	handler := newSimulatedSerialHandler(t, server)
+	handler.SlaveAddr = 304257140001
+	client := NewClient(handler)
+
+	if _, err := client.ReadData(0x04000103, 0, 0, 0, 0, 0, 0); exceptionCode(err) != ExceptionCodeRequestWithoutData {
+		t.Fatalf("unknown register: error %v, want request without data", err)
+	}
+	if _, err := client.WriteData(0x04000103, 2, 0x654321, 0, []byte{0x15}); exceptionCode(err) != ExceptionCodeIllegalPassword {
+		t.Fatalf("wrong password: error %v, want illegal password", err)
+	}
+	if _, err := client.WriteData(0x04000103, 2, 0x123456, 0, []byte{0x15}); err != nil {
+		t.Fatal(err)
+	}
+	results, err := client.ReadData(0x04000103, 0, 0, 0, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(results, []byte{0x15}) {
+		t.Fatalf("results % x, want 15", results)
+	}
+
+	if _, err = client.ChangePassword(0x04000C04, 2, 0x123456, 4, 0x111111); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.WriteData(0x04000103, 4, 0x111111, 0, []byte{0x30}); err != nil {
+		t.Fatalf("write with the new password: %v", err)
+	}
+}
+
+func TestServerCommunicationAddress(t *testing.T) {
+	server := NewServer(304257140001, NewMemoryStore())
+	handler := newSimulatedSerialHandler(t, server)
+	wildcard := handler.Meter(WildcardAddressDomain)
+
+	results, err := wildcard.ReadCommunicationAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr := dataDomainToAddress(results); addr != 304257140001 {
+		t.Fatalf("address %d, want 304257140001", addr)
+	}
+
+	// only the wildcard address may change the address
+	if _, err = handler.Meter(304257140001).WriteCommunicationAddress(304257140002); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("addressed write: error %v, want ErrTimeout", err)
+	}
+	if _, err = wildcard.WriteCommunicationAddress(304257140002); err != nil {
+		t.Fatal(err)
+	}
+	if results, err = handler.Meter(304257140002).ReadCommunicationAddress(); err != nil {
+		t.Fatal(err)
+	}
+	if addr := dataDomainToAddress(results); addr != 304257140002 {
+		t.Fatalf("address %d, want 304257140002", addr)
+	}
+	if _, err = handler.Meter(304257140001).ReadCommunicationAddress(); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("old address: error %v, want ErrTimeout", err)
+	}
+}
+
+func TestServerCommands(t *testing.T) {
+	server := NewServer(304257140001, NewMemoryStore())
+	timings := make(chan time.Time, 1)
+	server.OnBroadcastTiming = func(t time.Time) { timings <- t }
+	var freeze [4]uint8
+	server.OnFreeze = func(month, day, hour, minute uint8) { freeze = [4]uint8{month, day, hour, minute} }
+	var rate uint8
+	server.OnChangeRate = func(word uint8) (err error) {
+		rate = word
+		return
+	}
+	type clear struct {
+		functionCode byte
+		dataMarker   uint32
+	}
+	var cleared []clear
+	server.OnClear = func(functionCode byte, dataMarker uint32) (err error) {
+		cleared = append(cleared, clear{functionCode, dataMarker})
+		return
+	}
+	var relay RelayCommand
+	var validUntil time.Time
+	server.OnRelayControl = func(command RelayCommand, until time.Time) (err error) {
+		relay, validUntil = command, until
+		return
+	}
+	var output TerminalOutput = 0xFF
+	server.OnOutput = func(o TerminalOutput) (err error) {
+		output = o
+		return
+	}
+	handler := newSimulatedSerialHandler(t, server)
+	client := NewClient(handler)
+
+	handler.SlaveAddr = BroadcastAddressDomain
+	if err := client.BroadcastTiming(24, 5, 6, 7, 8, 9); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case timing := <-timings:
+		if want := time.Date(2024, 5, 6, 7, 8, 9, 0, time.Local); !timing.Equal(want) {
+			t.Errorf("broadcast time %v, want %v", timing, want)
+		}
+	case <-time.After(time.Second):
+		t.Error("broadcast timing not received")
+	}
+
+	handler.SlaveAddr = 304257140001
+	if results, err := client.ReadCommunicationAddress(); err != nil || !bytes.Equal(results, addressToDataDomain(304257140001)) {
+		t.Errorf("address % x, error %v", results, err)
+	}
+	if _, err := client.FreezeCommand(99, 1, 0, 0); err != nil || freeze != [4]uint8{99, 1, 0, 0} {
+		t.Errorf("freeze %v, error %v", freeze, err)
+	}
+	if _, err := client.ChangeCommunicationRate(CommunicationRate9600); err != nil || rate != CommunicationRate9600 {
+		t.Errorf("rate %02x, error %v", rate, err)
+	}
+	if _, err := client.ChangeCommunicationRate(0x03); exceptionCode(err) != ExceptionCodeCommunicationRateCannotChanged {
+		t.Errorf("invalid rate: error %v", err)
+	}
+	if _, err := client.ClearMaximumDemand(2, 0, 0); err != nil {
+		t.Error(err)
+	}
+	if _, err := client.ClearAmmeter(2, 0, 0); err != nil {
+		t.Error(err)
+	}
+	if _, err := client.ClearEvent(0x03110000, 2, 0, 0); err != nil {
+		t.Error(err)
+	}
+	want := []clear{{FunctionCodeClearMaximumDemand, 0}, {FunctionCodeClearAmmeter, 0}, {FunctionCodeClearEvent, 0x03110000}}
+	if !reflect.DeepEqual(cleared, want) {
+		t.Errorf("cleared %x, want %x", cleared, want)
+	}
+	until := time.Date(2024, 5, 6, 7, 8, 9, 0, time.Local)
+	if _, err := client.(RelayClient).RelayControl(RelayTrip, until, 2, 0, 0); err != nil || relay != RelayTrip || !validUntil.Equal(until) {
+		t.Errorf("relay %02x until %v, error %v", byte(relay), validUntil, err)
+	}
+	if _, err := client.(RelayClient).MultiFunctionOutput(TerminalOutputDemandPeriod); err != nil || output != TerminalOutputDemandPeriod {
+		t.Errorf("output %v, error %v", output, err)
+	}
+}
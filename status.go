@@ -0,0 +1,185 @@
+package dlt645
+
+import "fmt"
+
+// running status words, 0x04000501..0x04000507, 0x040005FF is the block
+const statusWordMarker = 0x04000500
+
+// StatusWord1 is running status word 1.
+type StatusWord1 struct {
+	DemandBlockMode      bool // D1 需量积算方式 区间
+	ClockBatteryLow      bool // D2 时钟电池 欠压
+	ReadingBatteryLow    bool // D3 停电抄表电池 欠压
+	ActivePowerReverse   bool // D4 有功功率方向 反向
+	ReactivePowerReverse bool // D5 无功功率方向 反向
+	ControlCircuitError  bool // D8 控制回路错误
+	ESAMError            bool // D9 ESAM错误
+	ProgramError         bool // D12 内部程序错误
+	MemoryError          bool // D13 存储器故障或损坏
+	Overdrawn            bool // D14 透支状态
+	ClockError           bool // D15 时钟故障
+}
+
+// StatusWord2 is running status word 2, the power directions of the phases.
+type StatusWord2 struct {
+	ActivePowerReverse   [3]bool // D0..D2 A、B、C相有功功率方向 反向
+	ReactivePowerReverse [3]bool // D4..D6 A、B、C相无功功率方向 反向
+}
+
+// StatusWord3 is running status word 3, the operation status.
+type StatusWord3 struct {
+	SecondDayTableSet  bool // D0 当前运行时段 第二套
+	AuxiliarySupply    bool // D1 供电方式 辅助电源
+	BatterySupply      bool // D2 供电方式 电池供电
+	ProgrammingAllowed bool // D3 编程允许
+	RelayOpen          bool // D4 继电器状态 断
+	SecondTimeZoneSet  bool // D5 当前运行时区 第二套
+	RelayCommandOpen   bool // D6 继电器命令状态 断
+	PreTripAlarm       bool // D7 预跳闸报警状态
+	EnergyPrepaid      bool // D8 电能表类型 电量型预付费
+	MoneyPrepaid       bool // D9 电能表类型 电费型预付费
+	SecondRateSet      bool // D10 当前运行分时费率 第二套
+	SecondStepSet      bool // D11 当前阶梯 第二套
+	KeepPower          bool // D12 保电状态
+	Authenticated      bool // D13 身份认证状态
+	LocalAccount       bool // D14 本地开户状态
+	RemoteAccount      bool // D15 远程开户状态
+}
+
+// PhaseStatus is running status word 4, 5 or 6, the faults of phase A, B
+// or C.
+type PhaseStatus struct {
+	LossOfVoltage  bool // D0 失压
+	UnderVoltage   bool // D1 欠压
+	OverVoltage    bool // D2 过压
+	LossOfCurrent  bool // D3 失流
+	OverCurrent    bool // D4 过流
+	Overload       bool // D5 过载
+	PowerReverse   bool // D6 潮流反向
+	PhaseFailure   bool // D7 断相
+	CurrentFailure bool // D8 断流
+}
+
+// StatusWord7 is running status word 7, the faults of the meter.
+type StatusWord7 struct {
+	VoltageReverseSequence bool // D0 电压逆相序
+	CurrentReverseSequence bool // D1 电流逆相序
+	VoltageImbalance       bool // D2 电压不平衡
+	CurrentImbalance       bool // D3 电流不平衡
+	AuxiliarySupplyLoss    bool // D4 辅助电源失电
+	PowerDown              bool // D5 掉电
+	DemandExceeded         bool // D6 需量超限
+	PowerFactorLow         bool // D7 总功率因数超下限
+	CurrentSevereImbalance bool // D8 电流严重不平衡
+	MeterCoverOpen         bool // D9 开表盖
+	TerminalCoverOpen      bool // D10 开端钮盖
+}
+
+// Status holds the seven running status words, Phases are words 4..6.
+type Status struct {
+	Word1  StatusWord1
+	Word2  StatusWord2
+	Word3  StatusWord3
+	Phases [3]PhaseStatus
+	Word7  StatusWord7
+}
+
+// ReadStatus reads the running status words, as a block or one by one if
+// the meter does not answer the block.
+func (d *Device) ReadStatus() (status *Status, err error) {
+	var words [7]uint16
+	data, err := d.ReadRaw(statusWordMarker | 0xFF)
+	switch {
+	case err == nil && len(data) == 2*len(words):
+		for i := range words {
+			words[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+		}
+	case err == nil || isRequestWithoutData(err):
+		for i := range words {
+			if words[i], err = d.readStatusWord(uint32(i + 1)); err != nil {
+				return
+			}
+		}
+	default:
+		return
+	}
+	err = nil
+
+	status = &Status{
+		Word1: decodeStatusWord1(words[0]),
+		Word2: decodeStatusWord2(words[1]),
+		Word3: decodeStatusWord3(words[2]),
+		Word7: decodeStatusWord7(words[6]),
+	}
+	for i := range status.Phases {
+		status.Phases[i] = decodePhaseStatus(words[3+i])
+	}
+	return
+}
+
+// ReadStatusWord3 reads running status word 3.
+func (d *Device) ReadStatusWord3() (status StatusWord3, err error) {
+	word, err := d.readStatusWord(3)
+	if err != nil {
+		return
+	}
+	status = decodeStatusWord3(word)
+	return
+}
+
+// readStatusWord reads running status word n.
+func (d *Device) readStatusWord(n uint32) (word uint16, err error) {
+	data, err := d.ReadRaw(statusWordMarker | n)
+	if err != nil {
+		return
+	}
+	if len(data) != 2 {
+		err = fmt.Errorf("dlt645: status word %d length '%v' does not match expected '2'", n, len(data))
+		return
+	}
+	word = uint16(data[0]) | uint16(data[1])<<8
+	return
+}
+
+func decodeStatusWord1(word uint16) (s StatusWord1) {
+	decodeStatusBits(word, nil, &s.DemandBlockMode, &s.ClockBatteryLow, &s.ReadingBatteryLow,
+		&s.ActivePowerReverse, &s.ReactivePowerReverse, nil, nil, &s.ControlCircuitError, &s.ESAMError,
+		nil, nil, &s.ProgramError, &s.MemoryError, &s.Overdrawn, &s.ClockError)
+	return
+}
+
+func decodeStatusWord2(word uint16) (s StatusWord2) {
+	decodeStatusBits(word, &s.ActivePowerReverse[0], &s.ActivePowerReverse[1], &s.ActivePowerReverse[2], nil,
+		&s.ReactivePowerReverse[0], &s.ReactivePowerReverse[1], &s.ReactivePowerReverse[2])
+	return
+}
+
+func decodeStatusWord3(word uint16) (s StatusWord3) {
+	decodeStatusBits(word, &s.SecondDayTableSet, &s.AuxiliarySupply, &s.BatterySupply,
+		&s.ProgrammingAllowed, &s.RelayOpen, &s.SecondTimeZoneSet, &s.RelayCommandOpen,
+		&s.PreTripAlarm, &s.EnergyPrepaid, &s.MoneyPrepaid, &s.SecondRateSet,
+		&s.SecondStepSet, &s.KeepPower, &s.Authenticated, &s.LocalAccount, &s.RemoteAccount)
+	return
+}
+
+func decodePhaseStatus(word uint16) (s PhaseStatus) {
+	decodeStatusBits(word, &s.LossOfVoltage, &s.UnderVoltage, &s.OverVoltage, &s.LossOfCurrent,
+		&s.OverCurrent, &s.Overload, &s.PowerReverse, &s.PhaseFailure, &s.CurrentFailure)
+	return
+}
+
+func decodeStatusWord7(word uint16) (s StatusWord7) {
+	decodeStatusBits(word, &s.VoltageReverseSequence, &s.CurrentReverseSequence, &s.VoltageImbalance,
+		&s.CurrentImbalance, &s.AuxiliarySupplyLoss, &s.PowerDown, &s.DemandExceeded, &s.PowerFactorLow,
+		&s.CurrentSevereImbalance, &s.MeterCoverOpen, &s.TerminalCoverOpen)
+	return
+}
+
+// decodeStatusBits sets bits D0, D1, ... of word, nil skips a reserved bit.
+func decodeStatusBits(word uint16, bits ...*bool) {
+	for i, bit := range bits {
+		if bit != nil {
+			*bit = word&(1<<i) != 0
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package dlt645
+
+import "testing"
+
+func TestDecodeStatusWords(t *testing.T) {
+	if s := decodeStatusWord1(0x8014); s != (StatusWord1{ClockBatteryLow: true, ActivePowerReverse: true, ClockError: true}) {
+		t.Errorf("status word 1 %+v", s)
+	}
+	// D0, D6, D7, D10 and D11 are reserved
+	if s := decodeStatusWord1(0x0CC1); s != (StatusWord1{}) {
+		t.Errorf("reserved bits of status word 1 decoded: %+v", s)
+	}
+	if s := decodeStatusWord2(0x0024); s != (StatusWord2{ActivePowerReverse: [3]bool{false, false, true}, ReactivePowerReverse: [3]bool{false, true, false}}) {
+		t.Errorf("status word 2 %+v", s)
+	}
+	if s := decodeStatusWord3(0x1050); s != (StatusWord3{RelayOpen: true, RelayCommandOpen: true, KeepPower: true}) {
+		t.Errorf("status word 3 %+v", s)
+	}
+	if s := decodeStatusWord3(0xFFFF); !s.SecondDayTableSet || !s.RemoteAccount || !s.Authenticated {
+		t.Errorf("status word 3 %+v", s)
+	}
+	if s := decodePhaseStatus(0x0181); s != (PhaseStatus{LossOfVoltage: true, PhaseFailure: true, CurrentFailure: true}) {
+		t.Errorf("phase status %+v", s)
+	}
+	if s := decodeStatusWord7(0x0620); s != (StatusWord7{PowerDown: true, MeterCoverOpen: true, TerminalCoverOpen: true}) {
+		t.Errorf("status word 7 %+v", s)
+	}
+}
+
+func TestReadStatusSimulator(t *testing.T) {
+	words := []byte{0x04, 0x00, 0x00, 0x00, 0x50, 0x00, 0x01, 0x00, 0x00, 0x00, 0x08, 0x00, 0x00, 0x02}
+	check := func(t *testing.T, status *Status) {
+		t.Helper()
+		if !status.Word1.ClockBatteryLow || !status.Word3.RelayOpen || !status.Word3.RelayCommandOpen {
+			t.Errorf("status words 1 and 3 %+v %+v", status.Word1, status.Word3)
+		}
+		if status.Phases != [3]PhaseStatus{{LossOfVoltage: true}, {}, {LossOfCurrent: true}} {
+			t.Errorf("phases %+v", status.Phases)
+		}
+		if status.Word7 != (StatusWord7{MeterCoverOpen: true}) {
+			t.Errorf("status word 7 %+v", status.Word7)
+		}
+	}
+
+	store := NewMemoryStore()
+	store.Write(statusWordMarker|0xFF, words)
+	status, err := newSimulatedDevice(t, store).ReadStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, status)
+
+	// meters without the block are read word by word
+	store = NewMemoryStore()
+	for i := 0; i < 7; i++ {
+		store.Write(statusWordMarker|uint32(i+1), words[2*i:2*i+2])
+	}
+	device := newSimulatedDevice(t, store)
+	if status, err = device.ReadStatus(); err != nil {
+		t.Fatal(err)
+	}
+	check(t, status)
+	if word3, err := device.ReadStatusWord3(); err != nil || word3 != status.Word3 {
+		t.Errorf("status word 3 %+v, error %v", word3, err)
+	}
+
+	store.Write(statusWordMarker|3, []byte{0x50})
+	if _, err = device.ReadStatusWord3(); err == nil {
+		t.Error("status word of 1 byte read")
+	}
+}
@@ -0,0 +1,383 @@
+package dlt645
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xgbt/dlt645-go/utils"
+)
+
+// tariff parameters
+const (
+	tariffTimeZonesMarker      = 0x04000201 // 年时区数
+	tariffDayTablesMarker      = 0x04000202 // 日时段表数
+	tariffDayPeriodsMarker     = 0x04000203 // 日时段数
+	tariffTariffsMarker        = 0x04000204 // 费率数
+	tariffHolidaysMarker       = 0x04000205 // 公共假日数
+	tariffTimeZoneSwitchMarker = 0x04000106 // 两套时区表切换时间
+	tariffDayTableSwitchMarker = 0x04000107 // 两套日时段表切换时间
+	tariffWeekendMarker        = 0x04000801 // 周休日特征字
+	tariffWeekendTableMarker   = 0x04000802 // 周休日采用的日时段表号
+	tariffScheduleMarker       = 0x04010000 // 第一套时区表, DI2 2 is the second set
+	tariffHolidayMarker        = 0x04030000 // 第n公共假日
+
+	// limits of the standard
+	maxTimeZones  = 14
+	maxDayTables  = 8
+	maxDayPeriods = 14
+	maxTariffs    = 63
+	maxHolidays   = 254
+)
+
+// TariffLimits are the numbers of time zones, day tables, periods per day
+// table, tariffs and public holidays the meter is configured for.
+type TariffLimits struct {
+	TimeZones  int
+	DayTables  int
+	DayPeriods int
+	Tariffs    int
+	Holidays   int
+}
+
+// dayTables returns the number of day tables usable on the meter.
+func (limits TariffLimits) dayTables() int {
+	if limits.DayTables > maxDayTables {
+		return maxDayTables
+	}
+	return limits.DayTables
+}
+
+// TimeZone starts using DayTable on Month/Day of every year.
+type TimeZone struct {
+	Month    uint8
+	Day      uint8
+	DayTable uint8
+}
+
+// DayPeriod starts Tariff at Hour:Minute.
+type DayPeriod struct {
+	Hour   uint8
+	Minute uint8
+	Tariff uint8
+}
+
+// TariffSchedule is one of the two sets of time zone and day tables,
+// DayTables[0] is day table 1.
+type TariffSchedule struct {
+	TimeZones []TimeZone
+	DayTables [][]DayPeriod
+}
+
+// Holiday uses DayTable on Date.
+type Holiday struct {
+	Date     time.Time
+	DayTable uint8
+}
+
+// Weekend are the rest days of the week and the day table used on them.
+type Weekend struct {
+	// RestDays is indexed by time.Weekday
+	RestDays [7]bool
+	DayTable uint8
+}
+
+// ReadTariffLimits reads the numbers the tariff schedule is configured for.
+func (d *Device) ReadTariffLimits() (limits TariffLimits, err error) {
+	for _, limit := range []struct {
+		marker uint32
+		value  *int
+	}{
+		{tariffTimeZonesMarker, &limits.TimeZones},
+		{tariffDayTablesMarker, &limits.DayTables},
+		{tariffDayPeriodsMarker, &limits.DayPeriods},
+		{tariffTariffsMarker, &limits.Tariffs},
+		{tariffHolidaysMarker, &limits.Holidays},
+	} {
+		var data []byte
+		if data, err = d.ReadRaw(limit.marker); err != nil {
+			return
+		}
+		var n int64
+		if n, err = decodeBCD(data); err != nil {
+			return
+		}
+		*limit.value = int(n)
+	}
+	return
+}
+
+// Validate checks s against the limits of the meter and the standard. The
+// limits the meter has an exception for are reported as the *DltError it
+// would answer with, e.g. ExceptionCodeDayPeriodsExceedsThreshold.
+func (s *TariffSchedule) Validate(limits TariffLimits) (err error) {
+	exceeded := func(code byte) error {
+		return &DltError{FunctionCode: FunctionCodeWriteData, ExceptionCode: code}
+	}
+	if len(s.TimeZones) == 0 || len(s.TimeZones) > limits.TimeZones || len(s.TimeZones) > maxTimeZones {
+		return fmt.Errorf("dlt645: %d time zones: %w", len(s.TimeZones), exceeded(ExceptionCodeTimeZonesYearExceedsThreshold))
+	}
+	if len(s.DayTables) > limits.dayTables() {
+		return fmt.Errorf("dlt645: %d day tables exceed the limit '%v'", len(s.DayTables), limits.dayTables())
+	}
+	for i, zone := range s.TimeZones {
+		if zone.Month < 1 || zone.Month > 12 || zone.Day < 1 || zone.Day > 31 {
+			return fmt.Errorf("dlt645: time zone %d: invalid date %02d-%02d", i+1, zone.Month, zone.Day)
+		}
+		if zone.DayTable < 1 || int(zone.DayTable) > len(s.DayTables) {
+			return fmt.Errorf("dlt645: time zone %d: day table '%v' is not defined", i+1, zone.DayTable)
+		}
+	}
+	for i, periods := range s.DayTables {
+		if len(periods) == 0 || len(periods) > limits.DayPeriods || len(periods) > maxDayPeriods {
+			return fmt.Errorf("dlt645: day table %d: %d periods: %w", i+1, len(periods), exceeded(ExceptionCodeDayPeriodsExceedsThreshold))
+		}
+		for j, period := range periods {
+			if period.Hour > 23 || period.Minute > 59 {
+				return fmt.Errorf("dlt645: day table %d period %d: invalid time %02d:%02d", i+1, j+1, period.Hour, period.Minute)
+			}
+			if period.Tariff < 1 || int(period.Tariff) > limits.Tariffs || period.Tariff > maxTariffs {
+				return fmt.Errorf("dlt645: day table %d period %d: tariff %d: %w", i+1, j+1, period.Tariff, exceeded(ExceptionCodeRatesExceedsLimit))
+			}
+			if j > 0 && int(period.Hour)*60+int(period.Minute) <= int(periods[j-1].Hour)*60+int(periods[j-1].Minute) {
+				return fmt.Errorf("dlt645: day table %d period %d: periods must start in ascending order", i+1, j+1)
+			}
+		}
+	}
+	return
+}
+
+// ReadTariffSchedule reads tariff set 1 or 2, as many time zones and day
+// tables as the meter is configured for. Entries repeating the one before,
+// the padding WriteTariffSchedule writes, are dropped.
+func (d *Device) ReadTariffSchedule(set uint8) (schedule *TariffSchedule, err error) {
+	base, err := tariffSetMarker(set)
+	if err != nil {
+		return
+	}
+	limits, err := d.ReadTariffLimits()
+	if err != nil {
+		return
+	}
+
+	schedule = &TariffSchedule{}
+	data, err := d.ReadRaw(base)
+	if err != nil {
+		return
+	}
+	// NN DD MM per time zone
+	for i := 0; i+3 <= len(data) && i/3 < limits.TimeZones; i += 3 {
+		entry := data[i : i+3]
+		if _, err = decodeBCD(entry); err != nil {
+			return
+		}
+		zone := TimeZone{Month: utils.BCDToUint8(entry[2]), Day: utils.BCDToUint8(entry[1]), DayTable: utils.BCDToUint8(entry[0])}
+		if n := len(schedule.TimeZones); n == 0 || schedule.TimeZones[n-1] != zone {
+			schedule.TimeZones = append(schedule.TimeZones, zone)
+		}
+	}
+	for table := 1; table <= limits.DayTables && table <= maxDayTables; table++ {
+		if data, err = d.ReadRaw(base + uint32(table)); err != nil {
+			return
+		}
+		// NN mm hh per period
+		var periods []DayPeriod
+		for i := 0; i+3 <= len(data) && i/3 < limits.DayPeriods; i += 3 {
+			entry := data[i : i+3]
+			if _, err = decodeBCD(entry); err != nil {
+				return
+			}
+			period := DayPeriod{Hour: utils.BCDToUint8(entry[2]), Minute: utils.BCDToUint8(entry[1]), Tariff: utils.BCDToUint8(entry[0])}
+			if n := len(periods); n == 0 || periods[n-1] != period {
+				periods = append(periods, period)
+			}
+		}
+		schedule.DayTables = append(schedule.DayTables, periods)
+	}
+	return
+}
+
+// WriteTariffSchedule validates schedule against the limits of the meter
+// and writes it to tariff set 1 or 2. Tables shorter than the configured
+// number of entries are padded with their last entry, as meters expect.
+func (d *Device) WriteTariffSchedule(set uint8, schedule *TariffSchedule, passwordPermission uint8, password uint32, operatorCode uint32) (err error) {
+	base, err := tariffSetMarker(set)
+	if err != nil {
+		return
+	}
+	limits, err := d.ReadTariffLimits()
+	if err != nil {
+		return
+	}
+	if err = schedule.Validate(limits); err != nil {
+		return
+	}
+
+	var data []byte
+	for i := 0; i < limits.TimeZones; i++ {
+		zone := schedule.TimeZones[len(schedule.TimeZones)-1]
+		if i < len(schedule.TimeZones) {
+			zone = schedule.TimeZones[i]
+		}
+		data = append(data, bcdArrayToDataDomain(zone.DayTable, zone.Day, zone.Month)...)
+	}
+	if _, err = contextClient(d.Client).WriteDataContext(d.Context(), base, passwordPermission, password, operatorCode, data); err != nil {
+		return
+	}
+	for i, periods := range schedule.DayTables {
+		data = nil
+		for j := 0; j < limits.DayPeriods; j++ {
+			period := periods[len(periods)-1]
+			if j < len(periods) {
+				period = periods[j]
+			}
+			data = append(data, bcdArrayToDataDomain(period.Tariff, period.Minute, period.Hour)...)
+		}
+		if _, err = contextClient(d.Client).WriteDataContext(d.Context(), base+uint32(i+1), passwordPermission, password, operatorCode, data); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// ReadTariffSwitchTimes reads when the meter switches to the other set of
+// time zones and day tables.
+func (d *Device) ReadTariffSwitchTimes() (timeZones, dayTables time.Time, err error) {
+	if timeZones, err = d.readTime(tariffTimeZoneSwitchMarker); err != nil {
+		return
+	}
+	dayTables, err = d.readTime(tariffDayTableSwitchMarker)
+	return
+}
+
+// WriteTariffSwitchTimes sets when the meter switches to the other set of
+// time zones and day tables.
+func (d *Device) WriteTariffSwitchTimes(timeZones, dayTables time.Time, passwordPermission uint8, password uint32, operatorCode uint32) (err error) {
+	for _, write := range []struct {
+		marker uint32
+		t      time.Time
+	}{
+		{tariffTimeZoneSwitchMarker, timeZones.Local()},
+		{tariffDayTableSwitchMarker, dayTables.Local()},
+	} {
+		t := write.t
+		data := bcdArrayToDataDomain(uint8(t.Minute()), uint8(t.Hour()), uint8(t.Day()), uint8(t.Month()), uint8(t.Year()%100))
+		if _, err = contextClient(d.Client).WriteDataContext(d.Context(), write.marker, passwordPermission, password, operatorCode, data); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// ReadHolidays reads the public holidays the meter is configured for.
+func (d *Device) ReadHolidays() (holidays []Holiday, err error) {
+	limits, err := d.ReadTariffLimits()
+	if err != nil {
+		return
+	}
+	for n := 1; n <= limits.Holidays && n <= maxHolidays; n++ {
+		var data []byte
+		if data, err = d.ReadRaw(tariffHolidayMarker + uint32(n)); err != nil {
+			return
+		}
+		if len(data) != 4 {
+			err = fmt.Errorf("dlt645: holiday data length '%v' does not match expected '4'", len(data))
+			return
+		}
+		holiday := Holiday{}
+		// NN DD MM YY
+		if holiday.Date, err = decodeBCDTime("YYMMDD", data[1:]); err != nil {
+			return
+		}
+		var dayTable int64
+		if dayTable, err = decodeBCD(data[:1]); err != nil {
+			return
+		}
+		holiday.DayTable = uint8(dayTable)
+		holidays = append(holidays, holiday)
+	}
+	return
+}
+
+// WriteHoliday sets public holiday n, 1..254, to the local date of
+// holiday.Date.
+func (d *Device) WriteHoliday(n int, holiday Holiday, passwordPermission uint8, password uint32, operatorCode uint32) (err error) {
+	if n < 1 || n > maxHolidays {
+		err = fmt.Errorf("dlt645: holiday '%v' must be between '1' and '%v'", n, maxHolidays)
+		return
+	}
+	limits, err := d.ReadTariffLimits()
+	if err != nil {
+		return
+	}
+	if holiday.DayTable < 1 || int(holiday.DayTable) > limits.dayTables() {
+		err = fmt.Errorf("dlt645: day table '%v' must be between '1' and '%v'", holiday.DayTable, limits.dayTables())
+		return
+	}
+	t := holiday.Date.Local()
+	data := bcdArrayToDataDomain(holiday.DayTable, uint8(t.Day()), uint8(t.Month()), uint8(t.Year()%100))
+	_, err = contextClient(d.Client).WriteDataContext(d.Context(), tariffHolidayMarker+uint32(n), passwordPermission, password, operatorCode, data)
+	return
+}
+
+// ReadWeekend reads the weekend status word and the day table of rest days.
+func (d *Device) ReadWeekend() (weekend Weekend, err error) {
+	data, err := d.ReadRaw(tariffWeekendMarker)
+	if err != nil {
+		return
+	}
+	if len(data) != 1 {
+		err = fmt.Errorf("dlt645: weekend status word length '%v' does not match expected '1'", len(data))
+		return
+	}
+	// D0..D6 Sunday..Saturday, 0 rest day, 1 working day
+	for day := range weekend.RestDays {
+		weekend.RestDays[day] = data[0]&(1<<day) == 0
+	}
+	if data, err = d.ReadRaw(tariffWeekendTableMarker); err != nil {
+		return
+	}
+	dayTable, err := decodeBCD(data)
+	if err != nil || len(data) != 1 {
+		err = fmt.Errorf("dlt645: invalid weekend day table % x", data)
+		return
+	}
+	weekend.DayTable = uint8(dayTable)
+	return
+}
+
+// WriteWeekend sets the weekend status word and the day table of rest days.
+func (d *Device) WriteWeekend(weekend Weekend, passwordPermission uint8, password uint32, operatorCode uint32) (err error) {
+	if weekend.DayTable < 1 || weekend.DayTable > maxDayTables {
+		err = fmt.Errorf("dlt645: day table '%v' must be between '1' and '%v'", weekend.DayTable, maxDayTables)
+		return
+	}
+	var word byte
+	for day, rest := range weekend.RestDays {
+		if !rest {
+			word |= 1 << day
+		}
+	}
+	if _, err = contextClient(d.Client).WriteDataContext(d.Context(), tariffWeekendMarker, passwordPermission, password, operatorCode, []byte{word}); err != nil {
+		return
+	}
+	_, err = contextClient(d.Client).WriteDataContext(d.Context(), tariffWeekendTableMarker, passwordPermission, password, operatorCode, bcdArrayToDataDomain(weekend.DayTable))
+	return
+}
+
+// readTime reads a YYMMDDhhmm parameter.
+func (d *Device) readTime(marker uint32) (t time.Time, err error) {
+	data, err := d.ReadRaw(marker)
+	if err != nil {
+		return
+	}
+	return decodeBCDTime("YYMMDDhhmm", data)
+}
+
+func tariffSetMarker(set uint8) (marker uint32, err error) {
+	if set != 1 && set != 2 {
+		err = fmt.Errorf("dlt645: tariff set '%v' must be 1 or 2", set)
+		return
+	}
+	marker = tariffScheduleMarker + uint32(set-1)<<16
+	return
+}
@@ -0,0 +1,179 @@
+package dlt645
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTariffStore returns a store of a meter configured for 4 time zones, 2
+// day tables of 6 periods, 4 tariffs and 2 holidays.
+func newTariffStore() *MemoryStore {
+	store := NewMemoryStore()
+	store.Write(tariffTimeZonesMarker, blockData("04"))
+	store.Write(tariffDayTablesMarker, blockData("02"))
+	store.Write(tariffDayPeriodsMarker, blockData("06"))
+	store.Write(tariffTariffsMarker, blockData("04"))
+	store.Write(tariffHolidaysMarker, blockData("0002"))
+	return store
+}
+
+func TestTariffScheduleSimulator(t *testing.T) {
+	store := newTariffStore()
+	device := newSimulatedDevice(t, store)
+
+	limits, err := device.ReadTariffLimits()
+	if err != nil || limits != (TariffLimits{TimeZones: 4, DayTables: 2, DayPeriods: 6, Tariffs: 4, Holidays: 2}) {
+		t.Fatalf("limits %+v, error %v", limits, err)
+	}
+
+	schedule := &TariffSchedule{
+		TimeZones: []TimeZone{{Month: 1, Day: 1, DayTable: 1}, {Month: 6, Day: 1, DayTable: 2}},
+		DayTables: [][]DayPeriod{
+			{{Hour: 0, Minute: 0, Tariff: 4}, {Hour: 8, Minute: 0, Tariff: 2}, {Hour: 22, Minute: 30, Tariff: 3}},
+			{{Hour: 0, Minute: 0, Tariff: 4}},
+		},
+	}
+	if err = device.WriteTariffSchedule(2, schedule, 2, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	// NN DD MM per time zone, padded with the last one
+	data, _ := store.Read(0x04020000)
+	if want := []byte{0x01, 0x01, 0x01, 0x02, 0x01, 0x06, 0x02, 0x01, 0x06, 0x02, 0x01, 0x06}; !bytes.Equal(data, want) {
+		t.Errorf("time zones % x, want % x", data, want)
+	}
+	// NN mm hh per period
+	data, _ = store.Read(0x04020001)
+	if want := []byte{0x04, 0x00, 0x00, 0x02, 0x00, 0x08, 0x03, 0x30, 0x22, 0x03, 0x30, 0x22, 0x03, 0x30, 0x22, 0x03, 0x30, 0x22}; !bytes.Equal(data, want) {
+		t.Errorf("day table 1 % x, want % x", data, want)
+	}
+
+	read, err := device.ReadTariffSchedule(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, schedule) {
+		t.Errorf("schedule read %+v, want %+v", read, schedule)
+	}
+	if _, err = device.ReadTariffSchedule(1); !isRequestWithoutData(err) {
+		t.Errorf("unwritten set: error %v", err)
+	}
+	if _, err = device.ReadTariffSchedule(3); err == nil {
+		t.Error("tariff set 3 read")
+	}
+
+	schedule.DayTables[0] = append(schedule.DayTables[0], DayPeriod{Hour: 23, Minute: 0, Tariff: 5})
+	if err = device.WriteTariffSchedule(1, schedule, 2, 0, 0); !errors.Is(err, &DltError{ExceptionCode: ExceptionCodeRatesExceedsLimit}) {
+		t.Errorf("tariff 5 of 4: error %v", err)
+	}
+	if data, _ = store.Read(0x04010000); data != nil {
+		t.Errorf("invalid schedule written: % x", data)
+	}
+}
+
+func TestTariffScheduleValidate(t *testing.T) {
+	limits := TariffLimits{TimeZones: 2, DayTables: 2, DayPeriods: 3, Tariffs: 4}
+	table := []DayPeriod{{Hour: 0, Tariff: 1}, {Hour: 8, Tariff: 2}}
+	tests := []struct {
+		name     string
+		schedule TariffSchedule
+		want     byte
+	}{
+		{"valid", TariffSchedule{TimeZones: []TimeZone{{1, 1, 1}}, DayTables: [][]DayPeriod{table}}, 0},
+		{"no time zone", TariffSchedule{DayTables: [][]DayPeriod{table}}, ExceptionCodeTimeZonesYearExceedsThreshold},
+		{"time zones", TariffSchedule{TimeZones: []TimeZone{{1, 1, 1}, {4, 1, 1}, {7, 1, 1}}, DayTables: [][]DayPeriod{table}}, ExceptionCodeTimeZonesYearExceedsThreshold},
+		{"periods", TariffSchedule{TimeZones: []TimeZone{{1, 1, 1}}, DayTables: [][]DayPeriod{append(table, DayPeriod{12, 0, 3}, DayPeriod{18, 0, 4})}}, ExceptionCodeDayPeriodsExceedsThreshold},
+		{"tariff", TariffSchedule{TimeZones: []TimeZone{{1, 1, 1}}, DayTables: [][]DayPeriod{{{0, 0, 0}}}}, ExceptionCodeRatesExceedsLimit},
+	}
+	for _, test := range tests {
+		err := test.schedule.Validate(limits)
+		if test.want == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", test.name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, &DltError{ExceptionCode: test.want}) {
+			t.Errorf("%s: error %v, want exception '%02x'", test.name, err, test.want)
+		}
+	}
+
+	for name, schedule := range map[string]TariffSchedule{
+		"date":            {TimeZones: []TimeZone{{13, 1, 1}}, DayTables: [][]DayPeriod{table}},
+		"day table":       {TimeZones: []TimeZone{{1, 1, 2}}, DayTables: [][]DayPeriod{table}},
+		"time":            {TimeZones: []TimeZone{{1, 1, 1}}, DayTables: [][]DayPeriod{{{24, 0, 1}}}},
+		"ascending order": {TimeZones: []TimeZone{{1, 1, 1}}, DayTables: [][]DayPeriod{{{8, 0, 1}, {8, 0, 2}}}},
+		// no exception code stands for too many day tables
+		"day tables": {TimeZones: []TimeZone{{1, 1, 1}}, DayTables: [][]DayPeriod{table, table, table}},
+	} {
+		err := schedule.Validate(limits)
+		if err == nil {
+			t.Errorf("%s: invalid schedule validated", name)
+		}
+		var dltError *DltError
+		if errors.As(err, &dltError) {
+			t.Errorf("%s: error %v reported as a meter exception", name, err)
+		}
+	}
+}
+
+func TestTariffCalendarSimulator(t *testing.T) {
+	store := newTariffStore()
+	device := newSimulatedDevice(t, store)
+
+	timeZones := time.Date(2024, 6, 1, 0, 0, 0, 0, time.Local)
+	dayTables := time.Date(2024, 7, 1, 0, 30, 0, 0, time.Local)
+	if err := device.WriteTariffSwitchTimes(timeZones, dayTables, 2, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if z, d, err := device.ReadTariffSwitchTimes(); err != nil || !z.Equal(timeZones) || !d.Equal(dayTables) {
+		t.Errorf("switch times %v and %v, error %v", z, d, err)
+	}
+
+	holidays := []Holiday{
+		{Date: time.Date(2024, 10, 1, 0, 0, 0, 0, time.Local), DayTable: 2},
+		{Date: time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local), DayTable: 1},
+	}
+	for i, holiday := range holidays {
+		if err := device.WriteHoliday(i+1, holiday, 2, 0, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if read, err := device.ReadHolidays(); err != nil || !reflect.DeepEqual(read, holidays) {
+		t.Errorf("holidays %+v, error %v", read, err)
+	}
+	if err := device.WriteHoliday(255, holidays[0], 2, 0, 0); err == nil {
+		t.Error("holiday 255 written")
+	}
+	if err := device.WriteHoliday(1, Holiday{Date: holidays[0].Date, DayTable: 3}, 2, 0, 0); err == nil {
+		t.Error("holiday with day table 3 of 2 written")
+	}
+	// the meter keeps the local date
+	date := time.Date(2024, 12, 31, 23, 0, 0, 0, time.FixedZone("UTC-14", -14*60*60))
+	if err := device.WriteHoliday(2, Holiday{Date: date, DayTable: 1}, 2, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	local := date.Local()
+	if read, err := device.ReadHolidays(); err != nil || !read[1].Date.Equal(time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local)) {
+		t.Errorf("holidays %+v, want %v, error %v", read, local, err)
+	}
+
+	weekend := Weekend{DayTable: 2}
+	weekend.RestDays[time.Saturday] = true
+	weekend.RestDays[time.Sunday] = true
+	if err := device.WriteWeekend(weekend, 2, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	// D0..D6 Sunday..Saturday, 1 is a working day
+	if data, _ := store.Read(tariffWeekendMarker); !bytes.Equal(data, []byte{0x3E}) {
+		t.Errorf("weekend status word % x, want 3e", data)
+	}
+	if read, err := device.ReadWeekend(); err != nil || read != weekend {
+		t.Errorf("weekend %+v, error %v", read, err)
+	}
+	if err := device.WriteWeekend(Weekend{}, 2, 0, 0); err == nil {
+		t.Error("weekend without day table written")
+	}
+}
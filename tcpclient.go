@@ -0,0 +1,281 @@
+package dlt645
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	tcpTimeout     = 10 * time.Second
+	tcpIdleTimeout = 60 * time.Second
+	// wait for more stale bytes when flushing
+	tcpFlushTimeout = 5 * time.Millisecond
+)
+
+// ClientTCPHandler implements Packager and Transporter interface for meters
+// reached through a serial-to-Ethernet converter or a DTU listening on TCP.
+type ClientTCPHandler struct {
+	rtuPackager
+	tcpTransporter
+}
+
+// NewClientTCPHandler allocates a new ClientTCPHandler, address is "host:port".
+func NewClientTCPHandler(address string) *ClientTCPHandler {
+	handler := &ClientTCPHandler{}
+	handler.Address = address
+	handler.Timeout = tcpTimeout
+	handler.IdleTimeout = tcpIdleTimeout
+	return handler
+}
+
+// ClientTCP creates TCP client with default handler and given connect string.
+func ClientTCP(address string) Client {
+	handler := NewClientTCPHandler(address)
+	return NewClient(handler)
+}
+
+// Meter returns a Client bound to the meter at addr behind the converter,
+// sharing the connection with every other meter on the bus.
+func (handler *ClientTCPHandler) Meter(addr uint64) Client {
+	return NewMeterClient(handler, addr)
+}
+
+// tcpTransporter implements Transporter interface.
+type tcpTransporter struct {
+	// Connect string
+	Address string
+	// Connect & Read timeout
+	Timeout time.Duration
+	// Idle timeout to close the connection
+	IdleTimeout time.Duration
+	// Transmission logger
+	Logger *log.Logger
+
+	// TCP connection
+	mu           sync.Mutex
+	conn         net.Conn
+	closeTimer   *time.Timer
+	lastActivity time.Time
+	// the receive buffer may hold stale bytes, see flush
+	dirty bool
+}
+
+// Send sends data to the converter and waits for the meter response.
+// A broken connection is re-established once before giving up, also when
+// the converter closed it while it was idle.
+func (dlt *tcpTransporter) Send(request []byte) (response []byte, err error) {
+	return dlt.SendContext(context.Background(), request)
+}
+
+// SendContext is like Send but aborts when ctx is done, the deadline of ctx
+// applies if it is earlier than Timeout.
+func (dlt *tcpTransporter) SendContext(ctx context.Context, request []byte) (response []byte, err error) {
+	dlt.mu.Lock()
+	defer dlt.mu.Unlock()
+
+	for retried := false; ; retried = true {
+		reused := dlt.conn != nil
+		if err = dlt.write(ctx, request); err != nil {
+			return
+		}
+		conn := dlt.conn
+		stop := afterFunc(ctx, func() { conn.SetReadDeadline(time.Unix(1, 0)) })
+		response, err = readFrame(conn)
+		stop()
+		if err == nil {
+			break
+		}
+		if contextErr(ctx) != nil || isTimeout(err) || isGarbled(err) {
+			// a late answer may follow, flush discards it before the next
+			// request
+			dlt.dirty = true
+			if contextErr(ctx) != nil {
+				err = contextErr(ctx)
+			}
+			return
+		}
+		// the converter dropped us, an idle connection it closed before the
+		// request arrived is worth one more try
+		dlt.close()
+		if !reused || retried {
+			return
+		}
+		dlt.logf("dlt645: reconnecting to %s: %v\n", dlt.Address, err)
+	}
+
+	dlt.logf("dlt645: received % x\n", response)
+	return
+}
+
+// SendNotResponse sends data to the converter without waiting for a response.
+func (dlt *tcpTransporter) SendNotResponse(request []byte) (err error) {
+	return dlt.SendNotResponseContext(context.Background(), request)
+}
+
+// SendNotResponseContext is like SendNotResponse but does not write once
+// ctx is done.
+func (dlt *tcpTransporter) SendNotResponseContext(ctx context.Context, request []byte) (err error) {
+	dlt.mu.Lock()
+	defer dlt.mu.Unlock()
+
+	if err = dlt.write(ctx, request); err == nil {
+		// an answer nobody waits for may follow
+		dlt.dirty = true
+	}
+	return
+}
+
+// write makes sure the connection is established, discards stale data left
+// by a previous failed exchange and writes the request with the preamble.
+func (dlt *tcpTransporter) write(ctx context.Context, request []byte) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if err = dlt.connect(); err != nil {
+		return
+	}
+	dlt.lastActivity = time.Now()
+	dlt.startCloseTimer()
+
+	raw := append([]byte{0xfe, 0xfe, 0xfe, 0xfe}, request...)
+
+	for retried := false; ; retried = true {
+		if dlt.dirty && !dlt.flush() {
+			// peer closed the connection while we were idle
+			dlt.close()
+			if err = dlt.connect(); err != nil {
+				return
+			}
+		}
+		if err = dlt.setDeadline(ctx); err != nil {
+			return
+		}
+		dlt.logf("dlt645: sending % x\n", raw)
+		if _, err = dlt.conn.Write(raw); err == nil || retried {
+			break
+		}
+		// broken connection, reconnect once and resend
+		dlt.logf("dlt645: reconnecting to %s: %v\n", dlt.Address, err)
+		dlt.close()
+		if err = dlt.connect(); err != nil {
+			return
+		}
+	}
+	if err != nil {
+		dlt.close()
+	}
+	return
+}
+
+// Connect establishes a new connection to the address in Address.
+// Connect and Close are exported so that multiple requests can be done with one session
+func (dlt *tcpTransporter) Connect() error {
+	dlt.mu.Lock()
+	defer dlt.mu.Unlock()
+
+	return dlt.connect()
+}
+
+func (dlt *tcpTransporter) connect() error {
+	if dlt.conn == nil {
+		dialer := net.Dialer{Timeout: dlt.Timeout}
+		conn, err := dialer.Dial("tcp", dlt.Address)
+		if err != nil {
+			return err
+		}
+		dlt.conn = conn
+	}
+	return nil
+}
+
+// Close closes current connection.
+func (dlt *tcpTransporter) Close() error {
+	dlt.mu.Lock()
+	defer dlt.mu.Unlock()
+
+	return dlt.close()
+}
+
+func (dlt *tcpTransporter) close() (err error) {
+	if dlt.conn != nil {
+		err = dlt.conn.Close()
+		dlt.conn = nil
+		dlt.dirty = false
+	}
+	return
+}
+
+func (dlt *tcpTransporter) setDeadline(ctx context.Context) error {
+	var deadline time.Time
+	if dlt.Timeout > 0 {
+		deadline = time.Now().Add(dlt.Timeout)
+	}
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+	return dlt.conn.SetDeadline(deadline)
+}
+
+// flush discards whatever a late answer left in the receive buffer and
+// reports whether the connection is still usable. It reads until nothing
+// arrives for tcpFlushTimeout, a deadline already passed would fail the read
+// without looking at the buffer. Every flush waits that long, so it is only
+// done when the buffer may hold stale bytes: after an exchange that failed
+// and after a request sent without waiting for the response.
+func (dlt *tcpTransporter) flush() bool {
+	var b [rtuMaxSize]byte
+	for {
+		if err := dlt.conn.SetReadDeadline(time.Now().Add(tcpFlushTimeout)); err != nil {
+			return false
+		}
+		n, err := dlt.conn.Read(b[:])
+		if n > 0 {
+			dlt.logf("dlt645: discarding % x\n", b[:n])
+		}
+		if err != nil {
+			dlt.dirty = false
+			return isTimeout(err)
+		}
+	}
+}
+
+func (dlt *tcpTransporter) logf(format string, v ...interface{}) {
+	if dlt.Logger != nil {
+		dlt.Logger.Printf(format, v...)
+	}
+}
+
+func (dlt *tcpTransporter) startCloseTimer() {
+	if dlt.IdleTimeout <= 0 {
+		return
+	}
+	if dlt.closeTimer == nil {
+		dlt.closeTimer = time.AfterFunc(dlt.IdleTimeout, dlt.closeIdle)
+	} else {
+		dlt.closeTimer.Reset(dlt.IdleTimeout)
+	}
+}
+
+// closeIdle closes the connection if last activity is passed behind IdleTimeout.
+func (dlt *tcpTransporter) closeIdle() {
+	dlt.mu.Lock()
+	defer dlt.mu.Unlock()
+
+	if dlt.IdleTimeout <= 0 {
+		return
+	}
+	idle := time.Since(dlt.lastActivity)
+	if idle >= dlt.IdleTimeout {
+		dlt.logf("dlt645: closing connection due to idle timeout: %v", idle)
+		dlt.close()
+	}
+}
+
+func isTimeout(err error) bool {
+	var netError net.Error
+	return errors.As(err, &netError) && netError.Timeout()
+}
@@ -0,0 +1,233 @@
+package dlt645
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// listenTCP serves every accepted connection with serve until the test ends.
+func listenTCP(t *testing.T, serve func(conn net.Conn)) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+var (
+	// meter 304257140001 reading 00000000, and its answer 222222.00 kWh
+	testReadRequest = []byte{0x68, 0x01, 0x00, 0x14, 0x57, 0x42, 0x30, 0x68, 0x11, 0x04, 0x33, 0x33, 0x33, 0x33, 0x8f, 0x16}
+	testReadAnswer  = []byte{0x68, 0x01, 0x00, 0x14, 0x57, 0x42, 0x30, 0x68, 0x91, 0x08, 0x33, 0x33, 0x33, 0x33, 0x55, 0x55, 0x55, 0x33, 0x45, 0x16}
+)
+
+func TestTCPTransporterPreamble(t *testing.T) {
+	requests := make(chan []byte, 1)
+	handler := NewClientTCPHandler(listenTCP(t, func(conn net.Conn) {
+		var b [4]byte
+		if _, err := io.ReadFull(conn, b[:]); err != nil {
+			return
+		}
+		request, err := newFrameScanner(conn).next()
+		if err != nil {
+			return
+		}
+		requests <- append(b[:], request...)
+		// the converter puts its own preamble in front of the answer
+		conn.Write(append([]byte{0xfe, 0xfe}, testReadAnswer...))
+	}))
+	handler.Timeout = time.Second
+	defer handler.Close()
+
+	response, err := handler.Send(testReadRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(response, testReadAnswer) {
+		t.Fatalf("response % x, want % x", response, testReadAnswer)
+	}
+	if request := <-requests; !bytes.Equal(request, append([]byte{0xfe, 0xfe, 0xfe, 0xfe}, testReadRequest...)) {
+		t.Fatalf("request % x", request)
+	}
+}
+
+func TestTCPTransporterTimeout(t *testing.T) {
+	handler := NewClientTCPHandler(listenTCP(t, func(conn net.Conn) {
+		var b [64]byte
+		for {
+			if _, err := conn.Read(b[:]); err != nil {
+				return
+			}
+		}
+	}))
+	handler.Timeout = 50 * time.Millisecond
+	defer handler.Close()
+
+	if _, err := handler.Send(testReadRequest); !isTimeout(err) {
+		t.Fatalf("error %v, want a timeout", err)
+	}
+	if handler.conn == nil {
+		t.Fatal("connection closed on a timeout")
+	}
+}
+
+func TestTCPTransporterSendContext(t *testing.T) {
+	handler := NewClientTCPHandler(listenTCP(t, func(conn net.Conn) {
+		var b [64]byte
+		for {
+			if _, err := conn.Read(b[:]); err != nil {
+				return
+			}
+		}
+	}))
+	defer handler.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := handler.SendContext(ctx, testReadRequest); err != context.Canceled {
+		t.Fatalf("error %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("cancelled after %v", elapsed)
+	}
+
+	// the deadline of the context applies before Timeout
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := handler.SendContext(ctx, testReadRequest); err != context.DeadlineExceeded {
+		t.Fatalf("error %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestTCPTransporterFlushesLateAnswer(t *testing.T) {
+	addr := addressToDataDomain(304257140001)
+	late := encodeFrame(addr, 0x91, []byte{0x00, 0x00, 0x00, 0x00, 0x11, 0x11, 0x11, 0x00})
+	answer := encodeFrame(addr, 0x91, []byte{0x00, 0x00, 0x01, 0x00, 0x22, 0x22, 0x22, 0x00})
+	sent := make(chan struct{})
+
+	handler := NewClientTCPHandler(listenTCP(t, func(conn net.Conn) {
+		scanner := newFrameScanner(conn)
+		if _, err := scanner.next(); err != nil {
+			return
+		}
+		// answer the first request after the client gave up
+		time.Sleep(150 * time.Millisecond)
+		conn.Write(late)
+		close(sent)
+		if _, err := scanner.next(); err != nil {
+			return
+		}
+		conn.Write(answer)
+	}))
+	handler.Timeout = 100 * time.Millisecond
+	defer handler.Close()
+
+	request := encodeFrame(addr, FunctionCodeReadData, []byte{0x00, 0x00, 0x00, 0x00})
+	if _, err := handler.Send(request); !isTimeout(err) {
+		t.Fatalf("first request error %v, want a timeout", err)
+	}
+	<-sent
+	// let the late answer reach the receive buffer
+	time.Sleep(50 * time.Millisecond)
+
+	handler.Timeout = time.Second
+	response, err := handler.Send(encodeFrame(addr, FunctionCodeReadData, []byte{0x00, 0x00, 0x01, 0x00}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(response, answer) {
+		t.Fatalf("response % x, want % x", response, answer)
+	}
+}
+
+func TestTCPTransporterFlushesOnlyAfterFailure(t *testing.T) {
+	handler := NewClientTCPHandler(listenTCP(t, func(conn net.Conn) {
+		scanner := newFrameScanner(conn)
+		for {
+			request, err := scanner.next()
+			if err != nil {
+				return
+			}
+			// the second meter on the bus does not answer
+			if request[1] == 0x01 {
+				conn.Write(testReadAnswer)
+			}
+		}
+	}))
+	handler.Timeout = time.Second
+	defer handler.Close()
+
+	// answered exchanges do not wait for stale bytes
+	const requests = 50
+	start := time.Now()
+	for i := 0; i < requests; i++ {
+		if _, err := handler.Send(testReadRequest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= requests*tcpFlushTimeout {
+		t.Errorf("%d requests took %v", requests, elapsed)
+	}
+	if handler.dirty {
+		t.Fatal("flush pending after answered requests")
+	}
+
+	handler.Timeout = 50 * time.Millisecond
+	unanswered := encodeFrame(addressToDataDomain(304257140002), FunctionCodeReadData, []byte{0x00, 0x00, 0x00, 0x00})
+	if _, err := handler.Send(unanswered); !isTimeout(err) {
+		t.Fatalf("error %v, want a timeout", err)
+	}
+	if !handler.dirty {
+		t.Fatal("no flush pending after a timeout")
+	}
+	handler.Timeout = time.Second
+	if _, err := handler.Send(testReadRequest); err != nil {
+		t.Fatal(err)
+	}
+	if handler.dirty {
+		t.Fatal("flush pending after the next request")
+	}
+}
+
+func TestTCPTransporterReconnects(t *testing.T) {
+	addr := addressToDataDomain(304257140001)
+	answer := encodeFrame(addr, 0x91, []byte{0x00, 0x00, 0x00, 0x00, 0x22, 0x22, 0x22, 0x00})
+	handler := NewClientTCPHandler(listenTCP(t, func(conn net.Conn) {
+		if _, err := newFrameScanner(conn).next(); err != nil {
+			return
+		}
+		conn.Write(answer)
+	}))
+	handler.Timeout = time.Second
+	defer handler.Close()
+
+	request := encodeFrame(addr, FunctionCodeReadData, []byte{0x00, 0x00, 0x00, 0x00})
+	for i := 0; i < 3; i++ {
+		// the converter closes the connection after every answer
+		response, err := handler.Send(request)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		if !bytes.Equal(response, answer) {
+			t.Fatalf("request %d: response % x, want % x", i, response, answer)
+		}
+	}
+}